@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"file-system/vfs"
+	"file-system/vfs/httpfs"
+)
+
+const (
+	version = "1.0.0"
+)
+
+func printHelp() {
+	fmt.Println("In-Memory File System - A hierarchical file system simulator")
+	fmt.Println("\nUsage:")
+	fmt.Println("  file-system [flags]")
+	fmt.Println("  file-system serve [--addr host:port] [--tokens file] [--trust-user-header]")
+	fmt.Println("  file-system mount <mountpoint>")
+	fmt.Println("\nFlags:")
+	fmt.Println("  -h, --help       Show this help message")
+	fmt.Println("  -v, --version    Show version information")
+	fmt.Println("  -i, --interactive Start interactive shell (default)")
+	fmt.Println("  -r, --remote <url> Run the shell against a server started with 'serve'")
+	fmt.Println("                    (authenticating with the bearer token in $VFS_TOKEN if set)")
+	fmt.Println("  -u, --user <name> Act as this user (default: root)")
+	fmt.Println("  -b, --backend <spec> Where the tree is stored: memory (default),")
+	fmt.Println("                    host:<dir> (a directory on disk) or db:<file> (a single database file,")
+	fmt.Println("                    encrypted with the passphrase in $VFS_PASSPHRASE if set)")
+	fmt.Println("  -t, --trash <max-age> Move removed nodes to the trash, kept for max-age (0: until emptied)")
+	fmt.Println("  -a, --audit <file> Append every change to the tree to file, as JSON lines")
+	fmt.Println("\nModes:")
+	fmt.Println("  serve             Serve a file system over a JSON HTTP API (default addr 127.0.0.1:8080;")
+	fmt.Println("                    --tokens: require bearer tokens, --trust-user-header: honor X-Vfs-User)")
+	fmt.Println("  mount             Mount a file system through FUSE (linux/macOS)")
+	fmt.Println("\nAvailable Commands:")
+	fmt.Println("  mkdir <path>              Create a new directory")
+	fmt.Println("  touch <path> [content]    Create a new file with optional content")
+	fmt.Println("  write <path> [content]    Replace the content of a file")
+	fmt.Println("  ls [-alRStr] [path]       List a directory (default: /; -a: hidden too, -l: long, -R: recursive, -S/-t: by size/time, -r: reversed)")
+	fmt.Println("  cat <path>[@n]            Display file contents (@n: of version n)")
+	fmt.Println("  rm <path>                 Remove file or directory recursively")
+	fmt.Println("  cp <src> <dst>            Copy a file or directory")
+	fmt.Println("  mv <src> <dst>            Move or rename a file or directory")
+	fmt.Println("  stat <path>               Show size, owner, times and content hash")
+	fmt.Println("  versions <path>           List the kept versions of a file")
+	fmt.Println("  revert <path> <n>         Write version n of a file back as a new version")
+	fmt.Println("  diff <a> <b>              Compare two files (unified diff) or two directories")
+	fmt.Println("  sha256sum <path>...       Print the sha256 checksum of files")
+	fmt.Println("  md5sum <path>...          Print the md5 checksum of files")
+	fmt.Println("  manifest [-md5] <dir> [file]  Print (or save to file) the checksums of every file below dir")
+	fmt.Println("  verify <dir> <manifest>   Report files added, removed or changed since the manifest")
+	fmt.Println("  sync [-n] [-delete] [-2] <src> <dst>  Make dst like src (-n: dry run; -delete: remove extra entries; -2: both ways)")
+	fmt.Println("  watch [-r] <path>         Print changes to a path (-r: and everything below)")
+	fmt.Println("  unwatch <path>            Stop watching a path")
+	fmt.Println("  trash                     Show whether rm moves nodes to the trash")
+	fmt.Println("  trash on [max-age] | off  Turn the trash on (kept for max-age, e.g. 72h) or off")
+	fmt.Println("  trash list                List the nodes in the trash")
+	fmt.Println("  restore <id> [path]       Bring a node back from the trash")
+	fmt.Println("  empty                     Empty the trash for good")
+	fmt.Println("  lock [-s] [-t timeout] <path>  Lock a file (-s: shared; -t: wait up to timeout)")
+	fmt.Println("  unlock <path>             Release a lock taken with lock")
+	fmt.Println("  locks                     List the locks held on the tree")
+	fmt.Println("  quota                     Show quotas and their usage")
+	fmt.Println("  quota set <path> <bytes> <inodes>  Limit a directory (0: unlimited)")
+	fmt.Println("  quota user <name> <bytes> <inodes> Limit a user (0: unlimited)")
+	fmt.Println("  rules [name=value]...     Show or change the path rules (max-name, max-path, reserved, forbidden, control, strict, nfc, case)")
+	fmt.Println("  mount                     List mount points")
+	fmt.Println("  mount [-o] <path> <backend> Mount memory, host:<dir> or db:<file> (-o: as a read-only overlay base)")
+	fmt.Println("  umount <path>             Unmount a path")
+	fmt.Println("  xattr list <path>         List the extended attributes of a node")
+	fmt.Println("  xattr get <path> <name>   Show an extended attribute")
+	fmt.Println("  xattr set <path> <name> [value]  Set an extended attribute")
+	fmt.Println("  xattr rm <path> <name>    Remove an extended attribute")
+	fmt.Println("  find [path] [-name <glob>] [-type f|d] [-xattr <name>[=value]]  Search a tree")
+	fmt.Println("  search <terms>            Search file contents (words with AND, OR, NOT and parentheses)")
+	fmt.Println("  generate [-depth n] [-dirs n] [-files n] [-size min-max] [-exp] [-random] [-seed n] <dir>  Build a synthetic tree for load testing")
+	fmt.Println("  stats [path]              Show node counts, sizes, memory use and shape of a tree")
+	fmt.Println("  df                        Show the size of the tree at / and at each mount point")
+	fmt.Println("  crypt                     List encrypted directories")
+	fmt.Println("  crypt init|unlock|lock <dir>  Encrypt a directory, or unlock or lock it (asks for the passphrase)")
+	fmt.Println("  audit [--path p] [--since t] [--user u] [--json]  Show the changes made to the tree (t: a time or a duration ago, e.g. 1h)")
+	fmt.Println("  help                      Show available commands")
+	fmt.Println("  exit                      Exit the application")
+	fmt.Println("\nExamples:")
+	fmt.Println("  > mkdir /home/user")
+	fmt.Println("  > touch /home/user/file.txt Hello World")
+	fmt.Println("  > ls /home")
+	fmt.Println("  > cat /home/user/file.txt")
+	fmt.Println("  > rm /home/user/file.txt")
+}
+
+func printVersion() {
+	fmt.Printf("In-Memory File System v%s\n", version)
+	fmt.Println("A hierarchical file system simulator written in Go")
+}
+
+func main() {
+	// Define flags
+	helpFlag := flag.Bool("h", false, "Show help message")
+	helpLongFlag := flag.Bool("help", false, "Show help message")
+	versionFlag := flag.Bool("v", false, "Show version information")
+	versionLongFlag := flag.Bool("version", false, "Show version information")
+	interactiveFlag := flag.Bool("i", false, "Start interactive shell")
+	interactiveLongFlag := flag.Bool("interactive", false, "Start interactive shell")
+	remoteFlag := flag.String("r", "", "Server URL to run the shell against")
+	remoteLongFlag := flag.String("remote", "", "Server URL to run the shell against")
+	userFlag := flag.String("u", "", "User to act as")
+	userLongFlag := flag.String("user", "", "User to act as")
+	backendFlag := flag.String("b", "", "Storage backend: memory, host:<dir> or db:<file>")
+	backendLongFlag := flag.String("backend", "", "Storage backend: memory, host:<dir> or db:<file>")
+	trashFlag := flag.String("t", "", "Trash removed nodes, kept for this long (0: until emptied)")
+	trashLongFlag := flag.String("trash", "", "Trash removed nodes, kept for this long (0: until emptied)")
+	auditFlag := flag.String("a", "", "Audit log file, appended to as JSON lines")
+	auditLongFlag := flag.String("audit", "", "Audit log file, appended to as JSON lines")
+
+	flag.Parse()
+
+	// Handle flags
+	if *helpFlag || *helpLongFlag {
+		printHelp()
+		return
+	}
+
+	if *versionFlag || *versionLongFlag {
+		printVersion()
+		return
+	}
+
+	backend := *backendFlag
+	if *backendLongFlag != "" {
+		backend = *backendLongFlag
+	}
+	trash := *trashFlag
+	if *trashLongFlag != "" {
+		trash = *trashLongFlag
+	}
+	audit := *auditFlag
+	if *auditLongFlag != "" {
+		audit = *auditLongFlag
+	}
+
+	// Sub-commands
+	switch flag.Arg(0) {
+	case "serve":
+		fs := openFileSystem(backend, trash, audit)
+		defer fs.Close()
+		runServe(fs, flag.Args()[1:])
+		return
+	case "mount":
+		fs := openFileSystem(backend, trash, audit)
+		defer fs.Close()
+		runMount(fs, flag.Args()[1:])
+		return
+	}
+
+	// Default behavior or explicit interactive flag
+	if *interactiveFlag || *interactiveLongFlag || flag.NArg() == 0 {
+		remote := *remoteFlag
+		if *remoteLongFlag != "" {
+			remote = *remoteLongFlag
+		}
+		user := *userFlag
+		if *userLongFlag != "" {
+			user = *userLongFlag
+		}
+
+		if remote == "" {
+			fs := openFileSystem(backend, trash, audit)
+			defer fs.Close()
+			if user != "" {
+				fs = fs.WithUser(user)
+			}
+			runInteractiveShell(fs)
+			return
+		}
+
+		client, err := httpfs.NewClient(remote)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if user != "" {
+			client = client.WithUser(user)
+		}
+		if token := os.Getenv("VFS_TOKEN"); token != "" {
+			client = client.WithToken(token)
+		}
+		runInteractiveShell(client)
+	} else {
+		fmt.Println("Error: Invalid arguments")
+		fmt.Println("Use -h or --help for usage information")
+		os.Exit(1)
+	}
+}
+
+// helper: opens the file system on the backend named by spec, with the trash
+// on if trash gives a max age and the audit log on (keeping the last
+// vfs.DefaultAuditLimit entries in memory), also appended to the audit file
+// if one is given, exiting on failure
+func openFileSystem(spec, trash, audit string) *vfs.FileSystem {
+	var maxAge time.Duration
+	if trash != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(trash); err != nil || maxAge < 0 {
+			fmt.Println("Error: --trash wants a duration like 72h, or 0")
+			os.Exit(1)
+		}
+	}
+
+	backend, err := openBackend(spec)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fs := vfs.NewFileSystemWithBackend(backend)
+	if trash != "" {
+		fs.SetTrash(true, maxAge)
+	}
+
+	// the file stays open, and appended to, until the program exits
+	var sink io.Writer
+	if audit != "" {
+		f, err := os.OpenFile(audit, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		sink = f
+	}
+	fs.SetAuditLog(true, sink)
+	return fs
+}
+
+// helper: opens the backend named by spec: memory, host:<dir> or db:<file>.
+// A db file is encrypted with the passphrase in $VFS_PASSPHRASE, if set.
+func openBackend(spec string) (vfs.Backend, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "memory":
+		return vfs.NewMemoryBackend(), nil
+	case "host":
+		return vfs.NewHostBackend(arg)
+	case "db":
+		if passphrase := os.Getenv("VFS_PASSPHRASE"); passphrase != "" {
+			return vfs.OpenEncryptedDBBackend(arg, passphrase)
+		}
+		return vfs.OpenDBBackend(arg)
+	}
+	return nil, fmt.Errorf("unknown backend %q (want memory, host:<dir> or db:<file>)", spec)
+}
+
+// serve [--addr host:port] [--tokens file] [--trust-user-header]: returns
+// once the server is shut down by Ctrl-C or SIGTERM, so the file system
+// can be closed
+func runServe(fs *vfs.FileSystem, args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "Address to listen on")
+	tokens := flags.String("tokens", "", "File of bearer tokens and the users they act as, one 'token user' per line")
+	trust := flags.Bool("trust-user-header", false, "Act as the user in the "+httpfs.UserHeader+" header (behind an authenticating proxy)")
+	flags.Parse(args)
+
+	h := httpfs.NewHandler(fs)
+	h.TrustUserHeader(*trust)
+	if *tokens != "" {
+		users, err := readTokens(*tokens)
+		if err != nil {
+			log.Println("error:", err)
+			return
+		}
+		h.SetTokens(users)
+	}
+
+	server := &http.Server{Addr: *addr, Handler: h}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("error:", err)
+		}
+	}()
+
+	log.Printf("serving file system on %s", *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Println("error:", err)
+		return
+	}
+	log.Println("shut down")
+}
+
+// helper: reads a tokens file: "token user" lines, with blank lines and
+// lines starting with # skipped
+func readTokens(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]string)
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s line %d: want \"token user\"", name, n+1)
+		}
+		users[fields[0]] = fields[1]
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s has no tokens", name)
+	}
+	return users, nil
+}
@@ -0,0 +1,41 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"file-system/vfs"
+	"file-system/vfs/fusefs"
+)
+
+// mount <mountpoint>
+func runMount(fs *vfs.FileSystem, args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: file-system mount <mountpoint>")
+		os.Exit(1)
+	}
+
+	server, err := fusefs.Mount(fs, args[0])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("mounted on %s, press Ctrl-C to unmount\n", args[0])
+
+	// Unmount cleanly on Ctrl-C; an external `fusermount -u` ends Wait too
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		if err := server.Unmount(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}()
+
+	server.Wait()
+	fmt.Println("unmounted")
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"file-system/vfs"
+)
+
+// mount <mountpoint>
+func runMount(fs *vfs.FileSystem, args []string) {
+	fmt.Println("Error: mount is only supported on linux and macOS")
+	os.Exit(1)
+}
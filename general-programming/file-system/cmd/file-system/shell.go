@@ -0,0 +1,1411 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-system/vfs"
+	"file-system/vfs/httpfs"
+
+	"golang.org/x/term"
+)
+
+// fileSystem is what the shell drives: a local *vfs.FileSystem, or an
+// *httpfs.Client when talking to a remote server
+type fileSystem interface {
+	Mkdir(path string) error
+	Touch(path string, content string) error
+	Write(path string, content string) error
+	Ls(path string) ([]string, error)
+	Cat(path string) (string, error)
+	Rm(path string) error
+}
+
+var (
+	_ fileSystem = (*vfs.FileSystem)(nil)
+	_ fileSystem = (*httpfs.Client)(nil)
+)
+
+func printBanner() {
+	fmt.Printf("Welcome!\n")
+	fmt.Println("Type 'help' for available commands or 'exit' to quit")
+	fmt.Println()
+}
+
+func printCommandHelp() {
+	fmt.Println("\nAvailable Commands:")
+	fmt.Println("  mkdir <path>              Create a new directory")
+	fmt.Println("  touch <path> [content]    Create a file with optional content")
+	fmt.Println("  write <path> [content]    Replace the content of a file")
+	fmt.Println("  ls [-alRStr] [path]       List a directory (default: /; -a: hidden too, -l: long, -R: recursive, -S/-t: by size/time, -r: reversed)")
+	fmt.Println("  cat <path>[@n]            Display file contents (@n: of version n)")
+	fmt.Println("  rm <path>                 Remove file or directory")
+	fmt.Println("  cp <src> <dst>            Copy a file or directory")
+	fmt.Println("  mv <src> <dst>            Move or rename a file or directory")
+	fmt.Println("  stat <path>               Show size, owner, times and content hash")
+	fmt.Println("  versions <path>           List the kept versions of a file")
+	fmt.Println("  revert <path> <n>         Write version n of a file back as a new version")
+	fmt.Println("  diff <a> <b>              Compare two files (unified diff) or two directories")
+	fmt.Println("  sha256sum <path>...       Print the sha256 checksum of files")
+	fmt.Println("  md5sum <path>...          Print the md5 checksum of files")
+	fmt.Println("  manifest [-md5] <dir> [file]  Print (or save to file) the checksums of every file below dir")
+	fmt.Println("  verify <dir> <manifest>   Report files added, removed or changed since the manifest")
+	fmt.Println("  sync [-n] [-delete] [-2] <src> <dst>  Make dst like src (-n: dry run; -delete: remove extra entries; -2: both ways)")
+	fmt.Println("  watch [-r] <path>         Print changes to a path (-r: and everything below)")
+	fmt.Println("  unwatch <path>            Stop watching a path")
+	fmt.Println("  trash                     Show whether rm moves nodes to the trash")
+	fmt.Println("  trash on [max-age] | off  Turn the trash on (kept for max-age, e.g. 72h) or off")
+	fmt.Println("  trash list                List the nodes in the trash")
+	fmt.Println("  restore <id> [path]       Bring a node back from the trash")
+	fmt.Println("  empty                     Empty the trash for good")
+	fmt.Println("  lock [-s] [-t timeout] <path>  Lock a file (-s: shared; -t: wait up to timeout)")
+	fmt.Println("  unlock <path>             Release a lock taken with lock")
+	fmt.Println("  locks                     List the locks held on the tree")
+	fmt.Println("  quota                     Show quotas and their usage")
+	fmt.Println("  quota set <path> <bytes> <inodes>  Limit a directory (0: unlimited)")
+	fmt.Println("  quota user <name> <bytes> <inodes> Limit a user (0: unlimited)")
+	fmt.Println("  rules [name=value]...     Show or change the path rules (max-name, max-path, reserved, forbidden, control, strict, nfc, case)")
+	fmt.Println("  mount                     List mount points")
+	fmt.Println("  mount [-o] <path> <backend> Mount memory, host:<dir> or db:<file> (-o: as a read-only overlay base)")
+	fmt.Println("  umount <path>             Unmount a path")
+	fmt.Println("  xattr list <path>         List the extended attributes of a node")
+	fmt.Println("  xattr get <path> <name>   Show an extended attribute")
+	fmt.Println("  xattr set <path> <name> [value]  Set an extended attribute")
+	fmt.Println("  xattr rm <path> <name>    Remove an extended attribute")
+	fmt.Println("  find [path] [-name <glob>] [-type f|d] [-xattr <name>[=value]]  Search a tree")
+	fmt.Println("  search <terms>            Search file contents (words with AND, OR, NOT and parentheses)")
+	fmt.Println("  generate [-depth n] [-dirs n] [-files n] [-size min-max] [-exp] [-random] [-seed n] <dir>  Build a synthetic tree for load testing")
+	fmt.Println("  stats [path]              Show node counts, sizes, memory use and shape of a tree")
+	fmt.Println("  df                        Show the size of the tree at / and at each mount point")
+	fmt.Println("  crypt                     List encrypted directories")
+	fmt.Println("  crypt init|unlock|lock <dir>  Encrypt a directory, or unlock or lock it (asks for the passphrase)")
+	fmt.Println("  audit [--path p] [--since t] [--user u] [--json]  Show the changes made to the tree (t: a time or a duration ago, e.g. 1h)")
+	fmt.Println("  help                      Show this help")
+	fmt.Println("  exit                      Exit the program")
+	fmt.Println()
+}
+
+func runInteractiveShell(fs fileSystem) {
+	scanner := bufio.NewScanner(os.Stdin)
+
+	// active watches by path, stopped with unwatch or on exit
+	watchers := make(map[string]*vfs.Watcher)
+	defer func() {
+		for _, w := range watchers {
+			w.Close()
+		}
+	}()
+
+	// locks taken with lock, released with unlock or on exit
+	var locks []*vfs.Lock
+	defer func() {
+		for _, l := range locks {
+			l.Unlock()
+		}
+	}()
+
+	printBanner()
+
+	for {
+		// 1. Print Prompt
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			break
+		}
+
+		// 2. Parse Input
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		cmd := parts[0]
+
+		// 3. Execute Command
+		switch cmd {
+		case "help":
+			printCommandHelp()
+
+		case "mkdir":
+			if len(parts) < 2 {
+				fmt.Println("usage: mkdir <path>")
+				continue
+			}
+			err := fs.Mkdir(parts[1])
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "touch":
+			if len(parts) < 2 {
+				fmt.Println("usage: touch <path> [content]")
+				continue
+			}
+			// Join remaining parts as content (allow spaces in text)
+			content := ""
+			if len(parts) > 2 {
+				content = strings.Join(parts[2:], " ")
+			}
+			err := fs.Touch(parts[1], content)
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "write":
+			if len(parts) < 2 {
+				fmt.Println("usage: write <path> [content]")
+				continue
+			}
+			content := ""
+			if len(parts) > 2 {
+				content = strings.Join(parts[2:], " ")
+			}
+			err := fs.Write(parts[1], content)
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "ls":
+			runLs(fs, parts[1:])
+
+		case "rm":
+			if len(parts) < 2 {
+				fmt.Println("usage: rm <path>")
+				continue
+			}
+			err := fs.Rm(parts[1])
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "cat":
+			if len(parts) < 2 {
+				fmt.Println("usage: cat <path>[@n]")
+				continue
+			}
+			content, err := catFile(fs, parts[1])
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println(content)
+			}
+
+		case "versions":
+			local, ok := localFS(fs, "versions")
+			if !ok {
+				continue
+			}
+			if len(parts) != 2 {
+				fmt.Println("usage: versions <path>")
+				continue
+			}
+			versions, err := local.Versions(parts[1])
+			if err != nil {
+				fmt.Println("error:", err)
+				continue
+			}
+			if len(versions) == 0 {
+				fmt.Println("no versions kept")
+			}
+			for _, v := range versions {
+				fmt.Printf("%4d  %s  %-10s %d bytes\n", v.N, v.Time.Format(time.DateTime), v.Author, v.Size)
+			}
+
+		case "revert":
+			local, ok := localFS(fs, "revert")
+			if !ok {
+				continue
+			}
+			if len(parts) != 3 {
+				fmt.Println("usage: revert <path> <n>")
+				continue
+			}
+			n, err := strconv.Atoi(parts[2])
+			if err != nil {
+				fmt.Println("error: version must be a number")
+				continue
+			}
+			if err := local.Revert(parts[1], n); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "stat":
+			if len(parts) < 2 {
+				fmt.Println("usage: stat <path>")
+				continue
+			}
+			local, ok := localFS(fs, "stat")
+			if !ok {
+				continue
+			}
+			info, err := local.Stat(parts[1])
+			if err != nil {
+				fmt.Println("error:", err)
+				continue
+			}
+			printStat(info)
+
+		case "cp", "mv":
+			if len(parts) < 3 {
+				fmt.Printf("usage: %s <src> <dst>\n", cmd)
+				continue
+			}
+			local, ok := localFS(fs, cmd)
+			if !ok {
+				continue
+			}
+			var err error
+			if cmd == "cp" {
+				err = local.Cp(parts[1], parts[2])
+			} else {
+				err = local.Mv(parts[1], parts[2])
+			}
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "watch":
+			// watch [-r] <path>
+			recursive := len(parts) > 1 && parts[1] == "-r"
+			args := parts[1:]
+			if recursive {
+				args = parts[2:]
+			}
+			if len(args) < 1 {
+				fmt.Println("usage: watch [-r] <path>")
+				continue
+			}
+			local, ok := localFS(fs, "watch")
+			if !ok {
+				continue
+			}
+			if _, exists := watchers[args[0]]; exists {
+				fmt.Println("error: already watching", args[0])
+				continue
+			}
+			w, err := local.Watch(args[0], recursive)
+			if err != nil {
+				fmt.Println("error:", err)
+				continue
+			}
+			watchers[args[0]] = w
+			go func() {
+				for ev := range w.Events() {
+					fmt.Println("event:", ev)
+				}
+			}()
+			fmt.Println("ok")
+
+		case "unwatch":
+			if len(parts) < 2 {
+				fmt.Println("usage: unwatch <path>")
+				continue
+			}
+			w, exists := watchers[parts[1]]
+			if !exists {
+				fmt.Println("error: not watching", parts[1])
+				continue
+			}
+			w.Close()
+			delete(watchers, parts[1])
+			fmt.Println("ok")
+
+		case "quota":
+			local, ok := localFS(fs, "quota")
+			if !ok {
+				continue
+			}
+			runQuota(local, parts[1:])
+
+		case "mount":
+			local, ok := localFS(fs, "mount")
+			if !ok {
+				continue
+			}
+			runMountCommand(local, parts[1:])
+
+		case "umount":
+			if len(parts) < 2 {
+				fmt.Println("usage: umount <path>")
+				continue
+			}
+			local, ok := localFS(fs, "umount")
+			if !ok {
+				continue
+			}
+			if err := local.Unmount(parts[1]); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "xattr":
+			local, ok := localFS(fs, "xattr")
+			if !ok {
+				continue
+			}
+			runXattr(local, parts[1:])
+
+		case "find":
+			local, ok := localFS(fs, "find")
+			if !ok {
+				continue
+			}
+			runFind(local, parts[1:])
+
+		case "search":
+			if len(parts) < 2 {
+				fmt.Println("usage: search <terms>")
+				continue
+			}
+			local, ok := localFS(fs, "search")
+			if !ok {
+				continue
+			}
+			results, err := local.Search("/", strings.Join(parts[1:], " "))
+			if err != nil {
+				fmt.Println("error:", err)
+				continue
+			}
+			if len(results) == 0 {
+				fmt.Println("no matches")
+			}
+			for _, r := range results {
+				fmt.Printf("%7.3f  %s\n", r.Score, r.Path)
+			}
+
+		case "diff":
+			if len(parts) != 3 {
+				fmt.Println("usage: diff <a> <b>")
+				continue
+			}
+			local, ok := localFS(fs, "diff")
+			if !ok {
+				continue
+			}
+			runDiff(local, parts[1], parts[2])
+
+		case "sha256sum", "md5sum":
+			if len(parts) < 2 {
+				fmt.Printf("usage: %s <path>...\n", cmd)
+				continue
+			}
+			local, ok := localFS(fs, cmd)
+			if !ok {
+				continue
+			}
+			algorithm := vfs.ChecksumAlgorithm(strings.TrimSuffix(cmd, "sum"))
+			for _, p := range parts[1:] {
+				if sum, err := local.Checksum(p, algorithm); err != nil {
+					fmt.Println("error:", err)
+				} else {
+					fmt.Printf("%s  %s\n", sum, p)
+				}
+			}
+
+		case "manifest":
+			local, ok := localFS(fs, "manifest")
+			if !ok {
+				continue
+			}
+			runManifest(local, parts[1:])
+
+		case "verify":
+			if len(parts) != 3 {
+				fmt.Println("usage: verify <dir> <manifest>")
+				continue
+			}
+			local, ok := localFS(fs, "verify")
+			if !ok {
+				continue
+			}
+			runVerify(local, parts[1], parts[2])
+
+		case "rules":
+			local, ok := localFS(fs, "rules")
+			if !ok {
+				continue
+			}
+			runRules(local, parts[1:])
+
+		case "sync":
+			local, ok := localFS(fs, "sync")
+			if !ok {
+				continue
+			}
+			runSync(local, parts[1:])
+
+		case "trash":
+			local, ok := localFS(fs, "trash")
+			if !ok {
+				continue
+			}
+			runTrash(local, parts[1:])
+
+		case "restore":
+			if len(parts) != 2 && len(parts) != 3 {
+				fmt.Println("usage: restore <id> [path]")
+				continue
+			}
+			local, ok := localFS(fs, "restore")
+			if !ok {
+				continue
+			}
+			dst := ""
+			if len(parts) == 3 {
+				dst = parts[2]
+			}
+			if err := local.Restore(parts[1], dst); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "empty":
+			local, ok := localFS(fs, "empty")
+			if !ok {
+				continue
+			}
+			if err := local.EmptyTrash(); err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "lock":
+			local, ok := localFS(fs, "lock")
+			if !ok {
+				continue
+			}
+			if l := runLock(local, parts[1:]); l != nil {
+				locks = append(locks, l)
+			}
+
+		case "unlock":
+			if len(parts) != 2 {
+				fmt.Println("usage: unlock <path>")
+				continue
+			}
+			i := slices.IndexFunc(locks, func(l *vfs.Lock) bool { return l.Matches(parts[1]) })
+			if i < 0 {
+				fmt.Println("error: no lock held on", parts[1])
+				continue
+			}
+			err := locks[i].Unlock()
+			locks = slices.Delete(locks, i, i+1)
+			if err != nil {
+				fmt.Println("error:", err)
+			} else {
+				fmt.Println("ok")
+			}
+
+		case "locks":
+			local, ok := localFS(fs, "locks")
+			if !ok {
+				continue
+			}
+			held := local.Locks()
+			if len(held) == 0 {
+				fmt.Println("no locks held")
+			}
+			for _, l := range held {
+				fmt.Printf("%-9s %-10s %s\n", l.Type, l.Owner, l.Path)
+			}
+
+		case "generate":
+			local, ok := localFS(fs, "generate")
+			if !ok {
+				continue
+			}
+			runGenerate(local, parts[1:])
+
+		case "stats":
+			local, ok := localFS(fs, "stats")
+			if !ok {
+				continue
+			}
+			runStats(local, parts[1:])
+
+		case "df":
+			local, ok := localFS(fs, "df")
+			if !ok {
+				continue
+			}
+			runDf(local)
+
+		case "crypt":
+			local, ok := localFS(fs, "crypt")
+			if !ok {
+				continue
+			}
+			runCrypt(local, parts[1:], scanner)
+
+		case "audit":
+			local, ok := localFS(fs, "audit")
+			if !ok {
+				continue
+			}
+			runAudit(local, parts[1:])
+
+		case "exit":
+			fmt.Println("shutting down...")
+			return
+
+		default:
+			fmt.Printf("unknown command: '%s'. Type 'help' for available commands.\n", cmd)
+		}
+	}
+}
+
+// helper: the local file system behind fs, for the commands the remote
+// client doesn't offer
+func localFS(fs fileSystem, cmd string) (*vfs.FileSystem, bool) {
+	local, ok := fs.(*vfs.FileSystem)
+	if !ok {
+		fmt.Printf("error: %s is only available on a local file system\n", cmd)
+	}
+	return local, ok
+}
+
+// helper: cats path, or version n of it for path@n (unless a file is
+// actually named that)
+func catFile(fs fileSystem, arg string) (string, error) {
+	if local, ok := fs.(*vfs.FileSystem); ok {
+		if i := strings.LastIndex(arg, "@"); i >= 0 {
+			if n, err := strconv.Atoi(arg[i+1:]); err == nil {
+				if _, err := local.Stat(arg); errors.Is(err, vfs.ErrNotExist) {
+					return local.ReadVersion(arg[:i], n)
+				}
+			}
+		}
+	}
+	return fs.Cat(arg)
+}
+
+func printStat(info vfs.FileInfo) {
+	kind := "file"
+	if info.IsDir {
+		kind = "directory"
+	}
+	fmt.Println("name:    ", info.Name)
+	fmt.Println("type:    ", kind)
+	fmt.Println("size:    ", info.Size)
+	if !info.IsDir {
+		stored := fmt.Sprint(info.PhysicalSize)
+		if info.Compressed {
+			stored += " (gzip)"
+		}
+		fmt.Println("stored:  ", stored)
+	}
+	fmt.Println("owner:   ", info.Owner)
+	fmt.Println("modified:", info.ModTime.Format(time.RFC3339))
+	if info.Hash != "" {
+		fmt.Println("sha256:  ", info.Hash)
+	}
+}
+
+// quota [set <path> | user <name>] [<bytes> <inodes>]
+func runQuota(fs *vfs.FileSystem, args []string) {
+	if len(args) == 0 {
+		reports := fs.Quotas()
+		if len(reports) == 0 {
+			fmt.Println("no quotas set")
+		}
+		for _, r := range reports {
+			target := r.Path
+			if r.User != "" {
+				target = "user " + r.User
+			}
+			fmt.Printf("%-20s bytes %d/%s  inodes %d/%s\n", target,
+				r.Used.Bytes, formatLimit(r.Limit.MaxBytes), r.Used.Inodes, formatLimit(r.Limit.MaxInodes))
+		}
+		return
+	}
+
+	if len(args) != 4 || (args[0] != "set" && args[0] != "user") {
+		fmt.Println("usage: quota [set <path> <bytes> <inodes> | user <name> <bytes> <inodes>]")
+		return
+	}
+	maxBytes, err1 := strconv.ParseInt(args[2], 10, 64)
+	maxInodes, err2 := strconv.ParseInt(args[3], 10, 64)
+	if err1 != nil || err2 != nil || maxBytes < 0 || maxInodes < 0 {
+		fmt.Println("error: limits must be non-negative numbers")
+		return
+	}
+
+	q := vfs.Quota{MaxBytes: maxBytes, MaxInodes: maxInodes}
+	var err error
+	if args[0] == "user" {
+		err = fs.SetUserQuota(args[1], q)
+	} else {
+		err = fs.SetQuota(args[1], q)
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println("ok")
+}
+
+// mount [[-o] <path> <backend>]
+func runMountCommand(fs *vfs.FileSystem, args []string) {
+	if len(args) == 0 {
+		mounts := fs.Mounts()
+		if len(mounts) == 0 {
+			fmt.Println("nothing mounted")
+		}
+		for _, m := range mounts {
+			fmt.Println(m)
+		}
+		return
+	}
+
+	overlay := args[0] == "-o"
+	if overlay {
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		fmt.Println("usage: mount [-o] <path> <memory|host:<dir>|db:<file>>")
+		return
+	}
+
+	backend, err := openBackend(args[1])
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	// changes to an overlay live in memory; the base is never written
+	if overlay {
+		backend = vfs.NewOverlayBackend(backend, vfs.NewMemoryBackend())
+	}
+	if err := fs.Mount(args[0], backend); err != nil {
+		if c, ok := backend.(io.Closer); ok {
+			c.Close()
+		}
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println("ok")
+}
+
+// diff <a> <b>: a unified diff for two files, the changed entries otherwise
+func runDiff(fs *vfs.FileSystem, a, b string) {
+	infoA, errA := fs.Stat(a)
+	infoB, errB := fs.Stat(b)
+	if errA == nil && errB == nil && !infoA.IsDir && !infoB.IsDir {
+		diff, err := fs.UnifiedDiff(a, b)
+		if err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		if diff == "" {
+			fmt.Println("no differences")
+		}
+		fmt.Print(diff)
+		return
+	}
+
+	changes, err := fs.Diff(a, b)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	if len(changes) == 0 {
+		fmt.Println("no differences")
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+}
+
+// manifest [-md5] <dir> [file]: prints the manifest, or saves it to file
+func runManifest(fs *vfs.FileSystem, args []string) {
+	algorithm := vfs.SHA256
+	if len(args) > 0 && args[0] == "-md5" {
+		algorithm, args = vfs.MD5, args[1:]
+	}
+	if len(args) != 1 && len(args) != 2 {
+		fmt.Println("usage: manifest [-md5] <dir> [file]")
+		return
+	}
+
+	m, err := fs.Manifest(args[0], algorithm)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	if len(args) == 1 {
+		fmt.Print(m)
+		return
+	}
+
+	err = fs.Touch(args[1], m.String())
+	if errors.Is(err, vfs.ErrExist) {
+		err = fs.Write(args[1], m.String())
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Printf("ok (%d files)\n", len(m.Entries))
+}
+
+// ls [-alRStr] [path]
+func runLs(fs fileSystem, args []string) {
+	var opts vfs.ListOptions
+	long := false
+	dir := "/" // Default to root if no path provided
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			dir = arg
+			continue
+		}
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'a':
+				opts.All = true
+			case 'l':
+				long = true
+			case 'R':
+				opts.Recursive = true
+			case 'S':
+				opts.Sort = vfs.SortBySize
+			case 't':
+				opts.Sort = vfs.SortByTime
+			case 'r':
+				opts.Reverse = true
+			default:
+				fmt.Println("usage: ls [-alRStr] [path]")
+				return
+			}
+		}
+	}
+
+	local, ok := fs.(*vfs.FileSystem)
+	if !ok {
+		// the remote client only has names
+		if long || opts.Recursive || opts.Sort != vfs.SortByName || opts.Reverse {
+			fmt.Println("error: ls -l, -R, -S, -t and -r are only available on a local file system")
+			return
+		}
+		names, err := fs.Ls(dir)
+		if err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		for _, name := range names {
+			if opts.All || !strings.HasPrefix(name, ".") {
+				fmt.Println(name)
+			}
+		}
+		return
+	}
+
+	entries, err := local.List(dir, opts)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	section := "."
+	for _, e := range entries {
+		// a recursive listing gets a heading per directory, like ls -R
+		if parent := path.Dir(e.Path); opts.Recursive && parent != section {
+			section = parent
+			fmt.Printf("\n%s:\n", path.Join(dir, parent))
+		}
+		name := e.Name
+		if !long {
+			fmt.Println(name)
+			continue
+		}
+		kind := "-"
+		if e.IsDir {
+			kind = "d"
+		}
+		fmt.Printf("%s %-10s %8d %s %s\n", kind, e.Owner, e.Size, e.ModTime.Format(time.DateTime), name)
+	}
+}
+
+// rules [name=value]...: shows the path rules, after changing the ones given
+func runRules(fs *vfs.FileSystem, args []string) {
+	r := fs.PathRules()
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		var err error
+		switch name {
+		case "max-name":
+			r.MaxNameLength, err = strconv.Atoi(value)
+		case "max-path":
+			r.MaxPathLength, err = strconv.Atoi(value)
+		case "reserved":
+			r.ReservedNames = nil
+			if value != "" {
+				r.ReservedNames = strings.Split(value, ",")
+			}
+		case "forbidden":
+			r.ForbiddenChars = value
+		case "control":
+			r.AllowControlChars, err = parseOnOff(value)
+		case "strict":
+			r.StrictSlashes, err = parseOnOff(value)
+		case "nfc":
+			r.Normalize, err = parseOnOff(value)
+		case "case":
+			// on: case-sensitive, as usual
+			var sensitive bool
+			sensitive, err = parseOnOff(value)
+			r.CaseInsensitive = !sensitive
+		default:
+			err = fmt.Errorf("unknown rule %q", name)
+		}
+		if err != nil {
+			fmt.Printf("error: %s: %v\n", arg, err)
+			return
+		}
+	}
+	if len(args) > 0 {
+		if err := fs.SetPathRules(r); err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+	}
+
+	onOff := map[bool]string{true: "on", false: "off"}
+	fmt.Printf("max-name=%d max-path=%d reserved=%s forbidden=%q control=%s strict=%s nfc=%s case=%s\n",
+		r.MaxNameLength, r.MaxPathLength, strings.Join(r.ReservedNames, ","), r.ForbiddenChars,
+		onOff[r.AllowControlChars], onOff[r.StrictSlashes], onOff[r.Normalize], onOff[!r.CaseInsensitive])
+}
+
+// helper: parses "on" or "off"
+func parseOnOff(value string) (bool, error) {
+	switch value {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, errors.New("want on or off")
+}
+
+// sync [-n] [-delete] [-2] <src> <dst>
+func runSync(fs *vfs.FileSystem, args []string) {
+	usage := "usage: sync [-n] [-delete] [-2] <src> <dst>"
+	var opts vfs.SyncOptions
+	for len(args) > 2 {
+		switch args[0] {
+		case "-n":
+			opts.DryRun = true
+		case "-delete":
+			opts.Delete = true
+		case "-2":
+			opts.TwoWay = true
+		default:
+			fmt.Println(usage)
+			return
+		}
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		fmt.Println(usage)
+		return
+	}
+
+	ops, err := vfs.Sync(fs, args[0], fs, args[1], opts)
+	for _, op := range ops {
+		fmt.Println(op)
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+	} else if len(ops) == 0 {
+		fmt.Println("already in sync")
+	}
+}
+
+// audit [--path p] [--since t] [--user u] [--json]
+func runAudit(fs *vfs.FileSystem, args []string) {
+	usage := "usage: audit [--path p] [--since t] [--user u] [--json]"
+	var q vfs.AuditQuery
+	asJSON := false
+	for len(args) > 0 {
+		if args[0] == "--json" {
+			asJSON, args = true, args[1:]
+			continue
+		}
+		if len(args) < 2 {
+			fmt.Println(usage)
+			return
+		}
+		switch args[0] {
+		case "--path":
+			q.Path = args[1]
+		case "--user":
+			q.User = args[1]
+		case "--since":
+			since, err := parseSince(args[1])
+			if err != nil {
+				fmt.Println("error:", err)
+				return
+			}
+			q.Since = since
+		default:
+			fmt.Println(usage)
+			return
+		}
+		args = args[2:]
+	}
+
+	entries, err := fs.AuditLog(q)
+	if err != nil {
+		fmt.Println("error: audit file:", err)
+	}
+	if asJSON {
+		if err := vfs.WriteAuditLog(os.Stdout, entries); err != nil {
+			fmt.Println("error:", err)
+		}
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("nothing recorded")
+	}
+	for _, e := range entries {
+		target := e.Path
+		if e.NewPath != "" {
+			target += " -> " + e.NewPath
+		}
+		if e.Setting != "" {
+			target += " = " + e.Setting
+		}
+		fmt.Printf("%s %-10s %-11s %s: %s\n", e.Time.Format("2006-01-02 15:04:05"), e.User, e.Op, target, e.Result)
+	}
+}
+
+// helper: a --since value, either a time (RFC 3339) or a duration before now
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("--since wants a time like 2024-05-01T12:00:00Z or a duration like 1h")
+	}
+	return t, nil
+}
+
+// verify <dir> <manifest>: reports how dir drifted from the manifest file
+func runVerify(fs *vfs.FileSystem, dir, manifest string) {
+	content, err := fs.Cat(manifest)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	m, err := vfs.ParseManifest(strings.NewReader(content))
+	if err != nil {
+		fmt.Println("error:", manifest+":", err)
+		return
+	}
+
+	changes, err := fs.Verify(dir, m)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	if len(changes) == 0 {
+		fmt.Printf("ok (%d files match)\n", len(m.Entries))
+		return
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+}
+
+// lock [-s] [-t timeout] <path>: returns the lock taken, if any
+func runLock(fs *vfs.FileSystem, args []string) *vfs.Lock {
+	usage := "usage: lock [-s] [-t timeout] <path>"
+	typ := vfs.ExclusiveLock
+	timeout := time.Duration(-1) // try once
+	for len(args) > 1 {
+		switch args[0] {
+		case "-s":
+			typ, args = vfs.SharedLock, args[1:]
+		case "-t":
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				fmt.Println("error: timeout must be a duration like 5s")
+				return nil
+			}
+			timeout, args = d, args[2:]
+		default:
+			fmt.Println(usage)
+			return nil
+		}
+	}
+	if len(args) != 1 {
+		fmt.Println(usage)
+		return nil
+	}
+
+	var l *vfs.Lock
+	var err error
+	if timeout < 0 {
+		l, err = fs.TryLock(args[0], typ)
+	} else {
+		l, err = fs.Lock(args[0], typ, timeout)
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+		return nil
+	}
+	fmt.Println("ok")
+	return l
+}
+
+// generate [-depth n] [-dirs n] [-files n] [-size min-max] [-exp] [-random] [-seed n] <dir>
+func runGenerate(fs *vfs.FileSystem, args []string) {
+	usage := "usage: generate [-depth n] [-dirs n] [-files n] [-size min-max] [-exp] [-random] [-seed n] <dir>"
+	opts := vfs.GenerateOptions{Depth: 3, Dirs: 3, Files: 5, MaxSize: 4096}
+	for len(args) > 1 {
+		switch args[0] {
+		case "-exp":
+			opts.Sizes, args = vfs.SizeExponential, args[1:]
+			continue
+		case "-random":
+			opts.Random, args = true, args[1:]
+			continue
+		}
+		if len(args) < 3 {
+			fmt.Println(usage)
+			return
+		}
+		var err error
+		switch args[0] {
+		case "-depth":
+			opts.Depth, err = strconv.Atoi(args[1])
+		case "-dirs":
+			opts.Dirs, err = strconv.Atoi(args[1])
+		case "-files":
+			opts.Files, err = strconv.Atoi(args[1])
+		case "-size":
+			lo, hi, found := strings.Cut(args[1], "-")
+			if opts.MinSize, err = strconv.ParseInt(lo, 10, 64); err == nil {
+				opts.MaxSize = opts.MinSize
+				if found {
+					opts.MaxSize, err = strconv.ParseInt(hi, 10, 64)
+				}
+			}
+		case "-seed":
+			opts.Seed, err = strconv.ParseUint(args[1], 10, 64)
+		default:
+			err = errors.New("unknown option")
+		}
+		if err != nil {
+			fmt.Println(usage)
+			return
+		}
+		args = args[2:]
+	}
+	if len(args) != 1 {
+		fmt.Println(usage)
+		return
+	}
+
+	start := time.Now()
+	stats, err := fs.Generate(args[0], opts)
+	if err != nil {
+		fmt.Println("error:", err)
+		if stats == (vfs.GenerateStats{}) {
+			return
+		}
+	}
+	fmt.Printf("%d directories, %d files, %d bytes in %v\n", stats.Dirs, stats.Files, stats.Bytes, time.Since(start).Round(time.Millisecond))
+}
+
+// stats [path]
+func runStats(fs *vfs.FileSystem, args []string) {
+	if len(args) > 1 {
+		fmt.Println("usage: stats [path]")
+		return
+	}
+	path := "/"
+	if len(args) == 1 {
+		path = args[0]
+	}
+	stats, err := fs.Stats(path)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Printf("directories:  %d\n", stats.Dirs)
+	fmt.Printf("files:        %d\n", stats.Files)
+	fmt.Printf("bytes:        %d (%d stored)\n", stats.Bytes, stats.StoredBytes)
+	fmt.Printf("versions:     %d (%d more bytes stored)\n", stats.Versions, stats.VersionBytes)
+	fmt.Printf("memory:       ~%d bytes (process heap %d bytes)\n", stats.HeapBytes, mem.HeapAlloc)
+	fmt.Printf("deepest:      %s (depth %d)\n", stats.DeepestPath, stats.Depth)
+	if len(stats.LargestDirs) > 0 {
+		fmt.Println("largest directories:")
+	}
+	for _, d := range stats.LargestDirs {
+		fmt.Printf("  %8d  %s\n", d.Entries, d.Path)
+	}
+}
+
+// df: one line for the root and each mount point, counting everything
+// below it (mounts within included)
+func runDf(fs *vfs.FileSystem) {
+	fmt.Printf("%-20s %8s %8s %12s %12s\n", "mounted on", "dirs", "files", "bytes", "memory")
+	for _, p := range append([]string{"/"}, fs.Mounts()...) {
+		stats, err := fs.Stats(p)
+		if err != nil {
+			fmt.Printf("%-20s error: %v\n", p, err)
+			continue
+		}
+		fmt.Printf("%-20s %8d %8d %12d %12d\n", p, stats.Dirs, stats.Files, stats.Bytes, stats.HeapBytes)
+	}
+}
+
+// crypt [init|unlock|lock <dir>]: the passphrase is read from the next line
+func runCrypt(fs *vfs.FileSystem, args []string, scanner *bufio.Scanner) {
+	if len(args) == 0 {
+		dirs, err := fs.EncryptedDirs()
+		if err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		if len(dirs) == 0 {
+			fmt.Println("no encrypted directories")
+		}
+		for _, d := range dirs {
+			state := "locked"
+			if d.Unlocked {
+				state = "unlocked"
+			}
+			fmt.Printf("%-9s %s\n", state, d.Path)
+		}
+		return
+	}
+	if len(args) != 2 {
+		fmt.Println("usage: crypt [init|unlock|lock <dir>]")
+		return
+	}
+
+	dir := args[1]
+	var err error
+	switch args[0] {
+	case "init", "unlock":
+		passphrase, ok := readPassphrase(scanner)
+		if !ok {
+			return
+		}
+		if args[0] == "init" {
+			err = fs.EncryptDir(dir, passphrase)
+		} else {
+			err = fs.UnlockDir(dir, passphrase)
+		}
+	case "lock":
+		err = fs.LockDir(dir)
+	default:
+		fmt.Println("usage: crypt [init|unlock|lock <dir>]")
+		return
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+	} else {
+		fmt.Println("ok")
+	}
+}
+
+// helper: prompts for a passphrase, read without echo from a terminal, or
+// as the next line otherwise (e.g. from a script)
+func readPassphrase(scanner *bufio.Scanner) (string, bool) {
+	fmt.Print("passphrase: ")
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			fmt.Println("error:", err)
+			return "", false
+		}
+		return string(passphrase), true
+	}
+	if !scanner.Scan() {
+		return "", false
+	}
+	return scanner.Text(), true
+}
+
+// trash [on [max-age] | off | list]
+func runTrash(fs *vfs.FileSystem, args []string) {
+	switch {
+	case len(args) == 0:
+		enabled, maxAge := fs.Trash()
+		switch {
+		case !enabled:
+			fmt.Println("trash is off")
+		case maxAge == 0:
+			fmt.Println("trash is on, kept until emptied")
+		default:
+			fmt.Println("trash is on, kept for", maxAge)
+		}
+
+	case args[0] == "on" && len(args) <= 2:
+		var maxAge time.Duration
+		if len(args) == 2 {
+			var err error
+			if maxAge, err = time.ParseDuration(args[1]); err != nil || maxAge < 0 {
+				fmt.Println("error: max age must be a duration like 72h")
+				return
+			}
+		}
+		fs.SetTrash(true, maxAge)
+		fmt.Println("ok")
+
+	case args[0] == "off" && len(args) == 1:
+		_, maxAge := fs.Trash()
+		fs.SetTrash(false, maxAge)
+		fmt.Println("ok")
+
+	case args[0] == "list" && len(args) == 1:
+		entries, err := fs.ListTrash()
+		if err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("trash is empty")
+		}
+		for _, e := range entries {
+			path := e.Path
+			if e.IsDir {
+				path += "/"
+			}
+			fmt.Printf("%s  %s  %s\n", e.ID, e.Deleted.Format(time.DateTime), path)
+		}
+
+	default:
+		fmt.Println("usage: trash [on [max-age] | off | list]")
+	}
+}
+
+// xattr list <path> | get <path> <name> | set <path> <name> [value] | rm <path> <name>
+func runXattr(fs *vfs.FileSystem, args []string) {
+	usage := "usage: xattr list <path> | get <path> <name> | set <path> <name> [value] | rm <path> <name>"
+	if len(args) < 2 {
+		fmt.Println(usage)
+		return
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 2:
+		names, err := fs.ListXattrs(args[1])
+		if err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		for _, name := range names {
+			value, _ := fs.GetXattr(args[1], name)
+			fmt.Printf("%s=%s\n", name, value)
+		}
+
+	case args[0] == "get" && len(args) == 3:
+		value, err := fs.GetXattr(args[1], args[2])
+		if err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		fmt.Println(value)
+
+	case args[0] == "set" && len(args) >= 3:
+		// the value may contain spaces, like touch content
+		if err := fs.SetXattr(args[1], args[2], strings.Join(args[3:], " ")); err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		fmt.Println("ok")
+
+	case args[0] == "rm" && len(args) == 3:
+		if err := fs.RemoveXattr(args[1], args[2]); err != nil {
+			fmt.Println("error:", err)
+			return
+		}
+		fmt.Println("ok")
+
+	default:
+		fmt.Println(usage)
+	}
+}
+
+// find [path] [-name <glob>] [-type f|d] [-xattr <name>[=value]]
+func runFind(fs *vfs.FileSystem, args []string) {
+	usage := "usage: find [path] [-name <glob>] [-type f|d] [-xattr <name>[=value]]"
+	root := "/"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root, args = args[0], args[1:]
+	}
+
+	var q vfs.FindQuery
+	for ; len(args) > 0; args = args[2:] {
+		if len(args) < 2 {
+			fmt.Println(usage)
+			return
+		}
+		switch args[0] {
+		case "-name":
+			q.Name = args[1]
+		case "-type":
+			switch args[1] {
+			case "f":
+				q.Type = vfs.FindFiles
+			case "d":
+				q.Type = vfs.FindDirs
+			default:
+				fmt.Println(usage)
+				return
+			}
+		case "-xattr":
+			q.Xattr, q.XattrValue, _ = strings.Cut(args[1], "=")
+		default:
+			fmt.Println(usage)
+			return
+		}
+	}
+
+	paths, err := fs.Find(root, q)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+}
+
+func formatLimit(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
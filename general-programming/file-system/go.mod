@@ -1,3 +1,10 @@
 module file-system
 
 go 1.25.5
+
+require (
+	github.com/hanwen/go-fuse/v2 v2.11.0
+	golang.org/x/sys v0.28.0
+	golang.org/x/text v0.21.0
+	golang.org/x/term v0.27.0
+)
@@ -0,0 +1,186 @@
+package vfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AuditEntry records one operation that changed (or tried to change) the
+// tree or its settings, as kept by the audit log. NewPath is the
+// destination of a mv or a cp, and Setting what a setting was changed to.
+// Result is "ok", or the error the operation failed with.
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Op      string    `json:"op"`
+	Path    string    `json:"path"`
+	NewPath string    `json:"new_path,omitempty"`
+	Setting string    `json:"setting,omitempty"`
+	Result  string    `json:"result"`
+}
+
+// DefaultAuditLimit is how many entries the audit log keeps in memory,
+// unless changed with SetAuditLimit
+const DefaultAuditLimit = 10000
+
+// AuditQuery selects entries of the audit log. Zero fields match every
+// entry.
+type AuditQuery struct {
+	// Path matches entries about it or anything below it, as source or
+	// destination
+	Path  string
+	Since time.Time
+	User  string
+}
+
+// auditLog is the audit log of a tree, guarded by its own mutex so it can
+// be read without fs.mu. Entries are added while fs.mu is held, so they
+// are in the order the changes were made.
+type auditLog struct {
+	mu      sync.Mutex
+	enabled bool
+	limit   int          // entries kept in memory
+	entries []AuditEntry // a ring once full: the oldest is at next
+	next    int
+	sink    io.Writer // entries are appended to it as JSON lines; may be nil
+	sinkErr error     // the first write to sink that failed
+}
+
+// SetAuditLog turns the audit log on or off. While it is on, every
+// operation that changes the tree (mkdir, touch, write, rm, mv, replace,
+// cp, revert, restore, empty, mount, unmount, encrypt and the xattr
+// changes), its settings (quotas, path rules and the trash) or its locks
+// (lock, unlock, and lockdir and unlockdir of encrypted directories) is
+// recorded, whoever made it and whether or not it succeeded; reads aren't.
+// The last SetAuditLimit entries are kept in memory, for AuditLog, and
+// with a sink every entry is also appended to it as JSON lines, like
+// WriteAuditLog does. Turning the log off keeps what was recorded, and
+// entries are never changed.
+func (fs *FileSystem) SetAuditLog(enabled bool, sink io.Writer) {
+	fs.audit.mu.Lock()
+	defer fs.audit.mu.Unlock()
+	fs.audit.enabled, fs.audit.sink = enabled, sink
+}
+
+// SetAuditLimit sets how many entries the audit log keeps in memory; older
+// ones are dropped, right away if there are more already. The sink still
+// gets every entry.
+func (fs *FileSystem) SetAuditLimit(n int) {
+	fs.audit.mu.Lock()
+	defer fs.audit.mu.Unlock()
+	entries := fs.audit.ordered()
+	fs.audit.limit = max(n, 0)
+	fs.audit.entries = slices.Clone(entries[max(len(entries)-fs.audit.limit, 0):])
+	fs.audit.next = 0
+}
+
+// AuditLimit returns how many entries the audit log keeps in memory
+func (fs *FileSystem) AuditLimit() int {
+	fs.audit.mu.Lock()
+	defer fs.audit.mu.Unlock()
+	return fs.audit.limit
+}
+
+// AuditLog returns the entries matching q, oldest first. The error is the
+// first one writing to the sink failed with, if any: entries are still kept
+// in memory after it.
+func (fs *FileSystem) AuditLog(q AuditQuery) ([]AuditEntry, error) {
+	fs.audit.mu.Lock()
+	defer fs.audit.mu.Unlock()
+
+	var result []AuditEntry
+	for _, e := range fs.audit.ordered() {
+		if q.matches(e) {
+			result = append(result, e)
+		}
+	}
+	return result, fs.audit.sinkErr
+}
+
+// WriteAuditLog writes entries to w as JSON lines, one object per entry
+func WriteAuditLog(w io.Writer, entries []AuditEntry) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// helper: reports whether e is selected by q
+func (q AuditQuery) matches(e AuditEntry) bool {
+	if q.User != "" && e.User != q.User {
+		return false
+	}
+	if e.Time.Before(q.Since) {
+		return false
+	}
+	if q.Path != "" && !isWithin(e.Path, q.Path) && (e.NewPath == "" || !isWithin(e.NewPath, q.Path)) {
+		return false
+	}
+	return true
+}
+
+// helper: records op on path (and newPath, for a mv or a cp), which ended
+// with err. Called deferred by the operations, while they hold fs.mu.
+func (fs *FileSystem) record(op, path, newPath string, err error) {
+	fs.add(AuditEntry{Op: op, Path: auditPath(path), NewPath: auditPath(newPath)}, err)
+}
+
+// helper: records a change of a setting of path to setting, which ended
+// with err. Callers hold fs.mu.
+func (fs *FileSystem) recordSetting(op, path, setting string, err error) {
+	fs.add(AuditEntry{Op: op, Path: auditPath(path), Setting: setting}, err)
+}
+
+// helper: records op on path, which ended with err before taking fs.mu:
+// takes it to read, so the entry still falls between the changes made
+// before and after
+func (fs *FileSystem) recordUnlocked(op, path string, err error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	fs.record(op, path, "", err)
+}
+
+// helper: adds e, made by the handle's user now, to the log
+func (fs *FileSystem) add(e AuditEntry, err error) {
+	fs.audit.mu.Lock()
+	defer fs.audit.mu.Unlock()
+	if !fs.audit.enabled {
+		return
+	}
+
+	e.Time, e.User, e.Result = time.Now(), fs.user, "ok"
+	if err != nil {
+		e.Result = err.Error()
+	}
+	switch a := &fs.audit; {
+	case len(a.entries) < a.limit:
+		a.entries = append(a.entries, e)
+	case a.limit > 0:
+		a.entries[a.next] = e
+		a.next = (a.next + 1) % a.limit
+	}
+	if fs.audit.sink != nil && fs.audit.sinkErr == nil {
+		fs.audit.sinkErr = WriteAuditLog(fs.audit.sink, []AuditEntry{e})
+	}
+}
+
+// helper: the entries kept, oldest first. Callers hold a.mu.
+func (a *auditLog) ordered() []AuditEntry {
+	return slices.Concat(a.entries[a.next:], a.entries[:a.next])
+}
+
+// helper: path as recorded, cleaned the way it was given, even if invalid
+func auditPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return cleanPath(path)
+}
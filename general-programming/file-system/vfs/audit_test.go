@@ -0,0 +1,196 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// helper: the entries as "user op path [new path] result" strings
+func auditStrings(entries []AuditEntry) []string {
+	var result []string
+	for _, e := range entries {
+		s := e.User + " " + e.Op + " " + e.Path
+		if e.NewPath != "" {
+			s += " " + e.NewPath
+		}
+		result = append(result, s+" "+e.Result)
+	}
+	return result
+}
+
+// TestAuditLog checks changes are recorded, and queries select them
+func TestAuditLog(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/before") // not recorded yet
+
+	var sink bytes.Buffer
+	fs.SetAuditLog(true, &sink)
+	bob := fs.WithUser("bob")
+	_ = fs.Mkdir("/docs")
+	_ = bob.Touch("/docs/a.txt", "hello")
+	_, _ = bob.Cat("/docs/a.txt") // reads aren't recorded
+	_ = bob.Write("/docs/a.txt", "hello again")
+	since := time.Now()
+	_ = fs.Mv("/docs/a.txt", "/b.txt")
+	_ = fs.Rm("/missing")
+
+	tests := []struct {
+		name string
+		q    AuditQuery
+		want []string
+	}{
+		{"all", AuditQuery{}, []string{
+			"root mkdir /docs ok",
+			"bob touch /docs/a.txt ok",
+			"bob write /docs/a.txt ok",
+			"root mv /docs/a.txt /b.txt ok",
+			"root rm /missing rm /missing: file does not exist",
+		}},
+		{"user", AuditQuery{User: "bob"}, []string{
+			"bob touch /docs/a.txt ok",
+			"bob write /docs/a.txt ok",
+		}},
+		{"path", AuditQuery{Path: "/b.txt"}, []string{
+			"root mv /docs/a.txt /b.txt ok",
+		}},
+		{"below path", AuditQuery{Path: "/docs"}, []string{
+			"root mkdir /docs ok",
+			"bob touch /docs/a.txt ok",
+			"bob write /docs/a.txt ok",
+			"root mv /docs/a.txt /b.txt ok",
+		}},
+		{"since", AuditQuery{Since: since}, []string{
+			"root mv /docs/a.txt /b.txt ok",
+			"root rm /missing rm /missing: file does not exist",
+		}},
+	}
+	for _, tt := range tests {
+		entries, err := fs.AuditLog(tt.q)
+		if err != nil {
+			t.Fatalf("%s: AuditLog() failed: %v", tt.name, err)
+		}
+		if got := auditStrings(entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: AuditLog() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// the sink got the same entries, as JSON lines
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("sink has %d lines, want 5", len(lines))
+	}
+	var e AuditEntry
+	if err := json.Unmarshal([]byte(lines[3]), &e); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if e.Op != "mv" || e.NewPath != "/b.txt" || e.User != "root" {
+		t.Errorf("sink line = %+v", e)
+	}
+
+	fs.SetAuditLog(false, nil)
+	_ = fs.Mkdir("/after")
+	if entries, _ := fs.AuditLog(AuditQuery{}); len(entries) != 5 {
+		t.Errorf("AuditLog() after turning it off has %d entries, want 5", len(entries))
+	}
+}
+
+// TestWriteAuditLog checks the export round-trips
+func TestWriteAuditLog(t *testing.T) {
+	entries := []AuditEntry{
+		{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), User: "root", Op: "mkdir", Path: "/a", Result: "ok"},
+		{Time: time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC), User: "bob", Op: "cp", Path: "/a", NewPath: "/b", Result: "ok"},
+	}
+	var buf bytes.Buffer
+	if err := WriteAuditLog(&buf, entries); err != nil {
+		t.Fatalf("WriteAuditLog() failed: %v", err)
+	}
+	want := `{"time":"2024-05-01T12:00:00Z","user":"root","op":"mkdir","path":"/a","result":"ok"}` + "\n" +
+		`{"time":"2024-05-01T12:00:01Z","user":"bob","op":"cp","path":"/a","new_path":"/b","result":"ok"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("WriteAuditLog() = %q, want %q", buf.String(), want)
+	}
+}
+
+// TestAuditSettings checks changes to settings and locks are recorded too
+func TestAuditSettings(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	_ = fs.Touch("/docs/a.txt", "hello")
+	fs.SetAuditLog(true, nil)
+
+	_ = fs.SetQuota("/docs", Quota{MaxBytes: 100})
+	_ = fs.WithUser("bob").SetUserQuota("bob", Quota{MaxInodes: 5})
+	fs.SetTrash(true, time.Hour)
+	_ = fs.SetPathRules(PathRules{MaxNameLength: -1})
+	l, _ := fs.TryLock("/docs/a.txt", ExclusiveLock)
+	_, _ = fs.WithUser("bob").TryLock("/docs/a.txt", SharedLock)
+	_ = l.Unlock()
+	_ = fs.LockDir("/docs")
+
+	entries, _ := fs.AuditLog(AuditQuery{})
+	want := []string{
+		"root quota /docs ok",
+		"bob userquota / ok",
+		"root trash / ok",
+		"root pathrules / invalid argument",
+		"root lock /docs/a.txt ok",
+		"bob lock /docs/a.txt lock /docs/a.txt: file is locked",
+		"root unlock /docs/a.txt ok",
+		"root lockdir /docs lock /docs: invalid path",
+	}
+	if got := auditStrings(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("AuditLog() = %q, want %q", got, want)
+	}
+	var settings []string
+	for _, e := range entries[:3] {
+		settings = append(settings, e.Setting)
+	}
+	wantSettings := []string{"bytes 100, inodes unlimited", "bob: bytes unlimited, inodes 5", "on, max age 1h0m0s"}
+	if !reflect.DeepEqual(settings, wantSettings) {
+		t.Errorf("settings = %q, want %q", settings, wantSettings)
+	}
+}
+
+// TestAuditLimit checks only the last entries are kept in memory, while
+// the sink gets them all
+func TestAuditLimit(t *testing.T) {
+	fs := NewFileSystem()
+	if fs.AuditLimit() != DefaultAuditLimit {
+		t.Errorf("AuditLimit() = %d, want %d", fs.AuditLimit(), DefaultAuditLimit)
+	}
+	var sink bytes.Buffer
+	fs.SetAuditLog(true, &sink)
+	fs.SetAuditLimit(3)
+	for _, name := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		_ = fs.Mkdir(name)
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{"wrapped", 3, []string{"root mkdir /c ok", "root mkdir /d ok", "root mkdir /e ok"}},
+		{"lowered", 2, []string{"root mkdir /d ok", "root mkdir /e ok"}},
+		{"raised", 4, []string{"root mkdir /d ok", "root mkdir /e ok"}},
+		{"none", 0, nil},
+	}
+	for _, tt := range tests {
+		fs.SetAuditLimit(tt.limit)
+		entries, _ := fs.AuditLog(AuditQuery{})
+		if got := auditStrings(entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: AuditLog() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	_ = fs.Mkdir("/f")
+	if entries, _ := fs.AuditLog(AuditQuery{}); len(entries) != 0 {
+		t.Errorf("AuditLog() with a limit of 0 has %d entries", len(entries))
+	}
+	if lines := strings.Count(sink.String(), "\n"); lines != 6 {
+		t.Errorf("sink has %d lines, want 6", lines)
+	}
+}
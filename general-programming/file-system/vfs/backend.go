@@ -0,0 +1,55 @@
+package vfs
+
+import "io"
+
+// Backend stores the tree behind a FileSystem. The FileSystem validates
+// paths, serializes access and handles everything that isn't storage
+// (users' handles, watches, quotas), so a backend only has to keep nodes.
+//
+// Paths given to a backend are always cleaned and absolute ("/a/b"), and
+// the mutating methods are never called on the root. Errors are the bare
+// sentinels from this package (ErrNotExist, ErrExist, ErrNotDir, ErrIsDir,
+// ...); the FileSystem wraps them in a *PathError. Backends that need
+// closing implement io.Closer, which FileSystem.Close calls.
+//
+// The vfstest package checks a Backend behaves as described here.
+type Backend interface {
+	// Stat describes the node at path
+	Stat(path string) (FileInfo, error)
+	// ReadDir describes the children of the directory at path, sorted by name
+	ReadDir(path string) ([]FileInfo, error)
+
+	// Mkdir creates a directory; its parent must exist
+	Mkdir(path, owner string) error
+	// Create creates a file with content; it must not exist yet
+	Create(path, content, owner string) error
+
+	// ReadFile returns the content of the file at path
+	ReadFile(path string) (string, error)
+	// Open streams the content of the file at path as of the call
+	Open(path string) (io.ReadCloser, error)
+	// WriteFile replaces the content of an existing file
+	WriteFile(path, content string) error
+
+	// Remove removes a file, or a directory and everything below it
+	Remove(path string) error
+	// Rename moves a node to newpath, which must not exist yet. Callers
+	// have already checked a directory isn't moved inside itself.
+	Rename(oldpath, newpath string) error
+}
+
+var (
+	_ Backend = (*MemoryBackend)(nil)
+	_ Backend = (*HostBackend)(nil)
+	_ Backend = (*DBBackend)(nil)
+	_ Backend = (*OverlayBackend)(nil)
+	_ Backend = (*mountTable)(nil)
+)
+
+// helper: the path of the child name in the directory dir
+func joinPath(dir, name string) string {
+	if dir == "/" {
+		return "/" + name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,102 @@
+package vfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-system/vfs"
+	"file-system/vfs/vfstest"
+)
+
+// TestBackends runs the conformance suite on every backend
+func TestBackends(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) vfs.Backend
+	}{
+		{"Memory", func(t *testing.T) vfs.Backend {
+			return vfs.NewMemoryBackend()
+		}},
+		{"Host", func(t *testing.T) vfs.Backend {
+			b, err := vfs.NewHostBackend(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}},
+		{"DB", func(t *testing.T) vfs.Backend {
+			b, err := vfs.OpenDBBackend(filepath.Join(t.TempDir(), "tree.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}},
+		{"Overlay", func(t *testing.T) vfs.Backend {
+			return vfs.NewOverlayBackend(vfs.NewMemoryBackend(), vfs.NewMemoryBackend())
+		}},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			vfstest.TestBackend(t, b.new)
+		})
+	}
+}
+
+// TestDBBackendReopen checks a database file brings the tree back, whether
+// it was closed cleanly or left with a journal and a torn last record
+func TestDBBackendReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+
+	open := func() *vfs.FileSystem {
+		t.Helper()
+		b, err := vfs.OpenDBBackend(path)
+		if err != nil {
+			t.Fatalf("OpenDBBackend() failed: %v", err)
+		}
+		return vfs.NewFileSystemWithBackend(b)
+	}
+
+	fs := open()
+	_ = fs.Mkdir("/docs")
+	_ = fs.WithUser("alice").Touch("/docs/a.txt", "first")
+	_ = fs.Touch("/docs/b.txt", "second")
+	_ = fs.SetXattr("/docs/b.txt", "type", "text/plain")
+	before, _ := fs.Stat("/docs/a.txt")
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	// journal on top of the snapshot, then a crash mid-record
+	fs = open()
+	_ = fs.Write("/docs/a.txt", "rewritten")
+	_ = fs.Mv("/docs/b.txt", "/b.txt")
+	_ = fs.SetXattr("/docs", "team", "storage")
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"op":"mkdir","path":"/tor`)
+	f.Close()
+
+	fs = open()
+	defer fs.Close()
+	if content, err := fs.Cat("/docs/a.txt"); err != nil || content != "rewritten" {
+		t.Errorf("Cat() after reopen = %q, %v", content, err)
+	}
+	if content, err := fs.Cat("/b.txt"); err != nil || content != "second" {
+		t.Errorf("Cat() of moved file = %q, %v", content, err)
+	}
+	if value, err := fs.GetXattr("/b.txt", "type"); err != nil || value != "text/plain" {
+		t.Errorf("GetXattr() from the snapshot = %q, %v", value, err)
+	}
+	if value, err := fs.GetXattr("/docs", "team"); err != nil || value != "storage" {
+		t.Errorf("GetXattr() from the journal = %q, %v", value, err)
+	}
+	if entries, _ := fs.Ls("/"); len(entries) != 2 {
+		t.Errorf("Ls(/) = %v, want [b.txt docs]", entries)
+	}
+
+	after, _ := fs.Stat("/docs/a.txt")
+	if after.Owner != "alice" || after.ModTime.Before(before.ModTime) {
+		t.Errorf("Stat() after reopen = %+v, was %+v", after, before)
+	}
+}
@@ -0,0 +1,131 @@
+package vfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// DefaultCompressionThreshold is the content size above which new blobs are
+// stored gzip compressed, unless changed with SetCompressionThreshold
+const DefaultCompressionThreshold = 64 << 10
+
+// blob is one piece of file content, stored once however many Files hold
+// it. It is immutable; writing a file points it at a different blob, so
+// readers can keep using a blob after releasing the FileSystem lock.
+type blob struct {
+	hash       string // hex sha256 of the content
+	data       []byte // the content, gzip compressed if compressed is set
+	compressed bool
+	size       int64 // logical size, i.e. len(content)
+	refs       int   // Files (and copies) pointing at this blob
+}
+
+// open returns a reader over the content, decompressing on the fly
+func (b *blob) open() (io.ReadCloser, error) {
+	if !b.compressed {
+		return io.NopCloser(bytes.NewReader(b.data)), nil
+	}
+	return gzip.NewReader(bytes.NewReader(b.data))
+}
+
+// content returns the whole content
+func (b *blob) content() (string, error) {
+	if !b.compressed {
+		return string(b.data), nil
+	}
+	r, err := b.open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	buf.Grow(int(b.size))
+	if _, err := io.Copy(&buf, r); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// blobStore is the content-addressed store behind every File. Identical
+// content is kept once and shared, and a blob is dropped as soon as
+// nothing points at it anymore. Content larger than threshold is
+// compressed when it is first stored.
+type blobStore struct {
+	blobs     map[string]*blob // by hash
+	threshold int64            // 0 disables compression
+}
+
+func newBlobStore() *blobStore {
+	return &blobStore{
+		blobs:     make(map[string]*blob),
+		threshold: DefaultCompressionThreshold,
+	}
+}
+
+// helper: the hex sha256 of content
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// put returns the blob for content, storing it if it's new, and takes a
+// reference on it
+func (s *blobStore) put(content string) *blob {
+	hash := hashContent(content)
+	b, ok := s.blobs[hash]
+	if !ok {
+		b = &blob{hash: hash, data: []byte(content), size: int64(len(content))}
+		if s.threshold > 0 && b.size > s.threshold {
+			s.compress(b)
+		}
+		s.blobs[hash] = b
+	}
+	b.refs++
+	return b
+}
+
+// helper: compresses b in place, unless that wouldn't make it smaller
+func (s *blobStore) compress(b *blob) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b.data); err != nil {
+		return
+	}
+	if err := w.Close(); err != nil {
+		return
+	}
+	if buf.Len() < len(b.data) {
+		b.data = buf.Bytes()
+		b.compressed = true
+	}
+}
+
+// retain takes another reference on b, for a copy
+func (s *blobStore) retain(b *blob) *blob {
+	b.refs++
+	return b
+}
+
+// release drops a reference on b, deleting it when it was the last one
+func (s *blobStore) release(b *blob) {
+	b.refs--
+	if b.refs <= 0 {
+		delete(s.blobs, b.hash)
+	}
+}
+
+// releaseTree drops the references held by every File below node
+func (s *blobStore) releaseTree(node Node) {
+	switch n := node.(type) {
+	case *File:
+		s.release(n.content)
+	case *Directory:
+		for _, child := range n.children {
+			s.releaseTree(child)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package vfs
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestBlobDedup checks identical content is stored once and freed when the
+// last file holding it goes away
+func TestBlobDedup(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/fixtures")
+	_ = fs.Touch("/fixtures/a.txt", "same fixture")
+	_ = fs.Touch("/fixtures/b.txt", "same fixture")
+	_ = fs.Touch("/fixtures/c.txt", "different")
+
+	if got := len(fs.backend.root.(*MemoryBackend).blobs.blobs); got != 2 {
+		t.Fatalf("stored %d blobs, want 2", got)
+	}
+
+	a, _ := fs.Stat("/fixtures/a.txt")
+	b, _ := fs.Stat("/fixtures/b.txt")
+	c, _ := fs.Stat("/fixtures/c.txt")
+	if a.Hash == "" || a.Hash != b.Hash || a.Hash == c.Hash {
+		t.Errorf("hashes a=%q b=%q c=%q", a.Hash, b.Hash, c.Hash)
+	}
+
+	// rewriting one copy leaves the other intact
+	_ = fs.Write("/fixtures/a.txt", "different")
+	if content, _ := fs.Cat("/fixtures/b.txt"); content != "same fixture" {
+		t.Errorf("Cat() = %q", content)
+	}
+	if got := len(fs.backend.root.(*MemoryBackend).blobs.blobs); got != 2 {
+		t.Errorf("stored %d blobs after Write, want 2", got)
+	}
+
+	_ = fs.Rm("/fixtures")
+	if got := len(fs.backend.root.(*MemoryBackend).blobs.blobs); got != 0 {
+		t.Errorf("stored %d blobs after Rm, want 0", got)
+	}
+}
+
+// TestCp checks copies share content, are independent afterwards and
+// report the same hash
+func TestCp(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/src")
+	_ = fs.Mkdir("/src/sub")
+	_ = fs.Touch("/src/sub/data.txt", "payload")
+
+	if err := fs.Cp("/src", "/dst"); err != nil {
+		t.Fatalf("Cp failed: %v", err)
+	}
+	if content, err := fs.Cat("/dst/sub/data.txt"); err != nil || content != "payload" {
+		t.Fatalf("Cat() of copy = %q, %v", content, err)
+	}
+	if got := len(fs.backend.root.(*MemoryBackend).blobs.blobs); got != 1 {
+		t.Errorf("stored %d blobs after Cp, want 1", got)
+	}
+
+	orig, _ := fs.Stat("/src/sub/data.txt")
+	copied, _ := fs.Stat("/dst/sub/data.txt")
+	if orig.Hash != copied.Hash {
+		t.Errorf("copy hash %q != original %q", copied.Hash, orig.Hash)
+	}
+
+	_ = fs.Write("/dst/sub/data.txt", "changed")
+	if content, _ := fs.Cat("/src/sub/data.txt"); content != "payload" {
+		t.Errorf("original changed to %q", content)
+	}
+
+	if err := fs.Cp("/src", "/src/sub/loop"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Cp() into itself error = %v, want ErrInvalidPath", err)
+	}
+	if err := fs.Cp("/src", "/dst"); !errors.Is(err, ErrExist) {
+		t.Errorf("Cp() onto existing error = %v, want ErrExist", err)
+	}
+}
+
+// stuckBackend is a MemoryBackend that can't create one file and can't
+// remove anything
+type stuckBackend struct {
+	*MemoryBackend
+	bad string
+}
+
+var errStuck = errors.New("stuck")
+
+func (b stuckBackend) Create(path, content, owner string) error {
+	if path == b.bad {
+		return errStuck
+	}
+	return b.MemoryBackend.Create(path, content, owner)
+}
+
+func (b stuckBackend) Remove(path string) error { return errStuck }
+
+// TestCpCleanupFailure checks a failed Cp reports the partial copy it
+// couldn't remove along with why it failed
+func TestCpCleanupFailure(t *testing.T) {
+	fs := NewFileSystemWithBackend(stuckBackend{NewMemoryBackend(), "/dst/b.txt"})
+	_ = fs.Mkdir("/src")
+	_ = fs.Touch("/src/a.txt", "a")
+	_ = fs.Touch("/src/b.txt", "b")
+
+	err := fs.Cp("/src", "/dst")
+	var pe *PathError
+	if !errors.As(err, &pe) || pe.Op != "cp" {
+		t.Fatalf("Cp() error = %v, want a cp PathError", err)
+	}
+	if !errors.Is(err, errStuck) {
+		t.Errorf("Cp() error = %v, want errStuck", err)
+	}
+	if joined, ok := pe.Err.(interface{ Unwrap() []error }); !ok || len(joined.Unwrap()) != 2 {
+		t.Errorf("Cp() error = %v, want the copy and cleanup errors joined", err)
+	}
+	if _, err := fs.Stat("/dst/a.txt"); err != nil {
+		t.Errorf("Stat() of what was left error = %v", err)
+	}
+}
+
+// TestCompression checks large content is stored compressed and still reads
+// back the same through Cat and Open
+func TestCompression(t *testing.T) {
+	fs := NewFileSystem()
+	fs.SetCompressionThreshold(100)
+
+	logs := strings.Repeat("GET /index.html 200\n", 500)
+	_ = fs.Touch("/big.log", logs)
+	_ = fs.Touch("/small.log", "GET / 200")
+
+	info, _ := fs.Stat("/big.log")
+	if !info.Compressed || info.Size != int64(len(logs)) || info.PhysicalSize >= info.Size {
+		t.Errorf("Stat(big) = %+v", info)
+	}
+	if info, _ := fs.Stat("/small.log"); info.Compressed || info.PhysicalSize != info.Size {
+		t.Errorf("Stat(small) = %+v", info)
+	}
+
+	if content, err := fs.Cat("/big.log"); err != nil || content != logs {
+		t.Errorf("Cat() returned %d bytes, %v", len(content), err)
+	}
+
+	r, err := fs.Open("/big.log")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	// the reader keeps working after the file is rewritten
+	_ = fs.Write("/big.log", "truncated")
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != logs {
+		t.Errorf("Open() read %d bytes, %v", len(data), err)
+	}
+
+	// content that doesn't shrink is kept as is
+	random := make([]byte, 1000)
+	_, _ = rand.Read(random)
+	_ = fs.Touch("/random.bin", string(random))
+	if info, _ := fs.Stat("/random.bin"); info.Compressed || info.PhysicalSize != 1000 {
+		t.Errorf("Stat(random) = %+v, want uncompressed", info)
+	}
+
+	// 0 turns compression off for new content
+	fs.SetCompressionThreshold(0)
+	_ = fs.Touch("/big2.log", logs+"!")
+	if info, _ := fs.Stat("/big2.log"); info.Compressed {
+		t.Errorf("Stat(big2) = %+v, want uncompressed", info)
+	}
+
+	if _, err := fs.Open("/"); !errors.Is(err, ErrIsDir) {
+		t.Errorf("Open() on directory error = %v, want ErrIsDir", err)
+	}
+}
@@ -0,0 +1,257 @@
+package vfs
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	iofs "io/fs"
+	"sort"
+	"strings"
+)
+
+// ChecksumAlgorithm is a hash Checksum and Manifest can compute
+type ChecksumAlgorithm string
+
+const (
+	SHA256 ChecksumAlgorithm = "sha256"
+	MD5    ChecksumAlgorithm = "md5"
+)
+
+// helper: a new hash for the algorithm; an unknown one is an iofs.ErrInvalid
+func (a ChecksumAlgorithm) new() (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case MD5:
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm %q: %w", a, iofs.ErrInvalid)
+}
+
+// checksum(path, algorithm): the hex digest of a file's content, as
+// sha256sum or md5sum print it
+func (fs *FileSystem) Checksum(path string, algorithm ChecksumAlgorithm) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return "", pathError("checksum", path, err)
+	}
+	if info.IsDir {
+		return "", pathError("checksum", path, ErrIsDir)
+	}
+	sum, err := fs.checksum(p, info, algorithm)
+	if err != nil {
+		return "", pathError("checksum", path, err)
+	}
+	return sum, nil
+}
+
+// helper: the digest of the file at p (described by info). The blob store
+// already knows the sha256 of what it holds, so only other backends and
+// algorithms read the content, and encrypted files, whose blobs hold the
+// sealed content.
+func (fs *FileSystem) checksum(p string, info FileInfo, algorithm ChecksumAlgorithm) (string, error) {
+	h, err := algorithm.new()
+	if err != nil {
+		return "", err
+	}
+	root, err := fs.encryptionRoot(p)
+	if err != nil {
+		return "", err
+	}
+	if algorithm == SHA256 && info.Hash != "" && root == "" {
+		return info.Hash, nil
+	}
+
+	r, err := fs.openStored(p)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Manifest records the checksum of every file in a subtree, so the subtree
+// can be checked for changes later. Its text form is the output of
+// sha256sum (or md5sum), with paths relative to the subtree:
+//
+//	2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  docs/hello.txt
+type Manifest struct {
+	Algorithm ChecksumAlgorithm
+	Entries   []ManifestEntry // sorted by path
+}
+
+type ManifestEntry struct {
+	Path string // relative to the subtree, with "/" separators
+	Sum  string // hex digest
+}
+
+// String formats the manifest as sha256sum/md5sum output
+func (m *Manifest) String() string {
+	var sb strings.Builder
+	for _, e := range m.Entries {
+		fmt.Fprintf(&sb, "%s  %s\n", e.Sum, e.Path)
+	}
+	return sb.String()
+}
+
+// ParseManifest reads a manifest in the form String writes, as produced by
+// sha256sum or md5sum run inside the subtree ("*" binary markers and "./"
+// prefixes are accepted). The algorithm is told by the digest length.
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		name = strings.TrimPrefix(name, "./")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("manifest line %d: want \"<checksum>  <path>\"", n)
+		}
+
+		var algorithm ChecksumAlgorithm
+		switch len(sum) {
+		case 2 * sha256.Size:
+			algorithm = SHA256
+		case 2 * md5.Size:
+			algorithm = MD5
+		}
+		if _, err := hex.DecodeString(sum); err != nil || algorithm == "" {
+			return nil, fmt.Errorf("manifest line %d: %q is not a sha256 or md5 checksum", n, sum)
+		}
+		if m.Algorithm != "" && m.Algorithm != algorithm {
+			return nil, fmt.Errorf("manifest line %d: mixes %s and %s checksums", n, m.Algorithm, algorithm)
+		}
+		m.Algorithm = algorithm
+		m.Entries = append(m.Entries, ManifestEntry{Path: name, Sum: strings.ToLower(sum)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.Algorithm == "" {
+		m.Algorithm = SHA256
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	return m, nil
+}
+
+// manifest(root, algorithm): the checksums of every file below root
+func (fs *FileSystem) Manifest(root string, algorithm ChecksumAlgorithm) (*Manifest, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if _, err := algorithm.new(); err != nil {
+		return nil, pathError("manifest", root, err)
+	}
+	files, err := fs.subtreeFiles(root)
+	if err != nil {
+		return nil, pathError("manifest", root, err)
+	}
+
+	m := &Manifest{Algorithm: algorithm}
+	for _, f := range files {
+		sum, err := fs.checksum(f.path, f.info, algorithm)
+		if err != nil {
+			return nil, pathError("manifest", f.path, err)
+		}
+		m.Entries = append(m.Entries, ManifestEntry{Path: f.rel, Sum: sum})
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	return m, nil
+}
+
+// verify(root, manifest): how the files below root drifted from manifest.
+// A file missing from the tree is Removed, a file the manifest doesn't list
+// is Added, and a file whose checksum differs (or that is now a directory)
+// is Changed. No changes means the subtree matches.
+func (fs *FileSystem) Verify(root string, m *Manifest) ([]Change, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if _, err := m.Algorithm.new(); err != nil {
+		return nil, pathError("verify", root, err)
+	}
+	p, err := fs.checkPath(root)
+	if err != nil {
+		return nil, pathError("verify", root, err)
+	}
+	files, err := fs.subtreeFiles(p)
+	if err != nil {
+		return nil, pathError("verify", root, err)
+	}
+
+	sums := make(map[string]string, len(m.Entries))
+	for _, e := range m.Entries {
+		sums[e.Path] = e.Sum
+	}
+
+	var changes []Change
+	for _, f := range files {
+		want, listed := sums[f.rel]
+		if !listed {
+			changes = append(changes, Change{Kind: Added, Path: f.rel})
+			continue
+		}
+		delete(sums, f.rel)
+		sum, err := fs.checksum(f.path, f.info, m.Algorithm)
+		if err != nil {
+			return nil, pathError("verify", f.path, err)
+		}
+		if sum != want {
+			changes = append(changes, Change{Kind: Changed, Path: f.rel})
+		}
+	}
+
+	// what's left isn't a file any more: gone, or replaced by a directory
+	for rel := range sums {
+		info, err := fs.backend.Stat(joinPath(p, rel))
+		if err == nil && info.IsDir {
+			changes = append(changes, Change{Kind: Changed, Path: rel, IsDir: true})
+		} else {
+			changes = append(changes, Change{Kind: Removed, Path: rel})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// subtreeFile is a file found below a root by subtreeFiles
+type subtreeFile struct {
+	path, rel string
+	info      FileInfo
+}
+
+// helper: the files below root, with their paths relative to it
+func (fs *FileSystem) subtreeFiles(root string) ([]subtreeFile, error) {
+	p, info, err := fs.lookup(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir {
+		return nil, ErrNotDir
+	}
+
+	var files []subtreeFile
+	err = fs.walk(p, info, func(path string, info FileInfo) error {
+		if !info.IsDir {
+			rel := strings.TrimPrefix(strings.TrimPrefix(path, p), "/")
+			files = append(files, subtreeFile{path: path, rel: rel, info: info})
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,111 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestChecksum checks digests against the known values for "hello"
+func TestChecksum(t *testing.T) {
+	host, err := NewHostBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/host")
+	_ = fs.Mount("/host", host)
+	_ = fs.Touch("/hello.txt", "hello")
+	_ = fs.Touch("/host/hello.txt", "hello")
+
+	tests := []struct {
+		path      string
+		algorithm ChecksumAlgorithm
+		want      string
+	}{
+		{"/hello.txt", SHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"/hello.txt", MD5, "5d41402abc4b2a76b9719d911017c592"},
+		// the host backend has no stored hash, so the content is read
+		{"/host/hello.txt", SHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	for _, tt := range tests {
+		if got, err := fs.Checksum(tt.path, tt.algorithm); err != nil || got != tt.want {
+			t.Errorf("Checksum(%s, %s) = %q, %v, want %q", tt.path, tt.algorithm, got, err, tt.want)
+		}
+	}
+
+	if _, err := fs.Checksum("/host", SHA256); !errors.Is(err, ErrIsDir) {
+		t.Errorf("Checksum(dir) error = %v, want ErrIsDir", err)
+	}
+	if _, err := fs.Checksum("/hello.txt", "crc32"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("Checksum() with unknown algorithm error = %v, want ErrInvalid", err)
+	}
+}
+
+// TestManifest checks a manifest survives its text form and reports drift
+func TestManifest(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/fixture")
+	_ = fs.Mkdir("/fixture/sub")
+	_ = fs.Touch("/fixture/a.txt", "a")
+	_ = fs.Touch("/fixture/sub/b.txt", "b")
+	_ = fs.Touch("/fixture/sub/c.txt", "c")
+
+	m, err := fs.Manifest("/fixture", MD5)
+	if err != nil {
+		t.Fatalf("Manifest() failed: %v", err)
+	}
+	want := "0cc175b9c0f1b6a831c399e269772661  a.txt\n" +
+		"92eb5ffee6ae2fec3ad71c777531578f  sub/b.txt\n" +
+		"4a8a08f09d37b73795649038408b5f33  sub/c.txt\n"
+	if m.String() != want {
+		t.Errorf("Manifest() = %q, want %q", m.String(), want)
+	}
+
+	parsed, err := ParseManifest(strings.NewReader(m.String()))
+	if err != nil || !reflect.DeepEqual(parsed, m) {
+		t.Fatalf("ParseManifest() = %+v, %v, want %+v", parsed, err, m)
+	}
+	if changes, err := fs.Verify("/fixture", parsed); err != nil || len(changes) != 0 {
+		t.Errorf("Verify() of untouched tree = %v, %v", changes, err)
+	}
+
+	// drift: one of each kind
+	_ = fs.Write("/fixture/a.txt", "changed")
+	_ = fs.Rm("/fixture/sub/b.txt")
+	_ = fs.Rm("/fixture/sub/c.txt")
+	_ = fs.Mkdir("/fixture/sub/c.txt")
+	_ = fs.Touch("/fixture/new.txt", "")
+	wantChanges := []Change{
+		{Kind: Changed, Path: "a.txt"},
+		{Kind: Added, Path: "new.txt"},
+		{Kind: Removed, Path: "sub/b.txt"},
+		{Kind: Changed, Path: "sub/c.txt", IsDir: true},
+	}
+	if changes, err := fs.Verify("/fixture", parsed); err != nil || !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("Verify() = %v, %v, want %v", changes, err, wantChanges)
+	}
+}
+
+// TestParseManifest checks the sha256sum variants accepted and the errors
+func TestParseManifest(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	m, err := ParseManifest(strings.NewReader(sum + " *./bin/tool\n\n" + sum + "  a b.txt\n"))
+	want := &Manifest{Algorithm: SHA256, Entries: []ManifestEntry{{"a b.txt", sum}, {"bin/tool", sum}}}
+	if err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseManifest() = %+v, %v, want %+v", m, err, want)
+	}
+
+	bad := []string{
+		"no-separator\n",
+		"xyz  file.txt\n",
+		sum + "  a.txt\n" + strings.Repeat("ab", 16) + "  b.txt\n",
+	}
+	for _, input := range bad {
+		if _, err := ParseManifest(strings.NewReader(input)); err == nil {
+			t.Errorf("ParseManifest(%q) succeeded", input)
+		}
+	}
+}
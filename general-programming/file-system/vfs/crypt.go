@@ -0,0 +1,603 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// kdfIterations is how many PBKDF2-SHA256 rounds derive a key from a
+// passphrase, for new keys; existing ones record their own count
+var kdfIterations = 600_000
+
+// keyParams are what's needed, besides the passphrase, to derive a key and
+// check it is the right one. They are stored in the clear, next to what
+// the key encrypts.
+type keyParams struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Check      []byte `json:"check"` // checkText, sealed with the key
+}
+
+const checkText = "vfs key check"
+
+// helper: a new random key derived from passphrase, with its params
+func newKey(passphrase string) (cipher.AEAD, keyParams, error) {
+	kp := keyParams{Salt: make([]byte, 16), Iterations: kdfIterations}
+	if _, err := rand.Read(kp.Salt); err != nil {
+		return nil, keyParams{}, err
+	}
+	aead, err := deriveKey(passphrase, kp)
+	if err != nil {
+		return nil, keyParams{}, err
+	}
+	if kp.Check, err = seal(aead, []byte(checkText), nil); err != nil {
+		return nil, keyParams{}, err
+	}
+	return aead, kp, nil
+}
+
+// helper: the key passphrase derives with kp, failing with
+// ErrBadPassphrase unless it is the one kp was made with
+func openKey(passphrase string, kp keyParams) (cipher.AEAD, error) {
+	aead, err := deriveKey(passphrase, kp)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := unseal(aead, kp.Check, nil); err != nil || string(check) != checkText {
+		return nil, ErrBadPassphrase
+	}
+	return aead, nil
+}
+
+// helper: AES-256-GCM with the key PBKDF2 derives from passphrase
+func deriveKey(passphrase string, kp keyParams) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, kp.Salt, kp.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// helper: encrypts and authenticates plaintext, along with the additional
+// data ad, under a random nonce it puts first
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// helper: the plaintext seal made data from, failing if data was changed
+func unseal(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("message too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, ad)
+}
+
+// Encrypted directories keep their key params in this attribute, and the
+// files below them start with sealedMagic, followed by their sealed content.
+// The marker only means anything below an encrypted directory: elsewhere,
+// content is plaintext whatever it starts with.
+const (
+	encryptionXattr = "vfs.encryption"
+	sealedMagic     = "\x00vfs-sealed\x00"
+)
+
+// EncryptedDir is an encrypted directory, as reported by EncryptedDirs
+type EncryptedDir struct {
+	Path     string
+	Unlocked bool
+}
+
+// EncryptDir encrypts the directory at path, and every file below it, with
+// a key derived from passphrase, and leaves it unlocked. The content of the
+// files is stored encrypted and authenticated (AES-256-GCM, with a
+// PBKDF2-SHA256 key), so it is never in the clear in the backend or on
+// disk; names, sizes, owners and times are. Files created below it later
+// are encrypted too.
+//
+// While the directory is locked (see UnlockDir and LockDir), reading and
+// writing its files fails with ErrEncrypted, while listing, stat, removing
+// and moving them within the directory still work. Nodes can't be moved or
+// copied in or out of it (or restored from the trash across it), encrypted
+// directories can't be nested, and the files below it have no version
+// history and aren't searched. Checksums and diffs read them like Cat.
+//
+// The key params are kept in an extended attribute of the directory, so
+// the backend must support them; the keys themselves are only kept in
+// memory, with the FileSystem, so encrypted directories start out locked.
+// A backend that keeps what files held before, like DBBackend's journal,
+// is compacted once the files are sealed, so their plaintext is gone from
+// disk too; if that fails, the directory is left unencrypted.
+func (fs *FileSystem) EncryptDir(path, passphrase string) (err error) {
+	if passphrase == "" {
+		err := pathError("encrypt", path, iofs.ErrInvalid)
+		fs.recordUnlocked("encrypt", path, err)
+		return err
+	}
+	// deriving the key is slow on purpose, so the tree isn't held for it
+	aead, kp, err := newKey(passphrase)
+	if err != nil {
+		err = pathError("encrypt", path, err)
+		fs.recordUnlocked("encrypt", path, err)
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("encrypt", path, "", err) }()
+
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return pathError("encrypt", path, err)
+	}
+	if !info.IsDir {
+		return pathError("encrypt", path, ErrNotDir)
+	}
+	root, err := fs.encryptionRoot(p)
+	if err != nil {
+		return pathError("encrypt", path, err)
+	}
+	nested, err := fs.hasEncryptedBelow(p, info)
+	if err != nil {
+		return pathError("encrypt", path, err)
+	}
+	if root != "" || nested {
+		return pathError("encrypt", path, ErrExist)
+	}
+
+	params, err := json.Marshal(kp)
+	if err != nil {
+		return pathError("encrypt", path, err)
+	}
+	// mark it first, so an attribute the backend can't store leaves the
+	// files alone
+	if err := fs.backend.SetXattr(p, encryptionXattr, string(params)); err != nil {
+		return pathError("encrypt", path, err)
+	}
+	fs.dirKeys[p] = aead
+	fs.setEncrypted(p, true)
+
+	// every file is sealed, whatever it holds, so nothing below the
+	// directory is plaintext
+	var sealed []sealedFile
+	err = fs.walk(p, info, func(file string, info FileInfo) error {
+		if info.IsDir {
+			return nil
+		}
+		content, err := fs.backend.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		stored, err := sealContent(aead, content)
+		if err != nil {
+			return err
+		}
+		if err := fs.backend.WriteFile(file, stored); err != nil {
+			return err
+		}
+		sealed = append(sealed, sealedFile{file, info.Owner, content, int64(len(stored) - len(content))})
+		return nil
+	})
+	if err == nil {
+		err = fs.backend.compact(p)
+	}
+	if err != nil {
+		fs.unsealAll(p, sealed)
+		return pathError("encrypt", path, err)
+	}
+
+	fs.dropVersions(p)
+	for _, f := range sealed {
+		fs.chargeQuota(f.path, f.owner, Usage{Bytes: f.growth})
+		fs.notify(Event{Op: Modify, Path: f.path})
+	}
+	return nil
+}
+
+// compacter is a Backend keeping a history of changes, like DBBackend's
+// journal, that Compact folds into the current state
+type compacter interface {
+	Compact() error
+}
+
+// sealedFile is a file EncryptDir sealed, and what it held before
+type sealedFile struct {
+	path    string
+	owner   string
+	content string
+	growth  int64 // bytes sealing added
+}
+
+// helper: undoes a failed EncryptDir of the directory at p, putting back
+// the content of the files it sealed and leaving it unencrypted. This is
+// best effort: the backend just failed once.
+func (fs *FileSystem) unsealAll(p string, sealed []sealedFile) {
+	for _, f := range sealed {
+		fs.backend.WriteFile(f.path, f.content)
+	}
+	fs.backend.RemoveXattr(p, encryptionXattr)
+	delete(fs.dirKeys, p)
+	fs.setEncrypted(p, false)
+}
+
+// UnlockDir unlocks the encrypted directory at path, if passphrase is the
+// one it was encrypted with, so the files below it can be read and written
+// through every handle on the tree until LockDir
+func (fs *FileSystem) UnlockDir(path, passphrase string) (err error) {
+	fs.mu.RLock()
+	p, kp, err := fs.encryptedDir(path)
+	fs.mu.RUnlock()
+	if err != nil {
+		err = pathError("unlock", path, err)
+		fs.recordUnlocked("unlockdir", path, err)
+		return err
+	}
+
+	// deriving the key is slow on purpose, so the tree isn't held for it
+	aead, err := openKey(passphrase, kp)
+	if err != nil {
+		err = pathError("unlock", path, err)
+		fs.recordUnlocked("unlockdir", path, err)
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("unlockdir", path, "", err) }()
+	// the directory may have been moved or replaced meanwhile
+	if _, current, err := fs.encryptedDir(p); err != nil || !bytes.Equal(current.Salt, kp.Salt) {
+		return pathError("unlock", path, ErrNotExist)
+	}
+	fs.dirKeys[p] = aead
+	return nil
+}
+
+// LockDir locks the encrypted directory at path again, forgetting its key
+func (fs *FileSystem) LockDir(path string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("lockdir", path, "", err) }()
+
+	p, _, err := fs.encryptedDir(path)
+	if err != nil {
+		return pathError("lock", path, err)
+	}
+	delete(fs.dirKeys, p)
+	return nil
+}
+
+// EncryptedDirs lists the encrypted directories in the tree, sorted
+func (fs *FileSystem) EncryptedDirs() ([]EncryptedDir, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	info, err := fs.backend.Stat("/")
+	if err != nil {
+		return nil, err
+	}
+	var result []EncryptedDir
+	err = fs.walk("/", info, func(p string, info FileInfo) error {
+		if !info.IsDir {
+			return nil
+		}
+		if _, ok, err := fs.keyParams(p); err != nil || !ok {
+			return err
+		}
+		_, unlocked := fs.dirKeys[p]
+		result = append(result, EncryptedDir{Path: p, Unlocked: unlocked})
+		return nil
+	})
+	slices.SortFunc(result, func(a, b EncryptedDir) int { return strings.Compare(a.Path, b.Path) })
+	return result, err
+}
+
+// helper: the path and key params of the encrypted directory at path,
+// failing with ErrInvalidPath if it isn't one
+func (fs *FileSystem) encryptedDir(path string) (string, keyParams, error) {
+	p, _, err := fs.lookup(path)
+	if err != nil {
+		return "", keyParams{}, err
+	}
+	kp, ok, err := fs.keyParams(p)
+	if err != nil {
+		return "", keyParams{}, err
+	}
+	if !ok {
+		return "", keyParams{}, ErrInvalidPath
+	}
+	return p, kp, nil
+}
+
+// helper: the key params of the node at p, if it is an encrypted directory
+func (fs *FileSystem) keyParams(p string) (keyParams, bool, error) {
+	xattrs, err := fs.backend.Xattrs(p)
+	if errors.Is(err, ErrUnsupported) {
+		return keyParams{}, false, nil
+	}
+	if err != nil {
+		return keyParams{}, false, err
+	}
+	params, ok := xattrs[encryptionXattr]
+	if !ok {
+		return keyParams{}, false, nil
+	}
+	var kp keyParams
+	if err := json.Unmarshal([]byte(params), &kp); err != nil {
+		return keyParams{}, false, err
+	}
+	return kp, true, nil
+}
+
+// encryptedDirs is the set of encrypted directories in the tree, so
+// finding the one a path is below doesn't read the attributes of every
+// directory above it. It is filled from the backends by the first lookup,
+// and kept up to date by the operations that add, move or drop encrypted
+// directories, or uncover them (mounts, restores and copies). Lookups fill
+// it under the FileSystem's read lock, so it has a lock of its own.
+type encryptedDirs struct {
+	mu    sync.Mutex
+	known bool            // dirs was filled
+	dirs  map[string]bool // by cleaned path
+}
+
+// helper: the encrypted directory p is, or is below ("" if none). p
+// doesn't need to exist.
+func (fs *FileSystem) encryptionRoot(p string) (string, error) {
+	e := &fs.encrypted
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.known {
+		e.dirs = make(map[string]bool)
+		if err := fs.findEncrypted("/", e.dirs); err != nil {
+			return "", err
+		}
+		e.known = true
+	}
+	if len(e.dirs) == 0 {
+		return "", nil
+	}
+	for dir := cleanPath(p); ; dir, _ = splitPath(dir) {
+		if e.dirs[dir] {
+			return dir, nil
+		}
+		if isRoot(dir) {
+			return "", nil
+		}
+	}
+}
+
+// helper: adds the encrypted directories at or below p to dirs
+func (fs *FileSystem) findEncrypted(p string, dirs map[string]bool) error {
+	info, err := fs.backend.Stat(p)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fs.walk(p, info, func(dir string, info FileInfo) error {
+		if !info.IsDir {
+			return nil
+		}
+		_, ok, err := fs.keyParams(dir)
+		if ok {
+			dirs[dir] = true
+		}
+		return err
+	})
+}
+
+// helper: finds the encrypted directories at or below p again, after
+// something else than an encrypted directory's own operations put nodes
+// there. Callers hold fs.mu exclusively.
+func (fs *FileSystem) rescanEncrypted(p string) {
+	e := &fs.encrypted
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.known {
+		return
+	}
+	for dir := range e.dirs {
+		if isWithin(dir, p) {
+			delete(e.dirs, dir)
+		}
+	}
+	if fs.findEncrypted(p, e.dirs) != nil {
+		// the next lookup starts over
+		e.known = false
+	}
+}
+
+// helper: records whether p is an encrypted directory. Callers hold fs.mu
+// exclusively.
+func (fs *FileSystem) setEncrypted(p string, encrypted bool) {
+	e := &fs.encrypted
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.known {
+		return
+	}
+	if encrypted {
+		e.dirs[p] = true
+	} else {
+		delete(e.dirs, p)
+	}
+}
+
+// helper: reports whether there is an encrypted directory below the one at
+// p (described by info)
+func (fs *FileSystem) hasEncryptedBelow(p string, info FileInfo) (bool, error) {
+	found := false
+	err := fs.walk(p, info, func(dir string, info FileInfo) error {
+		if !info.IsDir || dir == p || found {
+			return nil
+		}
+		_, ok, err := fs.keyParams(dir)
+		found = ok
+		return err
+	})
+	return found, err
+}
+
+// helper: the key of the encrypted directory p is below, if any: nil and
+// ErrEncrypted while it is locked
+func (fs *FileSystem) fileKey(p string) (cipher.AEAD, error) {
+	root, err := fs.encryptionRoot(p)
+	if err != nil || root == "" {
+		return nil, err
+	}
+	aead, ok := fs.dirKeys[root]
+	if !ok {
+		return nil, ErrEncrypted
+	}
+	return aead, nil
+}
+
+// helper: checks a node can be moved or copied from src to dst, which
+// must be below the same encrypted directory, if any
+func (fs *FileSystem) checkCrossEncryption(src, dst string) error {
+	srcRoot, err := fs.encryptionRoot(path.Dir(src))
+	if err != nil {
+		return err
+	}
+	dstRoot, err := fs.encryptionRoot(path.Dir(dst))
+	if err != nil {
+		return err
+	}
+	if srcRoot != dstRoot {
+		return ErrEncrypted
+	}
+	return nil
+}
+
+// helper: content as stored with aead
+func sealContent(aead cipher.AEAD, content string) (string, error) {
+	sealed, err := seal(aead, []byte(content), nil)
+	if err != nil {
+		return "", err
+	}
+	return sealedMagic + string(sealed), nil
+}
+
+// helper: the content to store for the file at p: sealed if it is below an
+// encrypted directory, which must be unlocked. sealed reports which.
+func (fs *FileSystem) storedContent(p, content string) (stored string, sealed bool, err error) {
+	aead, err := fs.fileKey(p)
+	if err != nil || aead == nil {
+		return content, false, err
+	}
+	stored, err = sealContent(aead, content)
+	return stored, true, err
+}
+
+// helper: the content of the file at p, stored as stored. Below an
+// encrypted directory, content without the marker (e.g. on a backend
+// mounted there) is plaintext, but only readable while it is unlocked.
+func (fs *FileSystem) openContent(p, stored string) (string, error) {
+	aead, err := fs.fileKey(p)
+	if err != nil {
+		return "", err
+	}
+	if aead == nil || !strings.HasPrefix(stored, sealedMagic) {
+		return stored, nil
+	}
+	content, err := unseal(aead, []byte(stored[len(sealedMagic):]), nil)
+	if err != nil {
+		return "", ErrEncrypted
+	}
+	return string(content), nil
+}
+
+// helper: the content of the file at p, decrypted like openContent
+func (fs *FileSystem) readContent(p string) (string, error) {
+	stored, err := fs.backend.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	return fs.openContent(p, stored)
+}
+
+// helper: a reader of the content of the file at p, decrypting it if it is
+// below an encrypted directory
+func (fs *FileSystem) openStored(p string) (io.ReadCloser, error) {
+	root, err := fs.encryptionRoot(p)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" {
+		return fs.backend.Open(p)
+	}
+	content, err := fs.readContent(p)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+// helper: moves the keys of unlocked directories at or below src to dst,
+// and the encrypted directories with them
+func (fs *FileSystem) moveDirKeys(src, dst string) {
+	moved := make(map[string]cipher.AEAD)
+	for p, aead := range fs.dirKeys {
+		if isWithin(p, src) {
+			delete(fs.dirKeys, p)
+			moved[dst+strings.TrimPrefix(p, src)] = aead
+		}
+	}
+	for p, aead := range moved {
+		fs.dirKeys[p] = aead
+	}
+
+	e := &fs.encrypted
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var dirs []string
+	for p := range e.dirs {
+		if isWithin(p, src) {
+			delete(e.dirs, p)
+			dirs = append(dirs, dst+strings.TrimPrefix(p, src))
+		}
+	}
+	for _, p := range dirs {
+		e.dirs[p] = true
+	}
+}
+
+// helper: forgets the keys of directories at or below path, which are
+// gone, and that they were encrypted
+func (fs *FileSystem) dropDirKeys(path string) {
+	for p := range fs.dirKeys {
+		if isWithin(p, path) {
+			delete(fs.dirKeys, p)
+		}
+	}
+
+	e := &fs.encrypted
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for p := range e.dirs {
+		if isWithin(p, path) {
+			delete(e.dirs, p)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// helper: makes keys quick to derive for the rest of the test
+func fastKeys(t *testing.T) {
+	saved := kdfIterations
+	kdfIterations = 1000
+	t.Cleanup(func() { kdfIterations = saved })
+}
+
+// TestEncryptedDB checks an encrypted database file holds no plaintext,
+// reopens with its passphrase only, and detects tampering
+func TestEncryptedDB(t *testing.T) {
+	fastKeys(t)
+	path := filepath.Join(t.TempDir(), "tree.db")
+
+	b, err := OpenEncryptedDBBackend(path, "s3cret")
+	if err != nil {
+		t.Fatalf("OpenEncryptedDBBackend() failed: %v", err)
+	}
+	fs := NewFileSystemWithBackend(b)
+	_ = fs.Mkdir("/fixtures")
+	_ = fs.Touch("/fixtures/users.csv", "alice,admin")
+	_ = fs.Close()
+
+	// journal on top of the snapshot
+	b, _ = OpenEncryptedDBBackend(path, "s3cret")
+	fs = NewFileSystemWithBackend(b)
+	_ = fs.Write("/fixtures/users.csv", "bob,guest")
+	b.file.Sync()
+
+	data, _ := os.ReadFile(path)
+	for _, plain := range []string{"fixtures", "alice", "bob"} {
+		if strings.Contains(string(data), plain) {
+			t.Errorf("file contains %q in the clear", plain)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		want       error
+	}{
+		{"wrong passphrase", "guess", ErrBadPassphrase},
+		{"no passphrase", "", nil},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.passphrase == "" {
+			_, err = OpenDBBackend(path)
+		} else {
+			_, err = OpenEncryptedDBBackend(path, tt.passphrase)
+		}
+		if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: open error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	b, err = OpenEncryptedDBBackend(path, "s3cret")
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	fs2 := NewFileSystemWithBackend(b)
+	if content, err := fs2.Cat("/fixtures/users.csv"); err != nil || content != "bob,guest" {
+		t.Errorf("Cat() after reopen = %q, %v", content, err)
+	}
+	b.file.Close()
+
+	// swapping two records breaks their numbering
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[1], lines[2] = lines[2], lines[1]
+	_ = os.WriteFile(path, []byte(strings.Join(lines, "")), 0o600)
+	if _, err := OpenEncryptedDBBackend(path, "s3cret"); err == nil {
+		t.Error("open of reordered file succeeded")
+	}
+}
+
+// TestEncryptDir checks files below an encrypted directory are stored
+// sealed and can only be used while it is unlocked
+func TestEncryptDir(t *testing.T) {
+	fastKeys(t)
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/secret")
+	_ = fs.Touch("/secret/key.pem", "PRIVATE")
+	_ = fs.Touch("/plain.txt", "public")
+
+	if err := fs.EncryptDir("/secret", "pw"); err != nil {
+		t.Fatalf("EncryptDir() failed: %v", err)
+	}
+	if stored, _ := fs.backend.ReadFile("/secret/key.pem"); strings.Contains(stored, "PRIVATE") {
+		t.Errorf("stored content is in the clear: %q", stored)
+	}
+	_ = fs.Touch("/secret/new.txt", "also secret")
+	if content, err := fs.Cat("/secret/new.txt"); err != nil || content != "also secret" {
+		t.Errorf("Cat() while unlocked = %q, %v", content, err)
+	}
+
+	_ = fs.LockDir("/secret")
+	steps := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"cat", second(fs.Cat("/secret/key.pem")), ErrEncrypted},
+		{"checksum", second(fs.Checksum("/secret/key.pem", SHA256)), ErrEncrypted},
+		{"diff", second(fs.UnifiedDiff("/plain.txt", "/secret/key.pem")), ErrEncrypted},
+		{"write", fs.Write("/secret/key.pem", "x"), ErrEncrypted},
+		{"touch", fs.Touch("/secret/other", "x"), ErrEncrypted},
+		{"mv out", fs.Mv("/secret/key.pem", "/key.pem"), ErrEncrypted},
+		{"cp in", fs.Cp("/plain.txt", "/secret/plain.txt"), ErrEncrypted},
+		{"mv within", fs.Mv("/secret/new.txt", "/secret/renamed.txt"), nil},
+		{"nested", fs.EncryptDir("/", "pw"), ErrExist},
+		{"wrong passphrase", fs.UnlockDir("/secret", "nope"), ErrBadPassphrase},
+		{"wrong passphrase is permission", fs.UnlockDir("/secret", "nope"), iofs.ErrPermission},
+		{"not encrypted", fs.UnlockDir("/", "pw"), ErrInvalidPath},
+		{"reserved xattr", fs.RemoveXattr("/secret", encryptionXattr), ErrPermission},
+		{"unlock", fs.UnlockDir("/secret", "pw"), nil},
+		{"cat again", second(fs.Cat("/secret/renamed.txt")), nil},
+	}
+	for _, s := range steps {
+		if !errors.Is(s.err, s.want) || (s.want == nil && s.err != nil) {
+			t.Errorf("%s: error = %v, want %v", s.name, s.err, s.want)
+		}
+	}
+
+	// moving the directory itself keeps it unlocked
+	if err := fs.Mv("/secret", "/vault"); err != nil {
+		t.Fatalf("Mv() failed: %v", err)
+	}
+	if content, err := fs.Cat("/vault/key.pem"); err != nil || content != "PRIVATE" {
+		t.Errorf("Cat() after Mv = %q, %v", content, err)
+	}
+	if dirs, _ := fs.EncryptedDirs(); len(dirs) != 1 || dirs[0] != (EncryptedDir{Path: "/vault", Unlocked: true}) {
+		t.Errorf("EncryptedDirs() = %v", dirs)
+	}
+	if results, _ := fs.Search("/", "PRIVATE"); len(results) != 0 {
+		t.Errorf("Search() found encrypted content: %v", results)
+	}
+}
+
+// TestEncryptDirDB checks no plaintext of the sealed files is left in a db
+// file's journal
+func TestEncryptDirDB(t *testing.T) {
+	fastKeys(t)
+	path := filepath.Join(t.TempDir(), "tree.db")
+	db, err := OpenDBBackend(path)
+	if err != nil {
+		t.Fatalf("OpenDBBackend() failed: %v", err)
+	}
+	fs := NewFileSystemWithBackend(db)
+	defer fs.Close()
+	_ = fs.Mkdir("/secret")
+	_ = fs.Touch("/secret/pw.txt", "TOPSECRETPLAINTEXT")
+	_ = fs.Write("/secret/pw.txt", "TOPSECRETPLAINTEXT2")
+	_ = fs.Touch("/plain.txt", "public")
+
+	if err := fs.EncryptDir("/secret", "pw"); err != nil {
+		t.Fatalf("EncryptDir() failed: %v", err)
+	}
+	_ = fs.Touch("/secret/new.txt", "NEWSECRETPLAINTEXT")
+	_ = fs.LockDir("/secret")
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	for _, secret := range []string{"TOPSECRETPLAINTEXT", "NEWSECRETPLAINTEXT"} {
+		// content is base64 in the file's JSON
+		if bytes.Contains(raw, []byte(secret)) || bytes.Contains(raw, []byte(base64.StdEncoding.EncodeToString([]byte(secret))[:20])) {
+			t.Errorf("db file holds %s in the clear", secret)
+		}
+	}
+	if !bytes.Contains(raw, []byte(base64.StdEncoding.EncodeToString([]byte("public")))) {
+		t.Error("db file lost the unencrypted file")
+	}
+}
+
+// TestEncryptedDirsFound checks encrypted directories are known wherever
+// they come from: a backend's own, a mount, a copy or the trash
+func TestEncryptedDirsFound(t *testing.T) {
+	fastKeys(t)
+	m := NewMemoryBackend()
+	other := NewFileSystemWithBackend(m)
+	_ = other.Mkdir("/vault")
+	_ = other.EncryptDir("/vault", "pw")
+	_ = other.Touch("/vault/f", "secret")
+
+	// a tree opened on the backend finds it
+	if _, err := NewFileSystemWithBackend(m).Cat("/vault/f"); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Cat() on the backend error = %v, want ErrEncrypted", err)
+	}
+
+	fs := NewFileSystem()
+	fs.SetTrash(true, 0)
+	_ = fs.Mkdir("/mnt")
+	_ = fs.Touch("/plain.txt", "public")
+	_, _ = fs.Cat("/plain.txt") // nothing encrypted yet
+
+	steps := []struct {
+		name string
+		path string
+		want error
+	}{
+		{"mounted", "/mnt/vault/f", ErrEncrypted},
+		{"copied", "/copy/f", ErrEncrypted},
+		{"moved", "/moved/f", ErrEncrypted},
+		{"restored", "/moved/f", ErrEncrypted},
+		{"unmounted", "/mnt/vault/f", ErrNotExist},
+		{"removed", "/moved/f", ErrNotExist},
+	}
+	for _, step := range steps {
+		var err error
+		switch step.name {
+		case "mounted":
+			err = fs.Mount("/mnt", m)
+		case "copied":
+			err = fs.Cp("/mnt/vault", "/copy")
+		case "moved":
+			err = fs.Mv("/copy", "/moved")
+		case "restored":
+			if err = fs.Rm("/moved"); err == nil {
+				entries, _ := fs.ListTrash()
+				err = fs.Restore(entries[0].ID, "")
+			}
+		case "unmounted":
+			err = fs.Unmount("/mnt")
+		case "removed":
+			err = fs.Rm("/moved")
+		}
+		if err != nil {
+			t.Fatalf("%s: failed: %v", step.name, err)
+		}
+		if _, err := fs.Cat(step.path); !errors.Is(err, step.want) {
+			t.Errorf("%s: Cat(%s) error = %v, want %v", step.name, step.path, err, step.want)
+		}
+	}
+	if content, err := fs.Cat("/plain.txt"); err != nil || content != "public" {
+		t.Errorf("Cat(/plain.txt) = %q, %v", content, err)
+	}
+}
+
+// helper: the error of a two-value call
+func second[T any](_ T, err error) error {
+	return err
+}
+
+// TestSealedMarker checks the sealed marker only counts below an encrypted
+// directory, and nothing crosses its boundary through the trash
+func TestSealedMarker(t *testing.T) {
+	fastKeys(t)
+	fs := NewFileSystem()
+	fs.SetTrash(true, 0)
+	lookalike := sealedMagic + "hello"
+	_ = fs.Touch("/m.txt", lookalike)
+	_ = fs.Mkdir("/secret")
+	_ = fs.Touch("/secret/m.txt", lookalike)
+	_ = fs.Touch("/plain.txt", "PLAINTEXT")
+
+	if content, err := fs.Cat("/m.txt"); err != nil || content != lookalike {
+		t.Errorf("Cat() outside = %q, %v", content, err)
+	}
+	if err := fs.EncryptDir("/secret", "pw"); err != nil {
+		t.Fatalf("EncryptDir() failed: %v", err)
+	}
+	if stored, _ := fs.backend.ReadFile("/secret/m.txt"); strings.Contains(stored, "hello") {
+		t.Errorf("EncryptDir() left %q in the clear", stored)
+	}
+	if content, err := fs.Cat("/secret/m.txt"); err != nil || content != lookalike {
+		t.Errorf("Cat() inside = %q, %v", content, err)
+	}
+
+	// restoring across the boundary, either way, fails
+	_ = fs.Rm("/plain.txt")
+	_ = fs.Rm("/secret/m.txt")
+	trashed, _ := fs.ListTrash()
+	ids := make(map[string]string) // by original path
+	for _, e := range trashed {
+		ids[e.Path] = e.ID
+	}
+	moves := map[string]string{"/plain.txt": "/secret/plain.txt", "/secret/m.txt": "/m2.txt"}
+	for src, dst := range moves {
+		if err := fs.Restore(ids[src], dst); !errors.Is(err, ErrEncrypted) {
+			t.Errorf("Restore() of %s to %s error = %v, want ErrEncrypted", src, dst, err)
+		}
+	}
+	if err := fs.Restore(ids["/secret/m.txt"], ""); err != nil {
+		t.Errorf("Restore() in place failed: %v", err)
+	}
+}
@@ -0,0 +1,503 @@
+package vfs
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DBBackend is an embedded database in a single file. The tree is served
+// from memory exactly like MemoryBackend, and every change is appended to
+// the file as it happens, so reopening the file brings the tree back.
+//
+// The file is JSON lines: a header, then usually a snapshot of the whole
+// tree, then a journal of the changes since. Compact folds the journal into
+// a new snapshot; Close does so too. A record cut short by a crash is
+// dropped when the file is opened.
+//
+// An encrypted file (see OpenEncryptedDBBackend) has the same layout, but
+// every record after the header is sealed with AES-256-GCM under a key
+// derived from a passphrase, and numbered, so records can't be read,
+// changed, reordered or moved between files without the passphrase. Only
+// the header, which holds what's needed to derive the key, is in the
+// clear. As in any journal, the last records can still be cut off.
+type DBBackend struct {
+	*MemoryBackend
+	path   string
+	file   *os.File
+	header dbHeader
+	aead   cipher.AEAD // nil unless the file is encrypted
+	seq    uint64      // records written since the header
+}
+
+// record ops
+const (
+	dbSnapshot = "snapshot"
+	dbMkdir    = "mkdir"
+	dbCreate   = "create"
+	dbWrite    = "write"
+	dbRemove   = "remove"
+	dbRename   = "rename"
+	dbSetXattr = "setxattr"
+	dbRmXattr  = "rmxattr"
+)
+
+// dbHeader is the first line of the file
+type dbHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+
+	Cipher string     `json:"cipher,omitempty"` // dbCipher, if encrypted
+	Key    *keyParams `json:"key,omitempty"`
+}
+
+const dbCipher = "aes-256-gcm"
+
+// dbSealed is a record of an encrypted file: a dbRecord, sealed with its
+// number as additional data
+type dbSealed struct {
+	Sealed []byte `json:"sealed"`
+}
+
+var currentHeader = dbHeader{Format: "vfs-db", Version: 1}
+
+// dbRecord is one line after the header: a change, or a snapshot
+type dbRecord struct {
+	Op    string    `json:"op"`
+	Path  string    `json:"path,omitempty"`
+	To    string    `json:"to,omitempty"`   // new path, for rename
+	Name  string    `json:"name,omitempty"` // attribute name, for setxattr and rmxattr
+	Data  []byte    `json:"data,omitempty"`
+	Owner string    `json:"owner,omitempty"`
+	Time  time.Time `json:"time"`
+	Nodes []dbNode  `json:"nodes,omitempty"` // for snapshot
+}
+
+// dbNode is one node in a snapshot, parents before their children
+type dbNode struct {
+	Path  string    `json:"path"`
+	Dir   bool      `json:"dir,omitempty"`
+	Data  []byte    `json:"data,omitempty"`
+	Owner string    `json:"owner,omitempty"`
+	Time  time.Time `json:"time"`
+
+	Xattrs map[string]string `json:"xattrs,omitempty"`
+}
+
+// OpenDBBackend opens the database file at path, creating it if needed.
+// It can't open encrypted files.
+func OpenDBBackend(path string) (*DBBackend, error) {
+	return openDB(path, "")
+}
+
+// OpenEncryptedDBBackend opens the encrypted database file at path,
+// creating it if needed with a key derived from passphrase. It fails with
+// ErrBadPassphrase if the file was created with another passphrase, and
+// can't open files that aren't encrypted.
+func OpenEncryptedDBBackend(path, passphrase string) (*DBBackend, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("open %s: empty passphrase", path)
+	}
+	return openDB(path, passphrase)
+}
+
+// helper: opens the database file at path, encrypted unless passphrase is
+// empty
+func openDB(path, passphrase string) (*DBBackend, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DBBackend{MemoryBackend: NewMemoryBackend(), path: path, file: f}
+	if err := db.load(passphrase); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Changes are checked in memory, journaled, and only then made in memory.
+// If writing the journal fails the error is returned and nothing changes,
+// so the tree in memory is always the one the file brings back.
+
+func (db *DBBackend) Mkdir(path, owner string) error {
+	now := time.Now()
+	change, err := db.mkdir(path, owner, now)
+	if err != nil {
+		return err
+	}
+	return db.journal(dbRecord{Op: dbMkdir, Path: path, Owner: owner, Time: now}, change)
+}
+
+func (db *DBBackend) Create(path, content, owner string) error {
+	now := time.Now()
+	change, err := db.create(path, content, owner, now)
+	if err != nil {
+		return err
+	}
+	return db.journal(dbRecord{Op: dbCreate, Path: path, Data: []byte(content), Owner: owner, Time: now}, change)
+}
+
+func (db *DBBackend) WriteFile(path, content string) error {
+	now := time.Now()
+	change, err := db.write(path, content, now)
+	if err != nil {
+		return err
+	}
+	return db.journal(dbRecord{Op: dbWrite, Path: path, Data: []byte(content), Time: now}, change)
+}
+
+func (db *DBBackend) Remove(path string) error {
+	now := time.Now()
+	change, err := db.remove(path, now)
+	if err != nil {
+		return err
+	}
+	return db.journal(dbRecord{Op: dbRemove, Path: path, Time: now}, change)
+}
+
+func (db *DBBackend) Rename(oldpath, newpath string) error {
+	now := time.Now()
+	change, err := db.rename(oldpath, newpath, now)
+	if err != nil {
+		return err
+	}
+	return db.journal(dbRecord{Op: dbRename, Path: oldpath, To: newpath, Time: now}, change)
+}
+
+func (db *DBBackend) SetXattr(path, name, value string) error {
+	change, err := db.setXattr(path, name, value)
+	if err != nil {
+		return err
+	}
+	return db.journal(dbRecord{Op: dbSetXattr, Path: path, Name: name, Data: []byte(value), Time: time.Now()}, change)
+}
+
+func (db *DBBackend) RemoveXattr(path, name string) error {
+	change, err := db.removeXattr(path, name)
+	if err != nil {
+		return err
+	}
+	return db.journal(dbRecord{Op: dbRmXattr, Path: path, Name: name, Time: time.Now()}, change)
+}
+
+// Compact rewrites the file as a single snapshot of the current tree. The
+// new file replaces the old one atomically, so a crash leaves either.
+func (db *DBBackend) Compact() error {
+	snapshot, err := db.snapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	line, err := db.recordLine(snapshot, 1)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, v := range []any{db.header, line} {
+		if err := writeLine(w, v); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// carry on journaling into the new file
+	db.file.Close()
+	db.file, db.seq = tmp, 1
+	return nil
+}
+
+// Close compacts the file and closes it
+func (db *DBBackend) Close() error {
+	err := db.Compact()
+	if closeErr := db.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// helper: reads the file into memory, with the key passphrase derives if it
+// is encrypted. A new file just gets its header, encrypted unless
+// passphrase is empty.
+func (db *DBBackend) load(passphrase string) error {
+	r := bufio.NewReader(db.file)
+	var offset int64 // end of the last complete line
+
+	for first := true; ; first = false {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// drop a record cut short by a crash
+			if err := db.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if first {
+			var header dbHeader
+			if err := json.Unmarshal(line, &header); err != nil || header.Format != currentHeader.Format {
+				return errors.New("not a vfs database")
+			}
+			if header.Version != currentHeader.Version {
+				return fmt.Errorf("unsupported database version %d", header.Version)
+			}
+			if err := db.openHeader(header, passphrase); err != nil {
+				return err
+			}
+		} else {
+			rec, err := db.readRecord(line)
+			if err != nil {
+				return fmt.Errorf("corrupt record at byte %d: %w", offset, err)
+			}
+			if err := db.apply(rec); err != nil {
+				return fmt.Errorf("replaying %s %s: %w", rec.Op, rec.Path, err)
+			}
+		}
+		offset += int64(len(line))
+	}
+
+	if _, err := db.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if offset == 0 {
+		return db.newHeader(passphrase)
+	}
+	return nil
+}
+
+// helper: checks the header of an existing file, and derives its key if it
+// is encrypted
+func (db *DBBackend) openHeader(header dbHeader, passphrase string) error {
+	db.header = header
+	switch {
+	case header.Cipher == "" && passphrase != "":
+		return errors.New("database is not encrypted")
+	case header.Cipher == "":
+		return nil
+	case header.Cipher != dbCipher || header.Key == nil:
+		return fmt.Errorf("unsupported cipher %q", header.Cipher)
+	case passphrase == "":
+		return errors.New("database is encrypted, a passphrase is needed")
+	}
+	var err error
+	db.aead, err = openKey(passphrase, *header.Key)
+	return err
+}
+
+// helper: writes the header of a new file, with a new key derived from
+// passphrase unless it is empty
+func (db *DBBackend) newHeader(passphrase string) error {
+	db.header = currentHeader
+	if passphrase != "" {
+		aead, kp, err := newKey(passphrase)
+		if err != nil {
+			return err
+		}
+		db.aead = aead
+		db.header.Cipher, db.header.Key = dbCipher, &kp
+	}
+	return writeLine(db.file, db.header)
+}
+
+// helper: the record on line, the next one after the header
+func (db *DBBackend) readRecord(line []byte) (dbRecord, error) {
+	var rec dbRecord
+	if db.aead != nil {
+		var sealed dbSealed
+		if err := json.Unmarshal(line, &sealed); err != nil {
+			return rec, err
+		}
+		plain, err := unseal(db.aead, sealed.Sealed, seqData(db.seq+1))
+		if err != nil {
+			return rec, err
+		}
+		line = plain
+	}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return rec, err
+	}
+	db.seq++
+	return rec, nil
+}
+
+// helper: what to write as record number seq: rec itself, or sealed
+func (db *DBBackend) recordLine(rec dbRecord, seq uint64) (any, error) {
+	if db.aead == nil {
+		return rec, nil
+	}
+	plain, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(db.aead, plain, seqData(seq))
+	if err != nil {
+		return nil, err
+	}
+	return dbSealed{Sealed: sealed}, nil
+}
+
+// helper: a record number as additional data
+func seqData(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// helper: replays one record on the in-memory tree
+func (db *DBBackend) apply(rec dbRecord) error {
+	switch rec.Op {
+	case dbSnapshot:
+		return db.restore(rec.Nodes)
+	case dbMkdir:
+		return done(db.mkdir(rec.Path, rec.Owner, rec.Time))
+	case dbCreate:
+		return done(db.create(rec.Path, string(rec.Data), rec.Owner, rec.Time))
+	case dbWrite:
+		return done(db.write(rec.Path, string(rec.Data), rec.Time))
+	case dbRemove:
+		return done(db.remove(rec.Path, rec.Time))
+	case dbRename:
+		return done(db.rename(rec.Path, rec.To, rec.Time))
+	case dbSetXattr:
+		return db.MemoryBackend.SetXattr(rec.Path, rec.Name, string(rec.Data))
+	case dbRmXattr:
+		return db.MemoryBackend.RemoveXattr(rec.Path, rec.Name)
+	}
+	return fmt.Errorf("unknown record %q", rec.Op)
+}
+
+// helper: replaces the in-memory tree with a snapshot
+func (db *DBBackend) restore(nodes []dbNode) error {
+	db.MemoryBackend = NewMemoryBackend()
+	for _, n := range nodes {
+		var err error
+		switch {
+		case isRoot(n.Path):
+			db.root.owner = n.Owner
+		case n.Dir:
+			err = done(db.mkdir(n.Path, n.Owner, n.Time))
+		default:
+			err = done(db.create(n.Path, string(n.Data), n.Owner, n.Time))
+		}
+		if err != nil {
+			return err
+		}
+		for name, value := range n.Xattrs {
+			if err := db.MemoryBackend.SetXattr(n.Path, name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// creating children touched their parents; put the saved times back
+	for _, n := range nodes {
+		if n.Dir {
+			node, err := db.lookup(n.Path)
+			if err != nil {
+				return err
+			}
+			node.(*Directory).modTime = n.Time
+		}
+	}
+	return nil
+}
+
+// helper: the snapshot record of the in-memory tree
+func (db *DBBackend) snapshot() (dbRecord, error) {
+	rec := dbRecord{Op: dbSnapshot, Time: time.Now()}
+	var walk func(path string, node Node) error
+	walk = func(path string, node Node) error {
+		n := dbNode{Path: path, Owner: node.Owner(), Time: node.ModTime(), Xattrs: *xattrsOf(node)}
+		switch node := node.(type) {
+		case *File:
+			content, err := node.content.content()
+			if err != nil {
+				return err
+			}
+			n.Data = []byte(content)
+			rec.Nodes = append(rec.Nodes, n)
+		case *Directory:
+			n.Dir = true
+			rec.Nodes = append(rec.Nodes, n)
+			for name, child := range node.children {
+				if err := walk(joinPath(path, name), child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk("/", db.root)
+	return rec, err
+}
+
+// helper: appends a record to the journal, then makes the change it
+// records in memory
+func (db *DBBackend) journal(rec dbRecord, change func()) error {
+	if err := db.append(rec); err != nil {
+		return err
+	}
+	change()
+	return nil
+}
+
+// helper: appends a record to the journal
+func (db *DBBackend) append(rec dbRecord) error {
+	line, err := db.recordLine(rec, db.seq+1)
+	if err != nil {
+		return err
+	}
+	offset, err := db.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := writeLine(db.file, line); err != nil {
+		// drop any part of the line that made it, so the next record
+		// starts a line of its own
+		if db.file.Truncate(offset) == nil {
+			db.file.Seek(offset, io.SeekStart)
+		}
+		return err
+	}
+	db.seq++
+	return nil
+}
+
+// helper: writes v as one JSON line in a single Write, so a crash can only
+// cut the last line short
+func writeLine(w io.Writer, v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,81 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDBJournalFailure checks a change the journal can't take isn't made
+// in memory either, so the tree and the file never disagree
+func TestDBJournalFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	db, err := OpenDBBackend(path)
+	if err != nil {
+		t.Fatalf("OpenDBBackend() failed: %v", err)
+	}
+	fs := NewFileSystemWithBackend(db)
+	_ = fs.Mkdir("/a")
+	_ = fs.Touch("/a/f.txt", "v1")
+	_ = fs.SetXattr("/a", "team", "storage")
+
+	// journal into a handle that can't be written
+	writable := db.file
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	readOnly.Seek(0, io.SeekEnd)
+	db.file = readOnly
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Mkdir", fs.Mkdir("/b")},
+		{"Touch", fs.Touch("/a/g.txt", "")},
+		{"Write", fs.Write("/a/f.txt", "v2")},
+		{"Mv", fs.Mv("/a/f.txt", "/f.txt")},
+		{"Rm", fs.Rm("/a")},
+		{"SetXattr", fs.SetXattr("/a", "team", "other")},
+		{"RemoveXattr", fs.RemoveXattr("/a", "team")},
+	}
+	for _, tt := range tests {
+		if tt.err == nil || errors.Is(tt.err, ErrNotExist) {
+			t.Errorf("%s with a failing journal error = %v", tt.name, tt.err)
+		}
+	}
+	check := func(when string) {
+		t.Helper()
+		if names, _ := fs.Ls("/"); !reflect.DeepEqual(names, []string{"a"}) {
+			t.Errorf("Ls(/) %s = %v, want [a]", when, names)
+		}
+		if names, _ := fs.Ls("/a"); !reflect.DeepEqual(names, []string{"f.txt"}) {
+			t.Errorf("Ls(/a) %s = %v, want [f.txt]", when, names)
+		}
+		if content, _ := fs.Cat("/a/f.txt"); content != "v1" {
+			t.Errorf("Cat() %s = %q, want v1", when, content)
+		}
+		if value, _ := fs.GetXattr("/a", "team"); value != "storage" {
+			t.Errorf("GetXattr() %s = %q, want storage", when, value)
+		}
+	}
+	check("after failed changes")
+
+	// the file brings back the same tree
+	readOnly.Close()
+	db.file = writable
+	if err := db.file.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	db, err = OpenDBBackend(path)
+	if err != nil {
+		t.Fatalf("OpenDBBackend() after failed changes failed: %v", err)
+	}
+	fs = NewFileSystemWithBackend(db)
+	defer fs.Close()
+	check("after reopen")
+}
@@ -0,0 +1,58 @@
+package vfs
+
+import (
+	"strings"
+	"sync"
+)
+
+// dentryCache remembers the Directory each path resolves to, like the
+// kernel's dentry cache, so resolving a path in a deep tree doesn't walk it
+// from the root every time. Entries are added as paths are resolved and
+// dropped when their directory is removed or moved, so they are never
+// stale, and it never holds more than one entry per directory. Lookups
+// fill it under the FileSystem's read lock, so it has a lock of its own. A
+// nil cache caches nothing.
+type dentryCache struct {
+	mu   sync.RWMutex
+	dirs map[string]*Directory // by cleaned path
+}
+
+func newDentryCache() *dentryCache {
+	return &dentryCache{dirs: make(map[string]*Directory)}
+}
+
+// helper: the directory cached for path
+func (c *dentryCache) get(path string) (*Directory, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	dir, ok := c.dirs[path]
+	return dir, ok
+}
+
+// helper: caches dir as the directory at path
+func (c *dentryCache) put(path string, dir *Directory) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirs[path] = dir
+}
+
+// helper: drops the directory at path, which is gone or moved, and every
+// directory below it
+func (c *dentryCache) invalidate(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for p := range c.dirs {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(c.dirs, p)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestDentryCache checks paths never resolve through a directory that was
+// removed or moved, even once cached
+func TestDentryCache(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/a")
+	_ = fs.Mkdir("/a/b")
+	_ = fs.Touch("/a/b/f", "old")
+	_ = fs.Mkdir("/x")
+	_ = fs.Mkdir("/x/b")
+	_ = fs.Touch("/x/b/f", "moved")
+
+	steps := []struct {
+		name string
+		edit func() error
+		path string
+		want string // content, or "" if the path shouldn't resolve
+	}{
+		{"cached", func() error { return nil }, "/a/b/f", "old"},
+		{"parent removed", func() error { return fs.Rm("/a") }, "/a/b/f", ""},
+		{"parent recreated", func() error {
+			_ = fs.Mkdir("/a")
+			_ = fs.Mkdir("/a/b")
+			return fs.Touch("/a/b/f", "new")
+		}, "/a/b/f", "new"},
+		{"moved away", func() error { return fs.Mv("/a", "/c") }, "/a/b/f", ""},
+		{"at its new path", func() error { return nil }, "/c/b/f", "new"},
+		{"moved in its place", func() error { return fs.Mv("/x", "/a") }, "/a/b/f", "moved"},
+	}
+	for _, s := range steps {
+		if err := s.edit(); err != nil {
+			t.Fatalf("%s: edit failed: %v", s.name, err)
+		}
+		content, err := fs.Cat(s.path)
+		if s.want == "" {
+			if !errors.Is(err, ErrNotExist) {
+				t.Errorf("%s: Cat(%s) = %q, %v, want ErrNotExist", s.name, s.path, content, err)
+			}
+		} else if err != nil || content != s.want {
+			t.Errorf("%s: Cat(%s) = %q, %v, want %q", s.name, s.path, content, err, s.want)
+		}
+	}
+
+	cache := fs.backend.root.(*MemoryBackend).dentries
+	for p := range cache.dirs {
+		if strings.HasPrefix(p, "/x") {
+			t.Errorf("cache still holds %s", p)
+		}
+	}
+}
+
+// helper: a file system holding a chain of depth directories with a file
+// at the bottom, and the path of the file
+func deepTree(b *testing.B, depth int) (*FileSystem, string) {
+	fs := NewFileSystem()
+	dir := ""
+	for i := range depth {
+		dir += fmt.Sprintf("/d%d", i)
+		if err := fs.Mkdir(dir); err != nil {
+			b.Fatal(err)
+		}
+	}
+	file := dir + "/leaf.txt"
+	if err := fs.Touch(file, "leaf"); err != nil {
+		b.Fatal(err)
+	}
+	return fs, file
+}
+
+// helper: a file system holding dirs directories with files files each,
+// and the paths of the files
+func wideTree(b *testing.B, dirs, files int) (*FileSystem, []string) {
+	fs := NewFileSystem()
+	var paths []string
+	for i := range dirs {
+		dir := fmt.Sprintf("/dir%d", i)
+		if err := fs.Mkdir(dir); err != nil {
+			b.Fatal(err)
+		}
+		for j := range files {
+			p := fmt.Sprintf("%s/file%d", dir, j)
+			if err := fs.Touch(p, "x"); err != nil {
+				b.Fatal(err)
+			}
+			paths = append(paths, p)
+		}
+	}
+	return fs, paths
+}
+
+// helper: runs bench with and without the dentry cache
+func withAndWithoutCache(b *testing.B, fs *FileSystem, bench func(b *testing.B)) {
+	m := fs.backend.root.(*MemoryBackend)
+	b.Run("cached", bench)
+	m.dentries = nil
+	b.Run("uncached", bench)
+}
+
+// BenchmarkStatDeep resolves a file 64 directories down, again and again
+func BenchmarkStatDeep(b *testing.B) {
+	fs, file := deepTree(b, 64)
+	withAndWithoutCache(b, fs, func(b *testing.B) {
+		for b.Loop() {
+			if _, err := fs.Stat(file); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkCatDeep reads a file 64 directories down, again and again
+func BenchmarkCatDeep(b *testing.B) {
+	fs, file := deepTree(b, 64)
+	withAndWithoutCache(b, fs, func(b *testing.B) {
+		for b.Loop() {
+			if _, err := fs.Cat(file); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkStatWide resolves every file of 1000 directories of 100 files
+func BenchmarkStatWide(b *testing.B) {
+	fs, paths := wideTree(b, 1000, 100)
+	withAndWithoutCache(b, fs, func(b *testing.B) {
+		i := 0
+		for b.Loop() {
+			if _, err := fs.Stat(paths[i%len(paths)]); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,386 @@
+package vfs
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChangeKind is how an entry differs between the two trees Diff compares
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota + 1
+	Removed
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// Change is one entry that differs between the two sides of a Diff. Path is
+// relative to the compared nodes, "." for the nodes themselves.
+type Change struct {
+	Kind  ChangeKind
+	Path  string
+	IsDir bool // the entry is a directory (on the side that has it; in b for a Changed one)
+}
+
+func (c Change) String() string {
+	if c.IsDir && c.Path != "." {
+		return c.Kind.String() + " " + c.Path + "/"
+	}
+	return c.Kind.String() + " " + c.Path
+}
+
+// diff(a, b): what it takes to turn the node at a into the node at b. Two
+// directories are compared recursively, parents before their children and
+// siblings sorted by name: entries only in b are Added, entries only in a
+// are Removed, and files with different content, or entries that are a file
+// on one side and a directory on the other, are Changed. An added or
+// removed directory is reported without its content. Two files give a
+// single Changed entry for "." if their content differs, as does a file
+// compared with a directory. Identical nodes give no changes.
+func (fs *FileSystem) Diff(a, b string) ([]Change, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	pa, infoA, err := fs.lookup(a)
+	if err != nil {
+		return nil, pathError("diff", a, err)
+	}
+	pb, infoB, err := fs.lookup(b)
+	if err != nil {
+		return nil, pathError("diff", b, err)
+	}
+
+	var changes []Change
+	if err := fs.diffNodes(pa, pb, ".", infoA, infoB, &changes); err != nil {
+		return nil, pathError("diff", a, err)
+	}
+	return changes, nil
+}
+
+// helper: appends the changes between the nodes at a and b (described by
+// infoA and infoB), found at rel below the compared roots
+func (fs *FileSystem) diffNodes(a, b, rel string, infoA, infoB FileInfo, changes *[]Change) error {
+	if !infoA.IsDir || !infoB.IsDir {
+		same := false
+		if !infoA.IsDir && !infoB.IsDir {
+			var err error
+			if same, err = fs.sameContent(a, b, infoA, infoB); err != nil {
+				return err
+			}
+		}
+		if !same {
+			*changes = append(*changes, Change{Kind: Changed, Path: rel, IsDir: infoB.IsDir})
+		}
+		return nil
+	}
+
+	entriesA, err := fs.backend.ReadDir(a)
+	if err != nil {
+		return err
+	}
+	entriesB, err := fs.backend.ReadDir(b)
+	if err != nil {
+		return err
+	}
+
+	// both listings are sorted, so walk them side by side
+	for len(entriesA) > 0 || len(entriesB) > 0 {
+		switch {
+		case len(entriesB) == 0 || (len(entriesA) > 0 && entriesA[0].Name < entriesB[0].Name):
+			e := entriesA[0]
+			*changes = append(*changes, Change{Kind: Removed, Path: relPath(rel, e.Name), IsDir: e.IsDir})
+			entriesA = entriesA[1:]
+
+		case len(entriesA) == 0 || entriesB[0].Name < entriesA[0].Name:
+			e := entriesB[0]
+			*changes = append(*changes, Change{Kind: Added, Path: relPath(rel, e.Name), IsDir: e.IsDir})
+			entriesB = entriesB[1:]
+
+		default:
+			ea, eb := entriesA[0], entriesB[0]
+			err := fs.diffNodes(joinPath(a, ea.Name), joinPath(b, eb.Name), relPath(rel, ea.Name), ea, eb, changes)
+			if err != nil {
+				return err
+			}
+			entriesA, entriesB = entriesA[1:], entriesB[1:]
+		}
+	}
+	return nil
+}
+
+// helper: reports whether the files at a and b have the same content,
+// comparing hashes when both backends provide them
+func (fs *FileSystem) sameContent(a, b string, infoA, infoB FileInfo) (bool, error) {
+	if infoA.Size != infoB.Size {
+		return false, nil
+	}
+	if infoA.Hash != "" && infoB.Hash != "" {
+		return infoA.Hash == infoB.Hash, nil
+	}
+
+	contentA, err := fs.backend.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	contentB, err := fs.backend.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return contentA == contentB, nil
+}
+
+func relPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// unifieddiff(a, b): the differences between two files as a unified diff,
+// with a and b in the header and three lines of context around each change.
+// Identical files give "".
+func (fs *FileSystem) UnifiedDiff(a, b string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	contents := make([]string, 2)
+	for i, path := range []string{a, b} {
+		p, err := fs.checkPath(path)
+		if err != nil {
+			return "", pathError("diff", path, err)
+		}
+		if contents[i], err = fs.readContent(p); err != nil {
+			return "", pathError("diff", path, err)
+		}
+	}
+	return unifiedDiff(a, b, contents[0], contents[1]), nil
+}
+
+// lines of unchanged content shown around each change
+const diffContext = 3
+
+// edit is one line of an edit script: kept (' '), removed ('-') or added ('+')
+type edit struct {
+	op   byte
+	line string
+}
+
+// helper: formats the edit script from a to b as a unified diff
+func unifiedDiff(nameA, nameB, a, b string) string {
+	edits := lineEdits(splitLines(a), splitLines(b))
+
+	// posA[i] and posB[i]: the lines of a and b before edits[i]
+	posA := make([]int, len(edits)+1)
+	posB := make([]int, len(edits)+1)
+	for i, e := range edits {
+		posA[i+1], posB[i+1] = posA[i], posB[i]
+		if e.op != '+' {
+			posA[i+1]++
+		}
+		if e.op != '-' {
+			posB[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// a hunk runs through the changes that are close enough together
+		// to share their context
+		start, end := max(i-diffContext, 0), i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*diffContext {
+				end = min(end+diffContext, len(edits))
+				break
+			}
+			end = run
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(posA[start], posA[end]-posA[start]), hunkRange(posB[start], posB[end]-posB[start]))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// helper: a hunk's "start,count" for the count lines after the first
+// before lines, in the form diff(1) uses
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprint(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// helper: splits content into lines, each keeping its "\n"
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// helper: the shortest edit script turning a into b, found with Myers'
+// O(ND) algorithm in its linear space form: the middle snake of the
+// shortest path splits it in two halves, found the same way, so no more
+// than two rows of furthest points are ever kept. Within each change,
+// removed lines come before added ones, as diff(1) prints them.
+func lineEdits(a, b []string) []edit {
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d := &differ{a: a, b: b, forward: make([]int, size), backward: make([]int, size)}
+	d.compare(0, len(a), 0, len(b))
+
+	for i := 0; i < len(d.edits); {
+		if d.edits[i].op == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(d.edits) && d.edits[j].op != ' ' {
+			j++
+		}
+		// '-' is above '+', so compare the other way round
+		slices.SortStableFunc(d.edits[i:j], func(x, y edit) int { return cmp.Compare(y.op, x.op) })
+		i = j
+	}
+	return d.edits
+}
+
+// differ holds the lines lineEdits compares, and the rows of furthest
+// points (by diagonal) it reuses from one middle snake to the next
+type differ struct {
+	a, b              []string
+	forward, backward []int
+	edits             []edit
+}
+
+// helper: appends the edits turning a[aLo:aHi] into b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, edit{' ', d.a[aLo]})
+		aLo, bLo = aLo+1, bLo+1
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	switch {
+	case aLo == aHi:
+		for _, line := range d.b[bLo:bHi] {
+			d.edits = append(d.edits, edit{'+', line})
+		}
+	case bLo == bHi:
+		for _, line := range d.a[aLo:aHi] {
+			d.edits = append(d.edits, edit{'-', line})
+		}
+	default:
+		// with no common first or last line there are at least two edits,
+		// so each half has fewer
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		for _, line := range d.a[x:u] {
+			d.edits = append(d.edits, edit{' ', line})
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for _, line := range d.a[aHi : aHi+suffix] {
+		d.edits = append(d.edits, edit{' ', line})
+	}
+}
+
+// helper: the snake from (x, y) to (u, v) halfway along the shortest path
+// from (aLo, bLo) to (aHi, bHi), searched from both ends at once until the
+// two searches meet. Diagonals are k = x - y, from the start going forward
+// and from the end going backward; a backward diagonal c is the forward
+// diagonal delta - c.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	half := (n + m + 1) / 2
+	offset := half + 1
+	forward, backward := d.forward, d.backward
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	for depth := 0; depth <= half; depth++ {
+		for k := -depth; k <= depth; k += 2 {
+			x := furthest(forward, offset, k, depth)
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x, y = x+1, y+1
+			}
+			forward[offset+k] = x
+			// the backward search is one round behind
+			if c := delta - k; odd && c >= -(depth-1) && c <= depth-1 && x+backward[offset+c] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+		for c := -depth; c <= depth; c += 2 {
+			x := furthest(backward, offset, c, depth)
+			y := x - c
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x, y = x+1, y+1
+			}
+			backward[offset+c] = x
+			if k := delta - c; !odd && k >= -depth && k <= depth && forward[offset+k]+x >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+	panic("vfs: no middle snake") // the searches always meet by then
+}
+
+// helper: the furthest x on diagonal k after round depth, before following
+// its snake: one step down from diagonal k+1 (a line of b is added) or
+// right from k-1 (a line of a is removed), whichever gets further
+func furthest(row []int, offset, k, depth int) int {
+	if k == -depth || (k != depth && row[offset+k-1] < row[offset+k+1]) {
+		return row[offset+k+1]
+	}
+	return row[offset+k-1] + 1
+}
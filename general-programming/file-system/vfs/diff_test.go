@@ -0,0 +1,176 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// TestDiff checks the recursive comparison of two trees
+func TestDiff(t *testing.T) {
+	fs := NewFileSystem()
+	for _, dir := range []string{"/v1", "/v1/conf", "/v1/old", "/v2", "/v2/conf", "/v2/new"} {
+		_ = fs.Mkdir(dir)
+	}
+	_ = fs.Touch("/v1/conf/app.yaml", "port: 80")
+	_ = fs.Touch("/v2/conf/app.yaml", "port: 8080")
+	_ = fs.Touch("/v1/same.txt", "same")
+	_ = fs.Touch("/v2/same.txt", "same")
+	_ = fs.Touch("/v1/removed.txt", "")
+	_ = fs.Touch("/v1/kind", "was a file")
+	_ = fs.Mkdir("/v2/kind")
+
+	want := []Change{
+		{Kind: Changed, Path: "conf/app.yaml"},
+		{Kind: Changed, Path: "kind", IsDir: true},
+		{Kind: Added, Path: "new", IsDir: true},
+		{Kind: Removed, Path: "old", IsDir: true},
+		{Kind: Removed, Path: "removed.txt"},
+	}
+	got, err := fs.Diff("/v1", "/v2")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %v, %v, want %v", got, err, want)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		want []Change
+	}{
+		{"Same tree", "/v1", "/v1", nil},
+		{"Same files", "/v1/same.txt", "/v2/same.txt", nil},
+		{"Different files", "/v1/conf/app.yaml", "/v2/conf/app.yaml", []Change{{Kind: Changed, Path: "."}}},
+		{"File and directory", "/v1/same.txt", "/v2/conf", []Change{{Kind: Changed, Path: ".", IsDir: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := fs.Diff(tt.a, tt.b); err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff(%s, %s) = %v, %v, want %v", tt.a, tt.b, got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := fs.Diff("/v1", "/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Diff(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+// TestUnifiedDiff checks the output against what diff -u prints
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"Identical", "a\nb\n", "a\nb\n", ""},
+		{
+			"Changed line",
+			"a\nb\nc\n", "a\nB\nc\n",
+			"--- /a\n+++ /b\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"Separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\nX\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n",
+			"--- /a\n+++ /b\n@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n",
+		},
+		{
+			"Into empty",
+			"", "new\n",
+			"--- /a\n+++ /b\n@@ -0,0 +1 @@\n+new\n",
+		},
+		{
+			"Missing newline",
+			"a\nb\n", "a\nb",
+			"--- /a\n+++ /b\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewFileSystem()
+			_ = fs.Touch("/a", tt.a)
+			_ = fs.Touch("/b", tt.b)
+			if got, err := fs.UnifiedDiff("/a", "/b"); err != nil || got != tt.want {
+				t.Errorf("UnifiedDiff() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/dir")
+	_ = fs.Touch("/f", "")
+	if _, err := fs.UnifiedDiff("/f", "/dir"); !errors.Is(err, ErrIsDir) {
+		t.Errorf("UnifiedDiff(dir) error = %v, want ErrIsDir", err)
+	}
+}
+
+// TestLineEdits checks edit scripts of random files turn one into the other
+// with as few edits as the longest common subsequence allows
+func TestLineEdits(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	lines := func() []string {
+		result := make([]string, r.IntN(40))
+		for i := range result {
+			result[i] = string(rune('a' + r.IntN(4)))
+		}
+		return result
+	}
+
+	for range 500 {
+		a, b := lines(), lines()
+		edits := lineEdits(a, b)
+
+		var gotA, gotB []string
+		changes := 0
+		for _, e := range edits {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.op != ' ' {
+				changes++
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("lineEdits(%q, %q) = %v, which isn't a script between them", a, b, edits)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); changes != want {
+			t.Fatalf("lineEdits(%q, %q) makes %d changes, want %d", a, b, changes, want)
+		}
+	}
+}
+
+// helper: the length of the longest common subsequence of a and b
+func lcsLength(a, b []string) int {
+	row := make([]int, len(b)+1)
+	for i := range a {
+		prev := 0 // row[j] of the previous i
+		for j := range b {
+			cur := row[j+1]
+			if a[i] == b[j] {
+				row[j+1] = prev + 1
+			} else {
+				row[j+1] = max(row[j+1], row[j])
+			}
+			prev = cur
+		}
+	}
+	return row[len(b)]
+}
+
+// BenchmarkLineEditsDistant diffs two files with nothing in common, where
+// keeping every round of the search would take O(D²) memory
+func BenchmarkLineEditsDistant(b *testing.B) {
+	a, c := make([]string, 5000), make([]string, 5000)
+	for i := range a {
+		a[i], c[i] = fmt.Sprintf("a%d\n", i), fmt.Sprintf("c%d\n", i)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		lineEdits(a, c)
+	}
+}
@@ -0,0 +1,14 @@
+// Package vfs implements a hierarchical, in-memory file system.
+//
+// A FileSystem holds a tree of Nodes rooted at "/". Directories map child
+// names to Nodes and Files hold text content. Paths are slash separated and
+// always resolved from the root, so "/home/user" and "home/user/" name the
+// same directory.
+//
+// Every operation that fails returns a *PathError wrapping one of the
+// package's sentinel errors (ErrNotExist, ErrExist, ErrPermission, ErrNotDir,
+// ErrIsDir, ErrInvalidPath), which can be tested for with errors.Is.
+//
+// A FileSystem is safe for concurrent use by multiple goroutines. The
+// httpfs subpackage builds on that to share one tree over HTTP.
+package vfs
@@ -0,0 +1,75 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+)
+
+// PathError records an error and the operation and path that caused it.
+// It is the same type as io/fs.PathError (and os.PathError), so callers can
+// use errors.As with either.
+type PathError = iofs.PathError
+
+// Sentinel errors returned by FileSystem operations, always wrapped in a
+// *PathError. The ones with an io/fs equivalent are either that error itself
+// or unwrap to it, so errors.Is(err, fs.ErrNotExist) and friends work too.
+var (
+	ErrNotExist    = iofs.ErrNotExist
+	ErrExist       = iofs.ErrExist
+	ErrPermission  = iofs.ErrPermission
+	ErrNotDir      = &fsError{msg: "not a directory"}
+	ErrIsDir       = &fsError{msg: "is a directory"}
+	ErrInvalidPath = &fsError{msg: "invalid path", base: iofs.ErrInvalid}
+
+	// ErrNameTooLong, ErrPathTooLong, ErrReservedName and ErrInvalidChar
+	// are returned for paths that break the FileSystem's PathRules. They
+	// unwrap to ErrInvalidPath.
+	ErrNameTooLong  = &fsError{msg: "file name too long", base: ErrInvalidPath}
+	ErrPathTooLong  = &fsError{msg: "path too long", base: ErrInvalidPath}
+	ErrReservedName = &fsError{msg: "reserved name", base: ErrInvalidPath}
+	ErrInvalidChar  = &fsError{msg: "invalid character in name", base: ErrInvalidPath}
+
+	// ErrQuotaExceeded is returned when a create, write or move would take
+	// a directory or user over its Quota
+	ErrQuotaExceeded = &fsError{msg: "quota exceeded"}
+
+	// ErrCrossMount is returned when moving a node to a different mount
+	ErrCrossMount = &fsError{msg: "cannot move across mount points"}
+
+	// ErrLocked is returned when a file can't be locked, or changed, moved
+	// or removed because another handle holds a lock on it
+	ErrLocked = &fsError{msg: "file is locked"}
+
+	// ErrEncrypted is returned when reading or writing a file below an
+	// encrypted directory that is locked, or moving a node in or out of
+	// one (see EncryptDir)
+	ErrEncrypted = &fsError{msg: "encrypted directory is locked", base: ErrPermission}
+
+	// ErrBadPassphrase is returned when a passphrase doesn't open an
+	// encrypted directory or database file
+	ErrBadPassphrase = &fsError{msg: "wrong passphrase", base: ErrPermission}
+
+	// ErrBadQuery is returned by Search for a query that can't be parsed
+	ErrBadQuery = &fsError{msg: "syntax error in search query", base: iofs.ErrInvalid}
+
+	// ErrNoXattr is returned for an extended attribute a node doesn't have
+	ErrNoXattr = &fsError{msg: "no such attribute"}
+
+	// ErrUnsupported is returned when the backend holding a node can't do
+	// what was asked, like storing extended attributes
+	ErrUnsupported = errors.ErrUnsupported
+)
+
+// fsError is a sentinel that can optionally unwrap to an io/fs error
+type fsError struct {
+	msg  string
+	base error
+}
+
+func (e *fsError) Error() string { return e.msg }
+func (e *fsError) Unwrap() error { return e.base }
+
+// helper: wraps err with the operation and path that produced it
+func pathError(op, path string, err error) error {
+	return &PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,93 @@
+package vfs_test
+
+import (
+	"errors"
+	"fmt"
+
+	"file-system/vfs"
+)
+
+func Example() {
+	fs := vfs.NewFileSystem()
+	_ = fs.Mkdir("/home")
+	_ = fs.Mkdir("/home/user")
+	_ = fs.Touch("/home/user/readme.txt", "Welcome to the file system")
+
+	names, _ := fs.Ls("/home/user")
+	fmt.Println(names)
+
+	content, _ := fs.Cat("/home/user/readme.txt")
+	fmt.Println(content)
+	// Output:
+	// [readme.txt]
+	// Welcome to the file system
+}
+
+func ExampleFileSystem_Mkdir() {
+	fs := vfs.NewFileSystem()
+
+	// parents must exist before their children can be created
+	err := fs.Mkdir("/usr/bin")
+	fmt.Println(err)
+
+	_ = fs.Mkdir("/usr")
+	err = fs.Mkdir("/usr/bin")
+	fmt.Println(err)
+	// Output:
+	// mkdir /usr/bin: file does not exist
+	// <nil>
+}
+
+func ExampleFileSystem_Ls() {
+	fs := vfs.NewFileSystem()
+	_ = fs.Mkdir("/usr")
+	_ = fs.Touch("/usr/config", "data")
+	_ = fs.Mkdir("/usr/bin")
+
+	// entries come back sorted by name
+	names, _ := fs.Ls("/usr")
+	fmt.Println(names)
+	// Output: [bin config]
+}
+
+func ExampleFileSystem_Cat() {
+	fs := vfs.NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	_ = fs.Touch("/docs/note.txt", "remember the milk")
+
+	content, _ := fs.Cat("/docs/note.txt")
+	fmt.Println(content)
+
+	_, err := fs.Cat("/docs")
+	fmt.Println(errors.Is(err, vfs.ErrIsDir))
+	// Output:
+	// remember the milk
+	// true
+}
+
+func ExampleFileSystem_Rm() {
+	fs := vfs.NewFileSystem()
+	_ = fs.Mkdir("/a")
+	_ = fs.Mkdir("/a/b")
+	_ = fs.Touch("/a/b/file.txt", "data")
+
+	// removing a directory removes everything below it
+	_ = fs.Rm("/a")
+
+	_, err := fs.Cat("/a/b/file.txt")
+	fmt.Println(errors.Is(err, vfs.ErrNotExist))
+	// Output: true
+}
+
+func ExamplePathError() {
+	fs := vfs.NewFileSystem()
+	_ = fs.Touch("/note.txt", "")
+
+	_, err := fs.Ls("/note.txt")
+
+	var pe *vfs.PathError
+	if errors.As(err, &pe) {
+		fmt.Println(pe.Op, pe.Path, errors.Is(pe.Err, vfs.ErrNotDir))
+	}
+	// Output: ls /note.txt true
+}
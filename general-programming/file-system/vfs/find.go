@@ -0,0 +1,88 @@
+package vfs
+
+import (
+	"errors"
+	"path"
+)
+
+// FindType restricts Find to files or directories
+type FindType int
+
+const (
+	FindAll FindType = iota
+	FindFiles
+	FindDirs
+)
+
+// FindQuery selects the nodes Find returns. Zero fields match everything.
+type FindQuery struct {
+	Name string   // glob matched against the node's name, as in path.Match
+	Type FindType // FindAll, FindFiles or FindDirs
+
+	// Xattr is an attribute the node must have, with the value XattrValue
+	// unless that is empty
+	Xattr      string
+	XattrValue string
+}
+
+// find(root, query): the paths of root and every node below it that match
+// query, parents before their children and siblings sorted by name
+func (fs *FileSystem) Find(root string, q FindQuery) ([]string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if _, err := path.Match(q.Name, ""); err != nil {
+		return nil, pathError("find", root, err)
+	}
+
+	p, info, err := fs.lookup(root)
+	if err != nil {
+		return nil, pathError("find", root, err)
+	}
+
+	var result []string
+	err = fs.walk(p, info, func(path string, info FileInfo) error {
+		ok, err := fs.matches(path, info, q)
+		if ok {
+			result = append(result, path)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, pathError("find", root, err)
+	}
+	return result, nil
+}
+
+// helper: reports whether the node at p (described by info) matches q
+func (fs *FileSystem) matches(p string, info FileInfo, q FindQuery) (bool, error) {
+	switch {
+	case q.Type == FindFiles && info.IsDir, q.Type == FindDirs && !info.IsDir:
+		return false, nil
+	}
+
+	if q.Name != "" {
+		// the root has no name of its own to match
+		if isRoot(p) {
+			return false, nil
+		}
+		if ok, _ := path.Match(q.Name, info.Name); !ok {
+			return false, nil
+		}
+	}
+
+	if q.Xattr != "" {
+		attrs, err := fs.backend.Xattrs(p)
+		if errors.Is(err, ErrUnsupported) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		value, ok := attrs[q.Xattr]
+		if !ok || (q.XattrValue != "" && value != q.XattrValue) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,169 @@
+package vfs
+
+import (
+	"crypto/cipher"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUser owns the root directory and acts for a new FileSystem
+const DefaultUser = "root"
+
+// FileSystem is a handle on a tree that acts as one user: nodes it creates
+// are owned by that user and count towards their quota. WithUser returns
+// handles for other users on the same tree.
+type FileSystem struct {
+	*state
+	user string
+}
+
+// state is the tree and everything attached to it, shared by every handle.
+// It is safe for concurrent use: reads share mu, mutations hold it exclusively.
+type state struct {
+	mu         sync.RWMutex
+	backend    *mountTable // the root backend and whatever is mounted on it
+	watchers   []*Watcher
+	dirQuotas  map[string]*quota // by cleaned directory path
+	userQuotas map[string]*quota // by user name
+
+	trashEnabled bool          // Rm moves nodes to the trash
+	trashMaxAge  time.Duration // how long they stay there; 0 for ever
+
+	locks        map[string][]*Lock // by cleaned file path
+	lockReleased chan struct{}      // closed when a lock is released, for Lock to retry
+
+	versions     map[string][]Version // by cleaned file path, oldest first
+	versionLimit int                  // versions kept per file; 0 for none
+	versionBlobs *blobStore           // content of versions the backend doesn't share
+
+	index *searchIndex // built by the first Search; nil until then
+
+	rules PathRules  // every path given to the FileSystem must follow
+	folds *foldCache // names by case folding, for CaseInsensitive rules
+
+	audit auditLog // see SetAuditLog
+
+	dirKeys   map[string]cipher.AEAD // keys of the unlocked encrypted directories, by cleaned path
+	encrypted encryptedDirs          // the encrypted directories, locked or not
+}
+
+// NewFileSystem returns a file system kept in memory
+func NewFileSystem() *FileSystem {
+	return NewFileSystemWithBackend(NewMemoryBackend())
+}
+
+// NewFileSystemWithBackend returns a file system stored in backend, which
+// it takes over: the backend must not be used directly afterwards
+func NewFileSystemWithBackend(backend Backend) *FileSystem {
+	return &FileSystem{
+		state: &state{
+			backend:    newMountTable(backend),
+			dirQuotas:  make(map[string]*quota),
+			userQuotas: make(map[string]*quota),
+			locks:      make(map[string][]*Lock),
+			dirKeys:    make(map[string]cipher.AEAD),
+
+			versions:     make(map[string][]Version),
+			versionLimit: DefaultVersionLimit,
+			versionBlobs: newBlobStore(),
+
+			rules: DefaultPathRules,
+			folds: newFoldCache(),
+			audit: auditLog{limit: DefaultAuditLimit},
+		},
+		user: DefaultUser,
+	}
+}
+
+// WithUser returns a handle on the same tree that acts as user
+func (fs *FileSystem) WithUser(user string) *FileSystem {
+	return &FileSystem{state: fs.state, user: user}
+}
+
+// User returns the user this handle acts as
+func (fs *FileSystem) User() string {
+	return fs.user
+}
+
+// Close closes the backend and everything mounted on it, where they need
+// closing. The tree must not be used through any handle afterwards.
+func (fs *FileSystem) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.backend.Close()
+}
+
+// SetCompressionThreshold sets the content size in bytes above which new
+// content is stored compressed; 0 turns compression off. Content already
+// stored keeps its current form. It does nothing on backends that don't
+// compress.
+func (fs *FileSystem) SetCompressionThreshold(bytes int64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.backend.SetCompressionThreshold(bytes)
+}
+
+// helper: splits path into parts, ignoring empty strings from leading/trailing slashes
+func parsePath(path string) []string {
+	clean := make([]string, 0, strings.Count(path, "/")+1)
+	for path != "" {
+		name, rest, _ := strings.Cut(path, "/")
+		if name != "" {
+			clean = append(clean, name)
+		}
+		path = rest
+	}
+	if len(clean) == 0 {
+		return nil
+	}
+	return clean
+}
+
+// helper: reports whether path is already in the form cleanPath returns,
+// so it can be used as is
+func isClean(path string) bool {
+	return path == "/" || (strings.HasPrefix(path, "/") && !strings.HasSuffix(path, "/") && !strings.Contains(path, "//"))
+}
+
+// helper: reports whether path refers to the root directory
+func isRoot(path string) bool {
+	return path != "" && len(parsePath(path)) == 0
+}
+
+// helper: resolves path to what the backend knows about it
+func (fs *FileSystem) lookup(path string) (string, FileInfo, error) {
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return "", FileInfo{}, err
+	}
+	info, err := fs.backend.Stat(p)
+	return p, info, err
+}
+
+// helper: calls fn for the node at path (described by info) and everything
+// below it, parents before their children
+func (fs *FileSystem) walk(path string, info FileInfo, fn func(path string, info FileInfo) error) error {
+	return walkBackend(fs.backend, path, info, fn)
+}
+
+// helper: walk, on a backend
+func walkBackend(b Backend, path string, info FileInfo, fn func(path string, info FileInfo) error) error {
+	if err := fn(path, info); err != nil {
+		return err
+	}
+	if !info.IsDir {
+		return nil
+	}
+
+	children, err := b.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := walkBackend(b, joinPath(path, child.Name), child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
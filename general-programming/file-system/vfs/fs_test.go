@@ -0,0 +1,369 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestMkdir uses table driven testing to verify directory creation logic
+func TestMkdir(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(*FileSystem)
+		path      string
+		expectErr bool
+	}{
+		{
+			name:      "Create directory in root",
+			setup:     nil,
+			path:      "/home",
+			expectErr: false,
+		},
+		{
+			name:      "Create nested directory without parent",
+			setup:     nil,
+			path:      "/home/user",
+			expectErr: true, // Should fail because /home doesn't exist
+		},
+		{
+			name: "Create existing directory",
+			setup: func(fs *FileSystem) {
+				_ = fs.Mkdir("/home")
+			},
+			path:      "/home",
+			expectErr: true, // Should fail because it exists
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewFileSystem()
+			if tt.setup != nil {
+				tt.setup(fs)
+			}
+
+			err := fs.Mkdir(tt.path)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Mkdir() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+// TestTouch verifies file creation
+func TestTouch(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/docs")
+
+	// Test 1: Create valid file
+	err := fs.Touch("/docs/note.txt", "content")
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	// Test 2: Create file in non-existent directory
+	err = fs.Touch("/invalid/note.txt", "content")
+	if err == nil {
+		t.Error("Expected error for missing parent directory, got nil")
+	}
+
+	// Test 3: Overwrite existing file (should fail based on our requirements)
+	err = fs.Touch("/docs/note.txt", "new content")
+	if err == nil {
+		t.Error("Expected error when creating existing file, got nil")
+	}
+}
+
+// TestWrite verifies overwriting an existing file
+func TestWrite(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	_ = fs.Touch("/docs/note.txt", "old")
+
+	if err := fs.Write("/docs/note.txt", "new"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if content, _ := fs.Cat("/docs/note.txt"); content != "new" {
+		t.Errorf("Cat() = %q, want %q", content, "new")
+	}
+
+	// Write never creates files
+	if err := fs.Write("/docs/other.txt", "x"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Write() on missing file error = %v, want ErrNotExist", err)
+	}
+	if err := fs.Write("/docs", "x"); !errors.Is(err, ErrIsDir) {
+		t.Errorf("Write() on directory error = %v, want ErrIsDir", err)
+	}
+}
+
+// TestConcurrentAccess hammers one tree from several goroutines (run with -race)
+func TestConcurrentAccess(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/shared")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/shared/f%d", i)
+			for j := 0; j < 50; j++ {
+				_ = fs.Touch(path, "x")
+				_ = fs.Write(path, "y")
+				_, _ = fs.Ls("/shared")
+				_, _ = fs.Cat(path)
+				_ = fs.Rm(path)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if names, _ := fs.Ls("/shared"); len(names) != 0 {
+		t.Errorf("Ls() = %v, want empty", names)
+	}
+}
+
+// TestLs verifies listing contents
+func TestLs(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/usr")
+	_ = fs.Mkdir("/usr/bin")
+	_ = fs.Touch("/usr/config", "data")
+
+	// Expected output sorted
+	expected := []string{"bin", "config"}
+
+	result, err := fs.Ls("/usr")
+	if err != nil {
+		t.Fatalf("Ls failed: %v", err)
+	}
+
+	// Compare slices
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Ls() = %v, want %v", result, expected)
+	}
+}
+
+// TestRecursiveDelete simulates a full lifecycle
+func TestRecursiveDelete(t *testing.T) {
+	fs := NewFileSystem()
+
+	// 1. Setup a tree: /a/b/file.txt
+	_ = fs.Mkdir("/a")
+	_ = fs.Mkdir("/a/b")
+	_ = fs.Touch("/a/b/file.txt", "secret data")
+
+	// 2. Verify file exists
+	content, err := fs.Cat("/a/b/file.txt")
+	if err != nil || content != "secret data" {
+		t.Fatalf("Setup failed, could not read file")
+	}
+
+	// 3. Delete parent /a
+	err = fs.Rm("/a")
+	if err != nil {
+		t.Fatalf("Rm failed: %v", err)
+	}
+
+	// 4. Verify /a is gone
+	_, err = fs.Ls("/a")
+	if err == nil {
+		t.Error("Expected error listing deleted directory /a, got nil")
+	}
+
+	// 5. Verify deep file is gone (Recursive check)
+	_, err = fs.Cat("/a/b/file.txt")
+	if err == nil {
+		t.Error("Expected error reading file in deleted directory, got nil")
+	}
+}
+
+// TestErrors verifies that failures carry the right sentinel and path
+func TestErrors(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	_ = fs.Touch("/docs/note.txt", "content")
+
+	tests := []struct {
+		name   string
+		op     func() error
+		want   error
+		wantOp string
+	}{
+		{"Mkdir existing", func() error { return fs.Mkdir("/docs") }, ErrExist, "mkdir"},
+		{"Mkdir missing parent", func() error { return fs.Mkdir("/a/b") }, ErrNotExist, "mkdir"},
+		{"Touch under a file", func() error { return fs.Touch("/docs/note.txt/x", "") }, ErrNotDir, "touch"},
+		{"Ls a file", func() error { _, err := fs.Ls("/docs/note.txt"); return err }, ErrNotDir, "ls"},
+		{"Cat a directory", func() error { _, err := fs.Cat("/docs"); return err }, ErrIsDir, "cat"},
+		{"Cat missing", func() error { _, err := fs.Cat("/docs/gone.txt"); return err }, ErrNotExist, "cat"},
+		{"Rm root", func() error { return fs.Rm("/") }, ErrPermission, "rm"},
+		{"Empty path", func() error { _, err := fs.Ls(""); return err }, ErrInvalidPath, "ls"},
+		{"Dot-dot component", func() error { return fs.Mkdir("/docs/../x") }, ErrInvalidPath, "mkdir"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			var pe *PathError
+			if !errors.As(err, &pe) || pe.Op != tt.wantOp {
+				t.Errorf("got %#v, want a PathError for op %q", err, tt.wantOp)
+			}
+		})
+	}
+
+	// The io/fs sentinels should match as well
+	if _, err := fs.Cat("/missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Cat() error = %v, want fs.ErrNotExist", err)
+	}
+	if err := fs.Mkdir("/x/../y"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("Mkdir() error = %v, want fs.ErrInvalid", err)
+	}
+}
+
+// TestStat verifies the metadata reported for files and directories
+func TestStat(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	_ = fs.Touch("/docs/note.txt", "hello")
+
+	info, err := fs.Stat("/docs/note.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Name != "note.txt" || info.IsDir || info.Size != 5 || info.ModTime.IsZero() {
+		t.Errorf("Stat() = %+v", info)
+	}
+
+	before := info.ModTime
+	_ = fs.Write("/docs/note.txt", "hello world")
+	info, _ = fs.Stat("/docs/note.txt")
+	if info.Size != 11 || info.ModTime.Before(before) {
+		t.Errorf("Stat() after Write = %+v", info)
+	}
+
+	if info, err := fs.Stat("/"); err != nil || !info.IsDir {
+		t.Errorf("Stat(/) = %+v, %v", info, err)
+	}
+	if _, err := fs.Stat("/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat() on missing path error = %v, want ErrNotExist", err)
+	}
+}
+
+// TestMv verifies renames, moves across directories and the error cases
+func TestMv(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/a")
+	_ = fs.Mkdir("/a/b")
+	_ = fs.Touch("/a/b/file.txt", "data")
+	_ = fs.Mkdir("/c")
+
+	// rename in place
+	if err := fs.Mv("/a/b/file.txt", "/a/b/renamed.txt"); err != nil {
+		t.Fatalf("Mv failed: %v", err)
+	}
+	// move a whole directory
+	if err := fs.Mv("/a/b", "/c/b"); err != nil {
+		t.Fatalf("Mv failed: %v", err)
+	}
+
+	content, err := fs.Cat("/c/b/renamed.txt")
+	if err != nil || content != "data" {
+		t.Errorf("Cat() after Mv = %q, %v", content, err)
+	}
+	if info, _ := fs.Stat("/c/b"); info.Name != "b" {
+		t.Errorf("Stat().Name = %q, want b", info.Name)
+	}
+	if names, _ := fs.Ls("/a"); len(names) != 0 {
+		t.Errorf("Ls(/a) = %v, want empty", names)
+	}
+
+	tests := []struct {
+		name     string
+		src, dst string
+		want     error
+	}{
+		{"Missing source", "/nope", "/x", ErrNotExist},
+		{"Existing destination", "/a", "/c", ErrExist},
+		{"Into itself", "/c", "/c/b/c", ErrInvalidPath},
+		{"Root", "/", "/x", ErrPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := fs.Mv(tt.src, tt.dst); !errors.Is(err, tt.want) {
+				t.Errorf("Mv() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestReplace checks Replace swaps the destination out in one step, and
+// leaves it alone when it can't
+func TestReplace(t *testing.T) {
+	fs := NewFileSystem()
+	fs.SetTrash(true, 0)
+	_ = fs.Touch("/new.txt", "new")
+	_ = fs.Touch("/old.txt", "old")
+	_ = fs.Write("/old.txt", "older")
+	_ = fs.Mkdir("/dir")
+	_ = fs.Mkdir("/empty")
+	_ = fs.Mkdir("/full")
+	_ = fs.Touch("/full/f", "")
+
+	if err := fs.Replace("/new.txt", "/old.txt"); err != nil {
+		t.Fatalf("Replace() failed: %v", err)
+	}
+	if content, _ := fs.Cat("/old.txt"); content != "new" {
+		t.Errorf("Cat() after Replace = %q, want new", content)
+	}
+	if versions, _ := fs.Versions("/old.txt"); len(versions) != 0 {
+		t.Errorf("replaced file's versions survived: %+v", versions)
+	}
+	if trashed, _ := fs.ListTrash(); len(trashed) != 0 {
+		t.Errorf("Replace() trashed %+v", trashed)
+	}
+	if err := fs.Replace("/dir", "/empty"); err != nil {
+		t.Errorf("Replace() of an empty directory failed: %v", err)
+	}
+	if names, _ := fs.Ls("/"); !reflect.DeepEqual(names, []string{"empty", "full", "old.txt"}) {
+		t.Errorf("Ls(/) = %v", names)
+	}
+
+	_ = fs.Touch("/a.txt", "a")
+	lock, _ := fs.WithUser("alice").Lock("/old.txt", ExclusiveLock, 0)
+	tests := []struct {
+		name     string
+		src, dst string
+		want     error
+	}{
+		{"Directory over file", "/empty", "/a.txt", ErrNotDir},
+		{"File over directory", "/a.txt", "/empty", ErrIsDir},
+		{"Over a full directory", "/empty", "/full", ErrExist},
+		{"Over a locked file", "/a.txt", "/old.txt", ErrLocked},
+	}
+	for _, tt := range tests {
+		if err := fs.Replace(tt.src, tt.dst); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Replace() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	_ = lock.Unlock()
+
+	// a move the quota refuses leaves the destination be
+	_ = fs.SetQuota("/full", Quota{MaxBytes: 1})
+	if err := fs.Replace("/a.txt", "/full/f"); err != nil {
+		t.Fatalf("Replace() within the quota failed: %v", err)
+	}
+	_ = fs.Touch("/big.txt", "too big")
+	if err := fs.Replace("/big.txt", "/full/f"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Replace() over quota error = %v, want ErrQuotaExceeded", err)
+	}
+	if content, _ := fs.Cat("/full/f"); content != "a" {
+		t.Errorf("Cat() after a failed Replace = %q, want a", content)
+	}
+}
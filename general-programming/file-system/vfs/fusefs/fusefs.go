@@ -0,0 +1,478 @@
+//go:build linux || darwin
+
+// Package fusefs serves a vfs.FileSystem through FUSE, so the in-memory tree
+// can be inspected and edited with ordinary tools once it is mounted.
+//
+// Lookups, readdir, mkdir, unlink, rmdir and rename map straight onto the
+// FileSystem operations. Open files are buffered: reads and writes go to a
+// per-handle copy of the content, which is written back with a single
+// FileSystem.Write when the handle is flushed (on close). Extended
+// attributes are served in the user namespace.
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"file-system/vfs"
+)
+
+// Mount serves tree at mountpoint until the returned server is unmounted
+// (with Unmount, or `fusermount -u` from outside).
+func Mount(tree *vfs.FileSystem, mountpoint string) (*fuse.Server, error) {
+	// The tree can change behind the kernel's back (e.g. over httpfs), so
+	// don't let it cache entries or attributes.
+	var zero time.Duration
+	opts := &fs.Options{
+		EntryTimeout:    &zero,
+		AttrTimeout:     &zero,
+		NegativeTimeout: &zero,
+		MountOptions: fuse.MountOptions{
+			FsName:      "vfs",
+			Name:        "vfs",
+			DirectMount: true,
+		},
+	}
+	return fs.Mount(mountpoint, &node{tree: tree}, opts)
+}
+
+// node is one file or directory of the mounted tree. It keeps no state
+// besides the tree itself; its vfs path is derived from its place in the
+// inode tree, which go-fuse keeps up to date across renames.
+type node struct {
+	fs.Inode
+	tree *vfs.FileSystem
+
+	mu      sync.Mutex
+	handles map[*handle]bool // open handles, so truncates can reach them
+}
+
+var (
+	_ fs.NodeLookuper  = (*node)(nil)
+	_ fs.NodeReaddirer = (*node)(nil)
+	_ fs.NodeGetattrer = (*node)(nil)
+	_ fs.NodeSetattrer = (*node)(nil)
+	_ fs.NodeOpener    = (*node)(nil)
+	_ fs.NodeCreater   = (*node)(nil)
+	_ fs.NodeMkdirer   = (*node)(nil)
+	_ fs.NodeUnlinker  = (*node)(nil)
+	_ fs.NodeRmdirer   = (*node)(nil)
+	_ fs.NodeRenamer   = (*node)(nil)
+
+	_ fs.NodeGetxattrer    = (*node)(nil)
+	_ fs.NodeSetxattrer    = (*node)(nil)
+	_ fs.NodeRemovexattrer = (*node)(nil)
+	_ fs.NodeListxattrer   = (*node)(nil)
+)
+
+// helper: the vfs path of this node
+func (n *node) path() string {
+	return "/" + n.Path(nil)
+}
+
+// helper: the vfs path of the child called name
+func (n *node) child(name string) string {
+	if p := n.Path(nil); p != "" {
+		return "/" + p + "/" + name
+	}
+	return "/" + name
+}
+
+// helper: returns the inode for a child, reusing the existing one if the
+// kernel already knows it and it still has the same type
+func (n *node) childInode(ctx context.Context, name string, info vfs.FileInfo) *fs.Inode {
+	mode := modeOf(info)
+	if ch := n.GetChild(name); ch != nil && ch.Mode() == mode {
+		return ch
+	}
+	return n.NewInode(ctx, &node{tree: n.tree}, fs.StableAttr{Mode: mode})
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	info, err := n.tree.Stat(n.child(name))
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	fillAttr(&out.Attr, info)
+	return n.childInode(ctx, name, info), fs.OK
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	names, err := n.tree.Ls(n.path())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(names))
+	for _, name := range names {
+		info, err := n.tree.Stat(n.child(name))
+		if err != nil {
+			// removed since Ls; skip it
+			continue
+		}
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: modeOf(info)})
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := n.tree.Stat(n.path())
+	if err != nil {
+		return toErrno(err)
+	}
+	fillAttr(&out.Attr, info)
+
+	// unflushed writes are only visible through the handle
+	if h, ok := f.(*handle); ok {
+		out.Size = uint64(h.size())
+	}
+	return fs.OK
+}
+
+// Setattr only supports changing the size (truncate); other attributes
+// are not stored by the tree and are silently ignored.
+func (n *node) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if size, ok := in.GetSize(); ok {
+		if h, ok := f.(*handle); ok {
+			h.truncate(int(size))
+		} else {
+			// open(O_TRUNC) arrives as a truncate without a handle after
+			// the open, so the buffered copies must be cut as well
+			n.mu.Lock()
+			for h := range n.handles {
+				h.truncate(int(size))
+			}
+			n.mu.Unlock()
+
+			content, err := n.tree.Cat(n.path())
+			if err != nil {
+				return toErrno(err)
+			}
+			if err := n.tree.Write(n.path(), string(resize([]byte(content), int(size)))); err != nil {
+				return toErrno(err)
+			}
+		}
+	}
+	return n.Getattr(ctx, f, out)
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	h := n.open()
+	if flags&syscall.O_TRUNC != 0 {
+		h.dirty = true
+	} else {
+		content, err := n.tree.Cat(n.path())
+		if err != nil {
+			return nil, 0, toErrno(err)
+		}
+		h.data = []byte(content)
+	}
+	// the handle is the source of truth while open; skip the page cache
+	return h, fuse.FOPEN_DIRECT_IO, fs.OK
+}
+
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	path := n.child(name)
+	if err := n.tree.Touch(path, ""); err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	info, err := n.tree.Stat(path)
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	fillAttr(&out.Attr, info)
+	ch := n.childInode(ctx, name, info)
+	return ch, ch.Operations().(*node).open(), fuse.FOPEN_DIRECT_IO, fs.OK
+}
+
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	path := n.child(name)
+	if err := n.tree.Mkdir(path); err != nil {
+		return nil, toErrno(err)
+	}
+	info, err := n.tree.Stat(path)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	fillAttr(&out.Attr, info)
+	return n.childInode(ctx, name, info), fs.OK
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	path := n.child(name)
+	info, err := n.tree.Stat(path)
+	if err != nil {
+		return toErrno(err)
+	}
+	if info.IsDir {
+		return syscall.EISDIR
+	}
+	return toErrno(n.tree.Rm(path))
+}
+
+// Rmdir only removes empty directories, unlike the recursive Rm
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	path := n.child(name)
+	names, err := n.tree.Ls(path)
+	if err != nil {
+		return toErrno(err)
+	}
+	if len(names) > 0 {
+		return syscall.ENOTEMPTY
+	}
+	return toErrno(n.tree.Rm(path))
+}
+
+// renameNoReplace is RENAME_NOREPLACE from renameat2(2); go-fuse only
+// defines RENAME_EXCHANGE
+const renameNoReplace = 0x1
+
+// Rename follows rename(2): an existing file at the destination is
+// replaced, as is an empty directory when moving a directory, atomically
+// (see vfs.FileSystem.Replace).
+func (n *node) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	src := n.child(name)
+	dst := newParent.(*node).child(newName)
+
+	if flags&fs.RENAME_EXCHANGE != 0 {
+		return syscall.ENOTSUP
+	}
+	if flags&renameNoReplace != 0 {
+		return toErrno(n.tree.Mv(src, dst))
+	}
+
+	// Replace refuses a directory that isn't empty with ErrExist, where
+	// rename(2) says ENOTEMPTY
+	err := n.tree.Replace(src, dst)
+	if errors.Is(err, vfs.ErrExist) {
+		if info, _ := n.tree.Stat(dst); info.IsDir {
+			return syscall.ENOTEMPTY
+		}
+	}
+	return toErrno(err)
+}
+
+// Extended attributes show up in the user namespace: an attribute "team"
+// on the tree is "user.team" to getfattr and friends. Other namespaces
+// (security., trusted., ...) are never stored.
+const xattrPrefix = "user."
+
+func (n *node) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	name, ok := strings.CutPrefix(attr, xattrPrefix)
+	if !ok {
+		return 0, fs.ENOATTR
+	}
+	value, err := n.tree.GetXattr(n.path(), name)
+	if err != nil {
+		return 0, toErrno(err)
+	}
+	return fillXattr(dest, []byte(value))
+}
+
+func (n *node) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
+	name, ok := strings.CutPrefix(attr, xattrPrefix)
+	if !ok {
+		return syscall.ENOTSUP
+	}
+	return toErrno(n.tree.SetXattr(n.path(), name, string(data)))
+}
+
+func (n *node) Removexattr(ctx context.Context, attr string) syscall.Errno {
+	name, ok := strings.CutPrefix(attr, xattrPrefix)
+	if !ok {
+		return fs.ENOATTR
+	}
+	return toErrno(n.tree.RemoveXattr(n.path(), name))
+}
+
+// Listxattr returns the names NUL-separated, as listxattr(2) does
+func (n *node) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	names, err := n.tree.ListXattrs(n.path())
+	if errors.Is(err, vfs.ErrUnsupported) {
+		return 0, fs.OK
+	}
+	if err != nil {
+		return 0, toErrno(err)
+	}
+	var list []byte
+	for _, name := range names {
+		list = append(list, xattrPrefix+name+"\x00"...)
+	}
+	return fillXattr(dest, list)
+}
+
+// helper: copies value into dest. An empty dest only asks for the size; one
+// too small for value is an ERANGE.
+func fillXattr(dest, value []byte) (uint32, syscall.Errno) {
+	if len(dest) == 0 {
+		return uint32(len(value)), fs.OK
+	}
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), fs.OK
+}
+
+// helper: creates a handle for this node and tracks it until released
+func (n *node) open() *handle {
+	h := &handle{node: n}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.handles == nil {
+		n.handles = make(map[*handle]bool)
+	}
+	n.handles[h] = true
+	return h
+}
+
+// handle buffers the content of an open file. It writes back through its
+// node, so a file renamed while open is flushed to its new path.
+type handle struct {
+	node *node
+
+	mu    sync.Mutex
+	data  []byte
+	dirty bool
+}
+
+var (
+	_ fs.FileReader   = (*handle)(nil)
+	_ fs.FileWriter   = (*handle)(nil)
+	_ fs.FileFlusher  = (*handle)(nil)
+	_ fs.FileFsyncer  = (*handle)(nil)
+	_ fs.FileReleaser = (*handle)(nil)
+)
+
+func (h *handle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if off >= int64(len(h.data)) {
+		return fuse.ReadResultData(nil), fs.OK
+	}
+	end := min(off+int64(len(dest)), int64(len(h.data)))
+	return fuse.ReadResultData(append([]byte(nil), h.data[off:end]...)), fs.OK
+}
+
+func (h *handle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if end := int(off) + len(data); end > len(h.data) {
+		h.data = resize(h.data, end)
+	}
+	copy(h.data[off:], data)
+	h.dirty = true
+	return uint32(len(data)), fs.OK
+}
+
+func (h *handle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.dirty {
+		return fs.OK
+	}
+	if err := h.node.tree.Write(h.node.path(), string(h.data)); err != nil {
+		return toErrno(err)
+	}
+	h.dirty = false
+	return fs.OK
+}
+
+func (h *handle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+func (h *handle) Release(ctx context.Context) syscall.Errno {
+	h.node.mu.Lock()
+	defer h.node.mu.Unlock()
+	delete(h.node.handles, h)
+	return fs.OK
+}
+
+func (h *handle) size() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.data)
+}
+
+func (h *handle) truncate(size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.data = resize(h.data, size)
+	h.dirty = true
+}
+
+// helper: grows (zero filled) or shrinks data to size
+func resize(data []byte, size int) []byte {
+	if size <= len(data) {
+		return data[:size]
+	}
+	return append(data, make([]byte, size-len(data))...)
+}
+
+// helper: the file type bits for a node
+func modeOf(info vfs.FileInfo) uint32 {
+	if info.IsDir {
+		return syscall.S_IFDIR
+	}
+	return syscall.S_IFREG
+}
+
+// helper: fills FUSE attributes from a FileInfo. The tree has no
+// permissions, so everything is world readable and owner writable.
+func fillAttr(out *fuse.Attr, info vfs.FileInfo) {
+	if info.IsDir {
+		out.Mode = syscall.S_IFDIR | 0755
+		out.Nlink = 2
+	} else {
+		out.Mode = syscall.S_IFREG | 0644
+		out.Nlink = 1
+		out.Size = uint64(info.Size)
+	}
+	mtime := info.ModTime
+	out.SetTimes(&mtime, &mtime, &mtime)
+}
+
+// errnos maps the vfs sentinels onto their errno equivalents
+var errnos = []struct {
+	err   error
+	errno syscall.Errno
+}{
+	{vfs.ErrNotExist, syscall.ENOENT},
+	{vfs.ErrExist, syscall.EEXIST},
+	{vfs.ErrNotDir, syscall.ENOTDIR},
+	{vfs.ErrIsDir, syscall.EISDIR},
+	{vfs.ErrEncrypted, syscall.EACCES},
+	{vfs.ErrPermission, syscall.EPERM},
+	{vfs.ErrNameTooLong, syscall.ENAMETOOLONG},
+	{vfs.ErrPathTooLong, syscall.ENAMETOOLONG},
+	{vfs.ErrInvalidPath, syscall.EINVAL},
+	{vfs.ErrQuotaExceeded, syscall.EDQUOT},
+	{vfs.ErrCrossMount, syscall.EXDEV},
+	{vfs.ErrLocked, syscall.EAGAIN},
+	{vfs.ErrNoXattr, fs.ENOATTR},
+	{vfs.ErrUnsupported, syscall.ENOTSUP},
+}
+
+// helper: converts an error from the tree into an errno for the kernel
+func toErrno(err error) syscall.Errno {
+	if err == nil {
+		return fs.OK
+	}
+	for _, e := range errnos {
+		if errors.Is(err, e.err) {
+			return e.errno
+		}
+	}
+	return syscall.EIO
+}
@@ -0,0 +1,126 @@
+//go:build linux || darwin
+
+package fusefs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"file-system/vfs"
+)
+
+// mountTest mounts a fresh tree, skipping when no fuse device is usable
+func mountTest(t *testing.T) (*vfs.FileSystem, string) {
+	t.Helper()
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("no fuse device:", err)
+	}
+
+	tree := vfs.NewFileSystem()
+	dir := t.TempDir()
+	server, err := Mount(tree, dir)
+	if err != nil {
+		t.Skip("cannot mount:", err)
+	}
+	t.Cleanup(func() { server.Unmount() })
+	return tree, dir
+}
+
+// TestMountedTree exercises the tree with the os package through the mount
+// and checks the changes landed in the FileSystem
+func TestMountedTree(t *testing.T) {
+	tree, dir := mountTest(t)
+	_ = tree.Mkdir("/docs")
+	_ = tree.Touch("/docs/note.txt", "hello")
+
+	// 1. Reads see what's in the tree
+	data, err := os.ReadFile(filepath.Join(dir, "docs", "note.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("ReadFile() = %q, %v", data, err)
+	}
+
+	// 2. Creates, writes and mkdirs land in the tree
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if content, err := tree.Cat("/src/main.go"); err != nil || content != "package main\n" {
+		t.Errorf("Cat() = %q, %v", content, err)
+	}
+
+	// 3. Overwriting truncates, appending extends
+	if err := os.WriteFile(filepath.Join(dir, "docs", "note.txt"), []byte("hi"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "docs", "note.txt"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	_, _ = f.WriteString(" there")
+	_ = f.Close()
+	if content, _ := tree.Cat("/docs/note.txt"); content != "hi there" {
+		t.Errorf("Cat() = %q, want %q", content, "hi there")
+	}
+
+	// 4. Readdir and stat
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"docs", "src"}) || !entries[0].IsDir() {
+		t.Errorf("ReadDir() = %v", names)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "docs", "note.txt")); err != nil || info.Size() != 8 {
+		t.Errorf("Stat() = %v, %v", info, err)
+	}
+
+	// 5. Rename and remove
+	if err := os.Rename(filepath.Join(dir, "src", "main.go"), filepath.Join(dir, "docs", "main.go")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "src")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "docs")); err == nil {
+		t.Error("expected rmdir of a non-empty directory to fail")
+	}
+	if names, _ := tree.Ls("/docs"); !reflect.DeepEqual(names, []string{"main.go", "note.txt"}) {
+		t.Errorf("Ls(/docs) = %v", names)
+	}
+	if _, err := tree.Stat("/src"); err == nil {
+		t.Error("expected /src to be gone")
+	}
+}
+
+// TestExternalChanges checks that changes made directly on the tree show
+// up through the mount without remounting
+func TestExternalChanges(t *testing.T) {
+	tree, dir := mountTest(t)
+	_ = tree.Touch("/a.txt", "one")
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "one" {
+		t.Fatalf("ReadFile() = %q", data)
+	}
+
+	_ = tree.Write("/a.txt", "two two")
+	_ = tree.Touch("/b.txt", "")
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "two two" {
+		t.Errorf("ReadFile() after Write = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); err != nil {
+		t.Errorf("Stat() of new file: %v", err)
+	}
+
+	_ = tree.Rm("/a.txt")
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("Stat() of removed file error = %v", err)
+	}
+}
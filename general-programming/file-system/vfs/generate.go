@@ -0,0 +1,168 @@
+package vfs
+
+import (
+	"cmp"
+	"fmt"
+	iofs "io/fs"
+	"math"
+	"math/rand/v2"
+	"strings"
+)
+
+// SizeDistribution is how the sizes of generated files spread between
+// GenerateOptions.MinSize and MaxSize
+type SizeDistribution int
+
+const (
+	SizeUniform     SizeDistribution = iota // every size equally likely
+	SizeExponential                         // mostly small files and a few large ones, like real trees
+)
+
+// GenerateOptions describe the tree Generate builds. The zero value builds
+// nothing but the root.
+type GenerateOptions struct {
+	// Depth is how many levels of directories go below the root; the
+	// directories at the bottom level only get files
+	Depth int
+	// Dirs and Files are the fan-out: how many subdirectories and files
+	// each directory gets
+	Dirs, Files int
+	// Random varies the fan-out: each directory gets between 0 and twice
+	// Dirs subdirectories and Files files, so the averages stay the same.
+	// Without it every directory gets exactly as many, like a template.
+	Random bool
+
+	// MinSize and MaxSize bound the size of the files, in bytes, spread
+	// as Sizes says
+	MinSize, MaxSize int64
+	Sizes            SizeDistribution
+
+	// DirName and FileName are fmt templates for the names, given the
+	// index of the node in its directory ("dir%d" and "file%d.txt" if
+	// empty)
+	DirName, FileName string
+
+	// Seed makes the tree reproducible: the same options build the same
+	// names, sizes and content every time
+	Seed uint64
+}
+
+// GenerateStats count what Generate made
+type GenerateStats struct {
+	Dirs  int
+	Files int
+	Bytes int64
+}
+
+// generate(root, opts): builds a synthetic tree below the directory at
+// root, creating it if it doesn't exist, for load testing. Files hold
+// random words (so search has something to find) cut to their size. Nodes
+// are made one by one through this handle, so quotas, watchers and the
+// audit log see them all; Generate stops at the first error, leaving what
+// it made so far.
+func (fs *FileSystem) Generate(root string, opts GenerateOptions) (GenerateStats, error) {
+	opts.DirName = cmp.Or(opts.DirName, "dir%d")
+	opts.FileName = cmp.Or(opts.FileName, "file%d.txt")
+	if opts.Depth < 0 || opts.Dirs < 0 || opts.Files < 0 || opts.MinSize < 0 || opts.MaxSize < opts.MinSize ||
+		!validTemplate(opts.DirName) || !validTemplate(opts.FileName) {
+		return GenerateStats{}, pathError("generate", root, iofs.ErrInvalid)
+	}
+
+	info, err := fs.Stat(root)
+	switch {
+	case err == nil && !info.IsDir:
+		return GenerateStats{}, pathError("generate", root, ErrNotDir)
+	case err != nil:
+		if err = fs.Mkdir(root); err != nil {
+			return GenerateStats{}, err
+		}
+	}
+
+	g := &generator{fs: fs, opts: opts, rng: rand.New(rand.NewPCG(opts.Seed, 0))}
+	err = g.dir(root, 0)
+	return g.stats, err
+}
+
+// generator is the state of one Generate
+type generator struct {
+	fs    *FileSystem
+	opts  GenerateOptions
+	rng   *rand.Rand
+	stats GenerateStats
+}
+
+// helper: fills the directory at path, level directories below the root
+func (g *generator) dir(path string, level int) error {
+	for i := range g.count(g.opts.Files) {
+		content := g.content(g.size())
+		if err := g.fs.Touch(joinPath(path, fmt.Sprintf(g.opts.FileName, i)), content); err != nil {
+			return err
+		}
+		g.stats.Files++
+		g.stats.Bytes += int64(len(content))
+	}
+	if level == g.opts.Depth {
+		return nil
+	}
+	for i := range g.count(g.opts.Dirs) {
+		child := joinPath(path, fmt.Sprintf(g.opts.DirName, i))
+		if err := g.fs.Mkdir(child); err != nil {
+			return err
+		}
+		g.stats.Dirs++
+		if err := g.dir(child, level+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper: how many nodes a directory gets, for a fan-out of n
+func (g *generator) count(n int) int {
+	if !g.opts.Random || n == 0 {
+		return n
+	}
+	return g.rng.IntN(2*n + 1)
+}
+
+// helper: the size of the next file
+func (g *generator) size() int64 {
+	lo, hi := g.opts.MinSize, g.opts.MaxSize
+	if lo == hi {
+		return lo
+	}
+	switch g.opts.Sizes {
+	case SizeExponential:
+		// a mean of a tenth of the range, cut off at the top
+		n := g.rng.ExpFloat64() * float64(hi-lo) / 10
+		return lo + int64(math.Min(n, float64(hi-lo)))
+	default:
+		return lo + g.rng.Int64N(hi-lo+1)
+	}
+}
+
+// loremWords make up the content of generated files
+var loremWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit
+	sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad
+	minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea
+	commodo consequat`)
+
+// helper: size bytes of random words
+func (g *generator) content(size int64) string {
+	var b strings.Builder
+	b.Grow(int(size) + 16)
+	for int64(b.Len()) < size {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(loremWords[g.rng.IntN(len(loremWords))])
+	}
+	return b.String()[:size]
+}
+
+// helper: reports whether a name template makes a different, valid name
+// for each index
+func validTemplate(tmpl string) bool {
+	a, b := fmt.Sprintf(tmpl, 0), fmt.Sprintf(tmpl, 1)
+	return a != b && !strings.Contains(tmpl, "/") && !strings.Contains(a, "%!")
+}
@@ -0,0 +1,105 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"reflect"
+	"testing"
+)
+
+// helper: every path below root with its content ("" for directories)
+func treeContents(t *testing.T, fs *FileSystem, root string) map[string]string {
+	t.Helper()
+	entries, err := fs.List(root, ListOptions{All: true, Recursive: true})
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	result := make(map[string]string)
+	for _, e := range entries {
+		if !e.IsDir {
+			result[e.Path], _ = fs.Cat(joinPath(root, e.Path))
+		} else {
+			result[e.Path] = ""
+		}
+	}
+	return result
+}
+
+// TestGenerate checks a templated tree has exactly the shape asked for
+func TestGenerate(t *testing.T) {
+	fs := NewFileSystem()
+	opts := GenerateOptions{Depth: 2, Dirs: 2, Files: 3, MinSize: 10, MaxSize: 100, DirName: "d%02d"}
+	stats, err := fs.Generate("/load", opts)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	// 2 + 4 directories, and 3 files in each of them and the root
+	if want := (GenerateStats{Dirs: 6, Files: 21, Bytes: stats.Bytes}); stats != want {
+		t.Errorf("Generate() = %+v, want %+v", stats, want)
+	}
+
+	var bytes int64
+	for p, content := range treeContents(t, fs, "/load") {
+		info, _ := fs.Stat(joinPath("/load", p))
+		if info.IsDir {
+			continue
+		}
+		if info.Size < 10 || info.Size > 100 {
+			t.Errorf("%s has %d bytes, want 10 to 100", p, info.Size)
+		}
+		bytes += int64(len(content))
+	}
+	if bytes != stats.Bytes {
+		t.Errorf("files hold %d bytes, Generate() counted %d", bytes, stats.Bytes)
+	}
+	if _, err := fs.Stat("/load/d01/d00/file2.txt"); err != nil {
+		t.Errorf("Stat() of a templated name failed: %v", err)
+	}
+}
+
+// TestGenerateSeed checks the same seed builds the same random tree
+func TestGenerateSeed(t *testing.T) {
+	opts := GenerateOptions{Depth: 3, Dirs: 3, Files: 4, Random: true, MaxSize: 2000, Sizes: SizeExponential, Seed: 42}
+	trees := make([]map[string]string, 3)
+	for i := range trees {
+		fs := NewFileSystem()
+		if i == 2 {
+			opts.Seed = 7
+		}
+		if _, err := fs.Generate("/", opts); err != nil {
+			t.Fatalf("Generate() failed: %v", err)
+		}
+		trees[i] = treeContents(t, fs, "/")
+	}
+	if !reflect.DeepEqual(trees[0], trees[1]) {
+		t.Error("same seed built different trees")
+	}
+	if reflect.DeepEqual(trees[0], trees[2]) {
+		t.Error("different seeds built the same tree")
+	}
+}
+
+// TestGenerateErrors checks invalid options are refused
+func TestGenerateErrors(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Touch("/file", "")
+
+	tests := []struct {
+		name string
+		root string
+		opts GenerateOptions
+		want error
+	}{
+		{"negative depth", "/a", GenerateOptions{Depth: -1}, iofs.ErrInvalid},
+		{"sizes reversed", "/a", GenerateOptions{MinSize: 10, MaxSize: 5}, iofs.ErrInvalid},
+		{"constant name", "/a", GenerateOptions{FileName: "same"}, iofs.ErrInvalid},
+		{"nested name", "/a", GenerateOptions{DirName: "x/%d"}, iofs.ErrInvalid},
+		{"root is a file", "/file", GenerateOptions{}, ErrNotDir},
+		{"root has no parent", "/missing/a", GenerateOptions{}, ErrNotExist},
+	}
+	for _, tt := range tests {
+		if _, err := fs.Generate(tt.root, tt.opts); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Generate() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
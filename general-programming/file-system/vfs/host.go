@@ -0,0 +1,214 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// HostBackend passes the tree through to a directory on the host, so the
+// FileSystem API (and the shell, server and FUSE mount on top of it) can
+// work on real files. Nothing outside the directory is reachable, not even
+// through symlinks. Host files have no vfs owner, so Owner is always empty
+// and user quotas only count nodes in the other backends. Hash is not
+// computed either: it would mean reading every file on every Stat.
+type HostBackend struct {
+	root *os.Root
+}
+
+// NewHostBackend opens the existing directory dir as a backend
+func NewHostBackend(dir string) (*HostBackend, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &HostBackend{root: root}, nil
+}
+
+// Close releases the directory
+func (h *HostBackend) Close() error {
+	return h.root.Close()
+}
+
+func (h *HostBackend) Stat(path string) (FileInfo, error) {
+	fi, err := h.root.Stat(hostPath(path))
+	if err != nil {
+		return FileInfo{}, hostError(err)
+	}
+	info := hostInfo(fi)
+	if isRoot(path) {
+		info.Name = "/"
+	}
+	return info, nil
+}
+
+func (h *HostBackend) ReadDir(path string) ([]FileInfo, error) {
+	fi, err := h.root.Stat(hostPath(path))
+	if err != nil {
+		return nil, hostError(err)
+	}
+	if !fi.IsDir() {
+		return nil, ErrNotDir
+	}
+
+	dir, err := h.root.Open(hostPath(path))
+	if err != nil {
+		return nil, hostError(err)
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, hostError(err)
+	}
+
+	result := make([]FileInfo, 0, len(names))
+	for _, name := range names {
+		// Stat follows symlinks; dangling ones and those leaving the
+		// directory are skipped
+		fi, err := h.root.Stat(hostPath(joinPath(path, name)))
+		if err != nil {
+			continue
+		}
+		result = append(result, hostInfo(fi))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (h *HostBackend) Mkdir(path, owner string) error {
+	return hostError(h.root.Mkdir(hostPath(path), 0o755))
+}
+
+func (h *HostBackend) Create(path, content, owner string) error {
+	f, err := h.root.OpenFile(hostPath(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return hostError(err)
+	}
+	return h.writeAndClose(f, content)
+}
+
+func (h *HostBackend) ReadFile(path string) (string, error) {
+	data, err := h.root.ReadFile(hostPath(path))
+	if err != nil {
+		return "", hostError(err)
+	}
+	return string(data), nil
+}
+
+// Open reads the host file directly, so unlike the memory backend the
+// reader sees writes made while it is open
+func (h *HostBackend) Open(path string) (io.ReadCloser, error) {
+	f, err := h.root.Open(hostPath(path))
+	if err != nil {
+		return nil, hostError(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, hostError(err)
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, ErrIsDir
+	}
+	return f, nil
+}
+
+func (h *HostBackend) WriteFile(path, content string) error {
+	fi, err := h.root.Stat(hostPath(path))
+	if err != nil {
+		return hostError(err)
+	}
+	if fi.IsDir() {
+		return ErrIsDir
+	}
+
+	f, err := h.root.OpenFile(hostPath(path), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return hostError(err)
+	}
+	return h.writeAndClose(f, content)
+}
+
+func (h *HostBackend) Remove(path string) error {
+	if _, err := h.root.Lstat(hostPath(path)); err != nil {
+		return hostError(err)
+	}
+	return hostError(h.root.RemoveAll(hostPath(path)))
+}
+
+func (h *HostBackend) Rename(oldpath, newpath string) error {
+	if _, err := h.root.Lstat(hostPath(oldpath)); err != nil {
+		return hostError(err)
+	}
+	// os.Rename would replace an existing file
+	if _, err := h.root.Lstat(hostPath(newpath)); err == nil {
+		return ErrExist
+	}
+	return hostError(h.root.Rename(hostPath(oldpath), hostPath(newpath)))
+}
+
+func (h *HostBackend) writeAndClose(f *os.File, content string) error {
+	_, err := f.WriteString(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return hostError(err)
+}
+
+// helper: the name of a vfs path relative to the root directory
+func hostPath(path string) string {
+	if isRoot(path) {
+		return "."
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+// helper: builds the FileInfo for a host file
+func hostInfo(fi iofs.FileInfo) FileInfo {
+	info := FileInfo{
+		Name:    fi.Name(),
+		IsDir:   fi.IsDir(),
+		ModTime: fi.ModTime(),
+	}
+	if !info.IsDir {
+		info.Size = fi.Size()
+		info.PhysicalSize = fi.Size()
+	}
+	return info
+}
+
+// helper: turns an error from the os package into the matching sentinel,
+// dropping the host path it mentions. nil stays nil.
+func hostError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrNotDir
+	case errors.Is(err, syscall.EISDIR):
+		return ErrIsDir
+	case errors.Is(err, syscall.EINVAL):
+		return ErrInvalidPath
+	case errors.Is(err, iofs.ErrNotExist):
+		return ErrNotExist
+	case errors.Is(err, iofs.ErrExist):
+		return ErrExist
+	case errors.Is(err, iofs.ErrPermission):
+		return ErrPermission
+	}
+
+	var pe *PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		return le.Err
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+//go:build linux
+
+package vfs
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// host attributes live in the user namespace; the vfs sees them without
+// the prefix
+const hostXattrPrefix = "user."
+
+func (h *HostBackend) Xattrs(path string) (map[string]string, error) {
+	f, err := h.root.Open(hostPath(path))
+	if err != nil {
+		return nil, hostError(err)
+	}
+	defer f.Close()
+	fd := int(f.Fd())
+
+	list, err := readXattr(func(buf []byte) (int, error) { return unix.Flistxattr(fd, buf) })
+	if err != nil {
+		return nil, hostXattrError(err)
+	}
+
+	var attrs map[string]string
+	for _, name := range strings.Split(string(list), "\x00") {
+		if !strings.HasPrefix(name, hostXattrPrefix) {
+			continue
+		}
+		value, err := readXattr(func(buf []byte) (int, error) { return unix.Fgetxattr(fd, name, buf) })
+		if err != nil {
+			return nil, hostXattrError(err)
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		attrs[strings.TrimPrefix(name, hostXattrPrefix)] = string(value)
+	}
+	return attrs, nil
+}
+
+func (h *HostBackend) SetXattr(path, name, value string) error {
+	return h.withFd(path, func(fd int) error {
+		return unix.Fsetxattr(fd, hostXattrPrefix+name, []byte(value), 0)
+	})
+}
+
+func (h *HostBackend) RemoveXattr(path, name string) error {
+	return h.withFd(path, func(fd int) error {
+		return unix.Fremovexattr(fd, hostXattrPrefix+name)
+	})
+}
+
+// helper: runs fn on a descriptor for the node at path, opened through the
+// root so symlinks can't lead outside it
+func (h *HostBackend) withFd(path string, fn func(fd int) error) error {
+	f, err := h.root.Open(hostPath(path))
+	if err != nil {
+		return hostError(err)
+	}
+	defer f.Close()
+	return hostXattrError(fn(int(f.Fd())))
+}
+
+// helper: calls read with a buffer large enough for the result, asking for
+// the size first and trying again if the value grew in between
+func readXattr(read func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := read(buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// helper: like hostError, for the errors specific to attributes
+func hostXattrError(err error) error {
+	switch {
+	case errors.Is(err, unix.ENODATA):
+		return ErrNoXattr
+	case errors.Is(err, unix.ENOTSUP):
+		return ErrUnsupported
+	}
+	return hostError(err)
+}
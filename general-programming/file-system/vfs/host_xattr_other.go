@@ -0,0 +1,17 @@
+//go:build !linux
+
+package vfs
+
+// Host attributes are only supported on linux.
+
+func (h *HostBackend) Xattrs(path string) (map[string]string, error) {
+	return nil, ErrUnsupported
+}
+
+func (h *HostBackend) SetXattr(path, name, value string) error {
+	return ErrUnsupported
+}
+
+func (h *HostBackend) RemoveXattr(path, name string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,185 @@
+package httpfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"file-system/vfs"
+)
+
+// Client talks to a Handler and offers the same operations as a local
+// vfs.FileSystem. Errors come back as *vfs.PathError wrapping the same
+// sentinels, so errors.Is works the same way against either.
+type Client struct {
+	base  *url.URL
+	http  *http.Client
+	user  string
+	token string
+}
+
+// NewClient returns a client for the server at baseURL, e.g. "http://localhost:8080"
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+	return &Client{base: u, http: http.DefaultClient}, nil
+}
+
+// WithUser returns a client whose requests act as user on the server, for
+// a server that trusts the UserHeader
+func (c *Client) WithUser(user string) *Client {
+	other := *c
+	other.user = user
+	return &other
+}
+
+// WithToken returns a client whose requests authenticate with a bearer
+// token, for a server with SetTokens; they act as the token's user
+func (c *Client) WithToken(token string) *Client {
+	other := *c
+	other.token = token
+	return &other
+}
+
+func (c *Client) Mkdir(path string) error {
+	return c.do("mkdir", http.MethodPost, path, createRequest{Type: TypeDirectory}, nil)
+}
+
+func (c *Client) Touch(path string, content string) error {
+	return c.do("touch", http.MethodPost, path, createRequest{Type: TypeFile, Content: content}, nil)
+}
+
+func (c *Client) Write(path string, content string) error {
+	return c.do("write", http.MethodPut, path, writeRequest{Content: content}, nil)
+}
+
+func (c *Client) Ls(path string) ([]string, error) {
+	var resp nodeResponse
+	if err := c.do("ls", http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Type != TypeDirectory {
+		return nil, &vfs.PathError{Op: "ls", Path: path, Err: vfs.ErrNotDir}
+	}
+	return resp.Entries, nil
+}
+
+func (c *Client) Cat(path string) (string, error) {
+	var resp nodeResponse
+	if err := c.do("cat", http.MethodGet, path, nil, &resp); err != nil {
+		return "", err
+	}
+	if resp.Type != TypeFile {
+		return "", &vfs.PathError{Op: "cat", Path: path, Err: vfs.ErrIsDir}
+	}
+	return resp.Content, nil
+}
+
+func (c *Client) Rm(path string) error {
+	return c.do("rm", http.MethodDelete, path, nil, nil)
+}
+
+// helper: sends one request and decodes the response into out (if non-nil).
+// op and path are only used to label errors that never reached the server.
+func (c *Client) do(op, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return &vfs.PathError{Op: op, Path: path, Err: err}
+		}
+		body = bytes.NewReader(data)
+	}
+
+	target, err := c.nodeURL(path)
+	if err != nil {
+		return &vfs.PathError{Op: op, Path: path, Err: err}
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return &vfs.PathError{Op: op, Path: path, Err: err}
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.user != "" {
+		req.Header.Set(UserHeader, c.user)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &vfs.PathError{Op: op, Path: path, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return decodeError(op, path, resp)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return &vfs.PathError{Op: op, Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// helper: builds the resource url for a vfs path, escaping each component.
+// "." and ".." are rejected here because the server's mux would clean them
+// away (and redirect) before the FileSystem ever saw them.
+func (c *Client) nodeURL(path string) (string, error) {
+	if path == "" {
+		return "", vfs.ErrInvalidPath
+	}
+
+	var parts []string
+	for _, p := range strings.Split(path, "/") {
+		switch p {
+		case "":
+			continue
+		case ".", "..":
+			return "", vfs.ErrInvalidPath
+		}
+		parts = append(parts, url.PathEscape(p))
+	}
+	return strings.TrimSuffix(c.base.String(), "/") + "/fs/" + strings.Join(parts, "/"), nil
+}
+
+// helper: turns an error response back into a *vfs.PathError
+func decodeError(op, path string, resp *http.Response) error {
+	var e errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Code == "" {
+		return &vfs.PathError{Op: op, Path: path, Err: fmt.Errorf("server returned %s", resp.Status)}
+	}
+
+	if e.Op != "" {
+		op = e.Op
+	}
+	if e.Path != "" {
+		path = e.Path
+	}
+
+	err := errorFor(e.Code)
+	if err == nil {
+		// not one of ours; keep the server's message
+		msg := e.Error
+		if prefix := op + " " + path + ": "; strings.HasPrefix(msg, prefix) {
+			msg = strings.TrimPrefix(msg, prefix)
+		}
+		err = errors.New(msg)
+	}
+	return &vfs.PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,106 @@
+// Package httpfs exposes a vfs.FileSystem over a JSON HTTP API and provides
+// a Client that speaks it, so several tools can drive one shared tree.
+//
+// Every node is a resource under /fs/, addressed by its path:
+//
+//	GET    /fs/{path}   list a directory or read a file
+//	POST   /fs/{path}   create a directory or file
+//	PUT    /fs/{path}   replace a file's content
+//	DELETE /fs/{path}   remove a file or directory recursively
+//
+// Requests act as the handler's own FileSystem user, unless it knows better:
+// with SetTokens, every request must carry a bearer token and acts as the
+// token's user; with TrustUserHeader (for a server behind a proxy that
+// authenticates users itself), requests act as the user named in the
+// UserHeader. Failures are reported as an errorResponse with a status code
+// derived from the vfs sentinel the operation failed with.
+package httpfs
+
+import (
+	"errors"
+	"net/http"
+
+	"file-system/vfs"
+)
+
+// UserHeader names the user a request acts as, when the handler trusts it
+const UserHeader = "X-Vfs-User"
+
+// MaxBodyBytes is the largest request body a handler reads
+const MaxBodyBytes = 64 << 20
+
+// node types used in requests and responses
+const (
+	TypeFile      = "file"
+	TypeDirectory = "directory"
+)
+
+// nodeResponse is the body of a successful GET
+type nodeResponse struct {
+	Type    string   `json:"type"`
+	Entries []string `json:"entries,omitempty"`
+	Content string   `json:"content,omitempty"`
+}
+
+// createRequest is the body of a POST; writeRequest the body of a PUT
+type createRequest struct {
+	Type    string `json:"type"`
+	Content string `json:"content,omitempty"`
+}
+
+type writeRequest struct {
+	Content string `json:"content"`
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	Op    string `json:"op,omitempty"`
+	Path  string `json:"path,omitempty"`
+}
+
+// errorCodes maps vfs sentinels to wire codes and HTTP status codes.
+// The client uses the same table to turn a code back into a sentinel.
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{vfs.ErrNotExist, "not_exist", http.StatusNotFound},
+	{vfs.ErrExist, "exist", http.StatusConflict},
+	{vfs.ErrNotDir, "not_dir", http.StatusConflict},
+	{vfs.ErrIsDir, "is_dir", http.StatusConflict},
+	{vfs.ErrEncrypted, "encrypted", http.StatusForbidden},
+	{vfs.ErrPermission, "permission", http.StatusForbidden},
+	{vfs.ErrNameTooLong, "name_too_long", http.StatusBadRequest},
+	{vfs.ErrPathTooLong, "path_too_long", http.StatusBadRequest},
+	{vfs.ErrReservedName, "reserved_name", http.StatusBadRequest},
+	{vfs.ErrInvalidChar, "invalid_char", http.StatusBadRequest},
+	{vfs.ErrInvalidPath, "invalid_path", http.StatusBadRequest},
+	{vfs.ErrQuotaExceeded, "quota_exceeded", http.StatusInsufficientStorage},
+	{vfs.ErrCrossMount, "cross_mount", http.StatusConflict},
+	{vfs.ErrLocked, "locked", http.StatusLocked},
+	{vfs.ErrNoXattr, "no_xattr", http.StatusNotFound},
+	{vfs.ErrUnsupported, "unsupported", http.StatusNotImplemented},
+}
+
+// helper: finds the code and status for err, defaulting to an internal error
+func codeFor(err error) (string, int) {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code, c.status
+		}
+	}
+	return "internal", http.StatusInternalServerError
+}
+
+// helper: finds the sentinel for a wire code, or nil if it is unknown
+func errorFor(code string) error {
+	for _, c := range errorCodes {
+		if c.code == code {
+			return c.err
+		}
+	}
+	return nil
+}
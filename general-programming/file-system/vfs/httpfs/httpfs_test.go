@@ -0,0 +1,198 @@
+package httpfs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"file-system/vfs"
+)
+
+func newTestClient(t *testing.T) (*Client, *vfs.FileSystem) {
+	t.Helper()
+	return newTestClientFor(t, func(*Handler) {})
+}
+
+// helper: newTestClient, with the handler set up by setup
+func newTestClientFor(t *testing.T, setup func(h *Handler)) (*Client, *vfs.FileSystem) {
+	t.Helper()
+	fs := vfs.NewFileSystem()
+	h := NewHandler(fs)
+	setup(h)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return c, fs
+}
+
+// TestClientRoundTrip drives a remote tree through the client and checks
+// the server-side FileSystem sees the same thing
+func TestClientRoundTrip(t *testing.T) {
+	c, fs := newTestClient(t)
+
+	if err := c.Mkdir("/home"); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := c.Touch("/home/note.txt", "hello world"); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if err := c.Write("/home/note.txt", "hello again"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	names, err := c.Ls("/")
+	if err != nil || !reflect.DeepEqual(names, []string{"home"}) {
+		t.Errorf("Ls(/) = %v, %v", names, err)
+	}
+
+	content, err := c.Cat("/home/note.txt")
+	if err != nil || content != "hello again" {
+		t.Errorf("Cat() = %q, %v", content, err)
+	}
+	if local, _ := fs.Cat("/home/note.txt"); local != "hello again" {
+		t.Errorf("server side content = %q", local)
+	}
+
+	if err := c.Rm("/home"); err != nil {
+		t.Fatalf("Rm failed: %v", err)
+	}
+	if _, err := fs.Ls("/home"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("server still has /home: %v", err)
+	}
+}
+
+// TestClientErrors checks the sentinels survive the trip over the wire
+func TestClientErrors(t *testing.T) {
+	c, _ := newTestClient(t)
+	_ = c.Mkdir("/docs")
+	_ = c.Touch("/docs/a.txt", "a")
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"Mkdir existing", func() error { return c.Mkdir("/docs") }, vfs.ErrExist},
+		{"Cat missing", func() error { _, err := c.Cat("/nope"); return err }, vfs.ErrNotExist},
+		{"Cat directory", func() error { _, err := c.Cat("/docs"); return err }, vfs.ErrIsDir},
+		{"Ls file", func() error { _, err := c.Ls("/docs/a.txt"); return err }, vfs.ErrNotDir},
+		{"Write directory", func() error { return c.Write("/docs", "x") }, vfs.ErrIsDir},
+		{"Rm root", func() error { return c.Rm("/") }, vfs.ErrPermission},
+		{"Dot-dot", func() error { return c.Mkdir("/docs/../x") }, vfs.ErrInvalidPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			var pe *vfs.PathError
+			if !errors.As(err, &pe) {
+				t.Errorf("got %T, want *vfs.PathError", err)
+			}
+		})
+	}
+}
+
+// TestStatusCodes checks the raw HTTP status codes mapped from the errors
+func TestStatusCodes(t *testing.T) {
+	fs := vfs.NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	h := NewHandler(fs)
+
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{"GET", "/fs/", "", http.StatusOK},
+		{"GET", "/fs/missing", "", http.StatusNotFound},
+		{"POST", "/fs/docs", `{"type":"directory"}`, http.StatusConflict},
+		{"POST", "/fs/docs/a.txt", `{"type":"file","content":"x"}`, http.StatusCreated},
+		{"POST", "/fs/docs/b", `{"type":"socket"}`, http.StatusBadRequest},
+		{"POST", "/fs/docs/b", `not json`, http.StatusBadRequest},
+		{"PUT", "/fs/docs/a.txt", `{"content":"y"}`, http.StatusNoContent},
+		{"DELETE", "/fs/", "", http.StatusForbidden},
+		{"DELETE", "/fs/docs", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d (%s)", tt.method, tt.target, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+// TestClientUser checks requests act as the client's user, so ownership and
+// user quotas apply over the wire, when the server trusts the header
+func TestClientUser(t *testing.T) {
+	c, fs := newTestClientFor(t, func(h *Handler) { h.TrustUserHeader(true) })
+	fs.SetUserQuota("alice", vfs.Quota{MaxInodes: 1})
+	alice := c.WithUser("alice")
+
+	if err := alice.Touch("/a.txt", "hi"); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if info, _ := fs.Stat("/a.txt"); info.Owner != "alice" {
+		t.Errorf("Owner = %q, want alice", info.Owner)
+	}
+	if err := alice.Touch("/b.txt", ""); !errors.Is(err, vfs.ErrQuotaExceeded) {
+		t.Errorf("Touch() over quota error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := c.Touch("/b.txt", ""); err != nil {
+		t.Errorf("Touch() as the default user failed: %v", err)
+	}
+}
+
+// TestClientAuth checks the user header is refused unless trusted, and
+// tokens decide who a request acts as
+func TestClientAuth(t *testing.T) {
+	untrusted, _ := newTestClient(t)
+	if err := untrusted.WithUser("alice").Mkdir("/a"); !errors.Is(err, vfs.ErrPermission) {
+		t.Errorf("Mkdir() with an untrusted user header error = %v, want ErrPermission", err)
+	}
+
+	c, fs := newTestClientFor(t, func(h *Handler) {
+		h.SetTokens(map[string]string{"alice-secret": "alice", "bob-secret": "bob"})
+	})
+	tests := []struct {
+		name   string
+		client *Client
+		ok     bool
+	}{
+		{"no token", c, false},
+		{"unknown token", c.WithToken("guess"), false},
+		{"token of someone else", c.WithToken("bob-secret").WithUser("alice"), false},
+		{"token", c.WithToken("alice-secret"), true},
+	}
+	for _, tt := range tests {
+		err := tt.client.Mkdir("/" + strings.ReplaceAll(tt.name, " ", "-"))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: Mkdir() error = %v", tt.name, err)
+		}
+	}
+	if info, _ := fs.Stat("/token"); info.Owner != "alice" {
+		t.Errorf("Owner = %q, want alice", info.Owner)
+	}
+}
+
+// TestBodyLimit checks request bodies beyond MaxBodyBytes are refused
+func TestBodyLimit(t *testing.T) {
+	h := NewHandler(vfs.NewFileSystem())
+	body := `{"type":"file","content":"` + strings.Repeat("x", MaxBodyBytes) + `"}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/fs/big", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST of %d bytes = %d, want %d", len(body), rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,213 @@
+package httpfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"file-system/vfs"
+)
+
+// Handler serves a FileSystem over HTTP. Its settings must be made before
+// it serves its first request.
+type Handler struct {
+	fs  *vfs.FileSystem
+	mux *http.ServeMux
+
+	tokens          map[[sha256.Size]byte]string // user, by hash of bearer token; nil for none
+	trustUserHeader bool
+}
+
+func NewHandler(fs *vfs.FileSystem) *Handler {
+	h := &Handler{fs: fs, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /fs/{path...}", h.get)
+	h.mux.HandleFunc("POST /fs/{path...}", h.create)
+	h.mux.HandleFunc("PUT /fs/{path...}", h.write)
+	h.mux.HandleFunc("DELETE /fs/{path...}", h.remove)
+	return h
+}
+
+// SetTokens makes every request authenticate with one of tokens, as
+// "Authorization: Bearer <token>", and act as its user (token -> user).
+// Requests without a known token fail with 401.
+func (h *Handler) SetTokens(tokens map[string]string) {
+	h.tokens = make(map[[sha256.Size]byte]string, len(tokens))
+	for token, user := range tokens {
+		// looked up by hash, so how long a lookup takes says nothing about
+		// the tokens
+		h.tokens[sha256.Sum256([]byte(token))] = user
+	}
+}
+
+// TrustUserHeader makes requests act as the user named in their
+// UserHeader, for a handler behind something that authenticates users and
+// sets it. Otherwise a request carrying it fails with 403, rather than
+// silently acting as someone else.
+func (h *Handler) TrustUserHeader(trust bool) {
+	h.trustUserHeader = trust
+}
+
+// userKey is the context key of the user a request acts as
+type userKey struct{}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, status, msg := h.authenticate(r)
+	if status != 0 {
+		code := "unauthorized"
+		if status == http.StatusForbidden {
+			code = "permission"
+		}
+		writeJSON(w, status, errorResponse{Error: msg, Code: code})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	if user != "" {
+		r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// helper: the user r acts as ("" for the handler's own), or the status and
+// message to refuse it with
+func (h *Handler) authenticate(r *http.Request) (string, int, string) {
+	if h.tokens != nil {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		user, known := h.tokens[sha256.Sum256([]byte(token))]
+		if !ok || !known {
+			return "", http.StatusUnauthorized, "missing or unknown bearer token"
+		}
+		if header := r.Header.Get(UserHeader); header != "" && header != user {
+			return "", http.StatusForbidden, "token doesn't belong to " + header
+		}
+		return user, 0, ""
+	}
+	header := r.Header.Get(UserHeader)
+	if header != "" && !h.trustUserHeader {
+		return "", http.StatusForbidden, "the server doesn't trust " + UserHeader
+	}
+	return header, 0, ""
+}
+
+// GET: lists a directory or returns a file's content
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	path := nodePath(r)
+	fs := h.fsFor(r)
+
+	entries, err := fs.Ls(path)
+	if err == nil {
+		writeJSON(w, http.StatusOK, nodeResponse{Type: TypeDirectory, Entries: entries})
+		return
+	}
+	if !errors.Is(err, vfs.ErrNotDir) {
+		writeError(w, err)
+		return
+	}
+
+	content, err := fs.Cat(path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nodeResponse{Type: TypeFile, Content: content})
+}
+
+// POST: creates a directory or a file
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if !readBody(w, r, &req) {
+		return
+	}
+
+	path := nodePath(r)
+	fs := h.fsFor(r)
+	var err error
+	switch req.Type {
+	case TypeDirectory:
+		err = fs.Mkdir(path)
+	case TypeFile:
+		err = fs.Touch(path, req.Content)
+	default:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "type must be file or directory", Code: "bad_request"})
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// PUT: replaces a file's content
+func (h *Handler) write(w http.ResponseWriter, r *http.Request) {
+	var req writeRequest
+	if !readBody(w, r, &req) {
+		return
+	}
+
+	if err := h.fsFor(r).Write(nodePath(r), req.Content); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE: removes a node recursively
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request) {
+	if err := h.fsFor(r).Rm(nodePath(r)); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// helper: the handle a request acts through, for the user ServeHTTP
+// authenticated
+func (h *Handler) fsFor(r *http.Request) *vfs.FileSystem {
+	if user, ok := r.Context().Value(userKey{}).(string); ok {
+		return h.fs.WithUser(user)
+	}
+	return h.fs
+}
+
+// helper: the vfs path a request addresses ("/fs/" itself is the root)
+func nodePath(r *http.Request) string {
+	return "/" + r.PathValue("path")
+}
+
+// helper: decodes the request body into v, answering the request with an
+// error if it can't
+func readBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "request body too large", Code: "too_large"})
+		return false
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body", Code: "bad_request"})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code, status := codeFor(err)
+	resp := errorResponse{Error: err.Error(), Code: code}
+
+	var pe *vfs.PathError
+	if errors.As(err, &pe) {
+		resp.Op = pe.Op
+		resp.Path = pe.Path
+	}
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,97 @@
+package vfs
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// ListSort is the order List returns entries in
+type ListSort int
+
+const (
+	SortByName ListSort = iota // by name
+	SortBySize                 // largest first, then by name
+	SortByTime                 // most recently modified first, then by name
+)
+
+// ListOptions change what List returns. The zero value lists the visible
+// entries of one directory by name, like ls.
+type ListOptions struct {
+	// All includes hidden entries, whose names start with "."
+	All bool
+	// Recursive also lists every directory below, like ls -R: a
+	// directory's entries come first, then those of each of its
+	// subdirectories in turn
+	Recursive bool
+	Sort      ListSort
+	// Reverse reverses the order of each directory's entries
+	Reverse bool
+}
+
+// ListEntry is a node returned by List. Path is relative to the listed
+// directory ("a.txt", or "sub/a.txt" in a recursive listing).
+type ListEntry struct {
+	Path string
+	FileInfo
+}
+
+// helper: reports whether a node named name is hidden by default
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// list(path, opts): describes the entries of the directory at path
+func (fs *FileSystem) List(path string, opts ListOptions) ([]ListEntry, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return nil, pathError("ls", path, err)
+	}
+
+	var result []ListEntry
+	if err := fs.listDir(p, ".", opts, &result); err != nil {
+		return nil, pathError("ls", path, err)
+	}
+	return result, nil
+}
+
+// helper: appends the entries of the directory at p, found at rel below
+// the listed one, and with opts.Recursive those of its subdirectories
+func (fs *FileSystem) listDir(p, rel string, opts ListOptions, result *[]ListEntry) error {
+	entries, err := fs.backend.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	if !opts.All {
+		entries = slices.DeleteFunc(entries, func(e FileInfo) bool { return isHidden(e.Name) })
+	}
+
+	// backends already sort by name, which breaks the other sorts' ties
+	switch opts.Sort {
+	case SortBySize:
+		slices.SortStableFunc(entries, func(a, b FileInfo) int { return cmp.Compare(b.Size, a.Size) })
+	case SortByTime:
+		slices.SortStableFunc(entries, func(a, b FileInfo) int { return b.ModTime.Compare(a.ModTime) })
+	}
+	if opts.Reverse {
+		slices.Reverse(entries)
+	}
+
+	for _, e := range entries {
+		*result = append(*result, ListEntry{Path: relPath(rel, e.Name), FileInfo: e})
+	}
+	if !opts.Recursive {
+		return nil
+	}
+	for _, e := range entries {
+		if e.IsDir {
+			if err := fs.listDir(joinPath(p, e.Name), relPath(rel, e.Name), opts, result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package vfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestList checks hiding, sorting and recursion
+func TestList(t *testing.T) {
+	m := NewMemoryBackend()
+	fs := NewFileSystemWithBackend(m)
+	_ = fs.Mkdir("/dir")
+	_ = fs.Mkdir("/dir/sub")
+	_ = fs.Mkdir("/dir/.git")
+	_ = fs.Touch("/dir/.git/HEAD", "main")
+	_ = fs.Touch("/dir/b.txt", "bb")
+	_ = fs.Touch("/dir/a.txt", "aaa")
+	_ = fs.Touch("/dir/.env", "")
+	_ = fs.Touch("/dir/sub/c.txt", "c")
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	setModTime(t, m, "/dir/b.txt", base)
+	setModTime(t, m, "/dir/a.txt", base.Add(time.Minute))
+	setModTime(t, m, "/dir/sub", base.Add(2*time.Minute))
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"default", ListOptions{}, []string{"a.txt", "b.txt", "sub"}},
+		{"all", ListOptions{All: true}, []string{".env", ".git", "a.txt", "b.txt", "sub"}},
+		{"by size", ListOptions{Sort: SortBySize}, []string{"a.txt", "b.txt", "sub"}},
+		{"by time", ListOptions{Sort: SortByTime}, []string{"sub", "a.txt", "b.txt"}},
+		{"reversed", ListOptions{Reverse: true}, []string{"sub", "b.txt", "a.txt"}},
+		{"recursive", ListOptions{Recursive: true}, []string{"a.txt", "b.txt", "sub", "sub/c.txt"}},
+		{"recursive all", ListOptions{Recursive: true, All: true},
+			[]string{".env", ".git", "a.txt", "b.txt", "sub", ".git/HEAD", "sub/c.txt"}},
+	}
+	for _, tt := range tests {
+		entries, err := fs.List("/dir", tt.opts)
+		if err != nil {
+			t.Fatalf("%s: List() failed: %v", tt.name, err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Path)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: List() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	entries, _ := fs.List("/dir", ListOptions{})
+	if !entries[2].IsDir || entries[0].IsDir || entries[0].Size != 3 || entries[0].Name != "a.txt" {
+		t.Errorf("List() entries = %+v", entries)
+	}
+
+	// Ls still lists everything
+	if names, _ := fs.Ls("/dir"); len(names) != 5 {
+		t.Errorf("Ls() = %v, want hidden entries too", names)
+	}
+}
+
+// helper: sets the modification time of the node at path in m
+func setModTime(t *testing.T, m *MemoryBackend, path string, mtime time.Time) {
+	t.Helper()
+	node, err := m.lookup(path)
+	if err != nil {
+		t.Fatalf("lookup(%s) failed: %v", path, err)
+	}
+	switch node := node.(type) {
+	case *File:
+		node.modTime = mtime
+	case *Directory:
+		node.modTime = mtime
+	}
+}
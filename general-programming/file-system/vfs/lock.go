@@ -0,0 +1,252 @@
+package vfs
+
+import (
+	iofs "io/fs"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LockType is the kind of an advisory lock
+type LockType int
+
+const (
+	// SharedLock can be held by any number of callers at once, typically
+	// while they read a file
+	SharedLock LockType = iota + 1
+	// ExclusiveLock is only held by one caller, with no shared locks,
+	// typically while it rewrites a file
+	ExclusiveLock
+)
+
+func (t LockType) String() string {
+	switch t {
+	case SharedLock:
+		return "shared"
+	case ExclusiveLock:
+		return "exclusive"
+	}
+	return "unknown"
+}
+
+// Lock is an advisory lock on a file, held until Unlock. It belongs to the
+// handle that took it, not to its user: two handles acting as the same
+// user exclude each other like any two. Locks don't keep anyone from
+// reading, but while a handle holds one, Write, Replace, Rm, Mv and the
+// xattr changes fail with ErrLocked through every other handle (Rm and Mv
+// of a directory, for any file below it). The lock follows its file when
+// it is moved, and goes away when the file is removed or hidden by a
+// mount.
+type Lock struct {
+	fs   *FileSystem
+	typ  LockType
+	path string // where the file is now
+}
+
+// LockInfo describes a held lock, as reported by Locks
+type LockInfo struct {
+	Path  string
+	Type  LockType
+	Owner string
+}
+
+// lock(path, type, timeout): waits until the file at path can be locked
+// and locks it. A timeout of 0 waits for as long as it takes; otherwise
+// giving up after timeout fails with ErrLocked.
+func (fs *FileSystem) Lock(path string, typ LockType, timeout time.Duration) (*Lock, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		l, released, err := fs.tryLock(path, typ)
+		if l != nil || err != nil {
+			return l, err
+		}
+		select {
+		case <-released:
+		case <-expired:
+			err := pathError("lock", path, ErrLocked)
+			fs.recordUnlocked("lock", path, err)
+			return nil, err
+		}
+	}
+}
+
+// trylock(path, type): locks the file at path if that is possible right
+// away, and fails with ErrLocked otherwise
+func (fs *FileSystem) TryLock(path string, typ LockType) (*Lock, error) {
+	l, _, err := fs.tryLock(path, typ)
+	if l == nil && err == nil {
+		err = pathError("lock", path, ErrLocked)
+		fs.recordUnlocked("lock", path, err)
+	}
+	return l, err
+}
+
+// Unlock releases the lock. Releasing it twice, or after its file was
+// removed, fails with fs.ErrClosed.
+func (l *Lock) Unlock() (err error) {
+	fs := l.fs
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("unlock", l.path, "", err) }()
+
+	holders := fs.locks[l.path]
+	i := slices.Index(holders, l)
+	if i < 0 {
+		return pathError("unlock", l.path, iofs.ErrClosed)
+	}
+	if len(holders) == 1 {
+		delete(fs.locks, l.path)
+	} else {
+		fs.locks[l.path] = slices.Delete(holders, i, i+1)
+	}
+	fs.wakeLockWaiters()
+	return nil
+}
+
+// Type returns the kind of lock
+func (l *Lock) Type() LockType {
+	return l.typ
+}
+
+// Path returns where the locked file is now
+func (l *Lock) Path() string {
+	l.fs.mu.RLock()
+	defer l.fs.mu.RUnlock()
+	return l.path
+}
+
+// Matches reports whether the lock is on the file at path, with path
+// resolved like the one given to Lock (so under the PathRules, a relative
+// path or one differing in case can still match)
+func (l *Lock) Matches(path string) bool {
+	p, err := l.fs.resolvePath(path)
+	if err != nil {
+		return false
+	}
+	l.fs.mu.RLock()
+	defer l.fs.mu.RUnlock()
+	return p == l.path
+}
+
+// Locks reports every held lock, sorted by path
+func (fs *FileSystem) Locks() []LockInfo {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var result []LockInfo
+	for path, holders := range fs.locks {
+		for _, l := range holders {
+			result = append(result, LockInfo{Path: path, Type: l.typ, Owner: l.fs.user})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// helper: takes the lock if it is free. If it isn't, returns a channel that
+// is closed the next time a lock is released, and leaves recording the
+// attempt to the caller.
+func (fs *FileSystem) tryLock(path string, typ LockType) (l *Lock, released <-chan struct{}, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() {
+		if released == nil {
+			fs.record("lock", path, "", err)
+		}
+	}()
+
+	if typ != SharedLock && typ != ExclusiveLock {
+		return nil, nil, pathError("lock", path, iofs.ErrInvalid)
+	}
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return nil, nil, pathError("lock", path, err)
+	}
+	if info.IsDir {
+		return nil, nil, pathError("lock", path, ErrIsDir)
+	}
+
+	for _, held := range fs.locks[p] {
+		if typ == ExclusiveLock || held.typ == ExclusiveLock {
+			if fs.lockReleased == nil {
+				fs.lockReleased = make(chan struct{})
+			}
+			return nil, fs.lockReleased, nil
+		}
+	}
+
+	l = &Lock{fs: fs, typ: typ, path: p}
+	fs.locks[p] = append(fs.locks[p], l)
+	return l, nil, nil
+}
+
+// helper: fails with ErrLocked if a handle other than this one holds a
+// lock on a file at or below path
+func (fs *FileSystem) checkLocks(path string) error {
+	for locked := range fs.locks {
+		if isWithin(locked, path) {
+			if err := fs.checkLock(locked); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// helper: fails with ErrLocked if a handle other than this one holds a
+// lock on the file at path itself
+func (fs *FileSystem) checkLock(path string) error {
+	for _, l := range fs.locks[path] {
+		if l.fs != fs {
+			return ErrLocked
+		}
+	}
+	return nil
+}
+
+// helper: the locks on files below src follow them to dst
+func (fs *FileSystem) moveLocks(src, dst string) {
+	moved := make(map[string][]*Lock)
+	for locked, holders := range fs.locks {
+		if isWithin(locked, src) {
+			delete(fs.locks, locked)
+			target := dst + strings.TrimPrefix(locked, src)
+			for _, l := range holders {
+				l.path = target
+			}
+			moved[target] = holders
+		}
+	}
+	for locked, holders := range moved {
+		fs.locks[locked] = holders
+	}
+}
+
+// helper: releases the locks on files at or below path, which are gone
+func (fs *FileSystem) dropLocks(path string) {
+	dropped := false
+	for locked := range fs.locks {
+		if isWithin(locked, path) {
+			delete(fs.locks, locked)
+			dropped = true
+		}
+	}
+	if dropped {
+		fs.wakeLockWaiters()
+	}
+}
+
+// helper: wakes up the callers waiting in Lock, to try again
+func (fs *FileSystem) wakeLockWaiters() {
+	if fs.lockReleased != nil {
+		close(fs.lockReleased)
+		fs.lockReleased = nil
+	}
+}
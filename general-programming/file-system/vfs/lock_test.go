@@ -0,0 +1,179 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestLockConflicts checks which locks can be held together
+func TestLockConflicts(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/dir")
+	_ = fs.Touch("/dir/f.txt", "")
+
+	s1, err1 := fs.TryLock("/dir/f.txt", SharedLock)
+	s2, err2 := fs.TryLock("/dir/f.txt", SharedLock)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("TryLock(shared) twice failed: %v, %v", err1, err2)
+	}
+	if _, err := fs.TryLock("/dir/f.txt", ExclusiveLock); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLock(exclusive) over shared error = %v, want ErrLocked", err)
+	}
+
+	_ = s1.Unlock()
+	_ = s2.Unlock()
+	x, err := fs.TryLock("/dir/f.txt", ExclusiveLock)
+	if err != nil {
+		t.Fatalf("TryLock(exclusive) failed: %v", err)
+	}
+	if _, err := fs.TryLock("/dir/f.txt", SharedLock); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLock(shared) over exclusive error = %v, want ErrLocked", err)
+	}
+	if err := x.Unlock(); err != nil {
+		t.Errorf("Unlock() failed: %v", err)
+	}
+	if err := x.Unlock(); !errors.Is(err, iofs.ErrClosed) {
+		t.Errorf("second Unlock() error = %v, want ErrClosed", err)
+	}
+
+	tests := []struct {
+		path string
+		typ  LockType
+		want error
+	}{
+		{"/dir", ExclusiveLock, ErrIsDir},
+		{"/missing", SharedLock, ErrNotExist},
+		{"/dir/f.txt", LockType(0), iofs.ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := fs.TryLock(tt.path, tt.typ); !errors.Is(err, tt.want) {
+			t.Errorf("TryLock(%s, %v) error = %v, want %v", tt.path, tt.typ, err, tt.want)
+		}
+	}
+}
+
+// TestLockWait checks Lock waits for a release, or gives up after its timeout
+func TestLockWait(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Touch("/f.txt", "")
+	held, _ := fs.TryLock("/f.txt", ExclusiveLock)
+
+	start := time.Now()
+	if _, err := fs.Lock("/f.txt", SharedLock, 20*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Errorf("Lock() with timeout error = %v, want ErrLocked", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("Lock() gave up after %v, before its timeout", waited)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		held.Unlock()
+	}()
+	l, err := fs.Lock("/f.txt", ExclusiveLock, 0)
+	if err != nil {
+		t.Fatalf("Lock() after release failed: %v", err)
+	}
+	if l.Path() != "/f.txt" || l.Type() != ExclusiveLock {
+		t.Errorf("Lock() = %s %v", l.Path(), l.Type())
+	}
+}
+
+// TestLockMatches checks a lock matches its file however the path is
+// spelled, as long as it resolves there
+func TestLockMatches(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.SetPathRules(PathRules{CaseInsensitive: true})
+	_ = fs.Mkdir("/Docs")
+	_ = fs.Touch("/Docs/Notes.txt", "")
+	_ = fs.Touch("/other.txt", "")
+
+	l, err := fs.TryLock("/docs/notes.txt", SharedLock)
+	if err != nil {
+		t.Fatalf("TryLock failed: %v", err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/Docs/Notes.txt", true},
+		{"Docs/Notes.txt", true},
+		{"/DOCS//NOTES.TXT/", true},
+		{"/other.txt", false},
+		{"/Docs", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := l.Matches(tt.path); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestLockEnforced checks other handles can't change a locked file, even
+// with the same user
+func TestLockEnforced(t *testing.T) {
+	fs := NewFileSystem()
+	alice, bob := fs.WithUser("alice"), fs.WithUser("bob")
+	otherAlice := fs.WithUser("alice")
+	_ = fs.Mkdir("/dir")
+	_ = fs.Touch("/dir/f.txt", "v1")
+	_ = fs.Touch("/g.txt", "")
+	l, _ := alice.TryLock("/dir/f.txt", SharedLock)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Write", bob.Write("/dir/f.txt", "v2")},
+		{"Rm", bob.Rm("/dir/f.txt")},
+		{"Rm parent", bob.Rm("/dir")},
+		{"Mv parent", bob.Mv("/dir", "/moved")},
+		{"Replace", bob.Replace("/g.txt", "/dir/f.txt")},
+		{"SetXattr", bob.SetXattr("/dir/f.txt", "user.tag", "x")},
+		{"RemoveXattr", bob.RemoveXattr("/dir/f.txt", "user.tag")},
+		{"Write same user", otherAlice.Write("/dir/f.txt", "v2")},
+		{"SetXattr same user", otherAlice.SetXattr("/dir/f.txt", "user.tag", "x")},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, ErrLocked) {
+			t.Errorf("%s by another handle error = %v, want ErrLocked", tt.name, tt.err)
+		}
+	}
+	// a lock only covers its file's attributes
+	if err := bob.SetXattr("/dir", "user.tag", "x"); err != nil {
+		t.Errorf("SetXattr() of the parent failed: %v", err)
+	}
+	if content, err := bob.Cat("/dir/f.txt"); err != nil || content != "v1" {
+		t.Errorf("Cat() by another user = %q, %v", content, err)
+	}
+
+	// the owner can, and the lock follows the file
+	if err := alice.Write("/dir/f.txt", "v2"); err != nil {
+		t.Errorf("Write() by lock owner failed: %v", err)
+	}
+	if err := alice.SetXattr("/dir/f.txt", "user.tag", "x"); err != nil {
+		t.Errorf("SetXattr() by lock owner failed: %v", err)
+	}
+	if err := alice.Mv("/dir", "/moved"); err != nil {
+		t.Fatalf("Mv() by lock owner failed: %v", err)
+	}
+	want := []LockInfo{{Path: "/moved/f.txt", Type: SharedLock, Owner: "alice"}}
+	if got := fs.Locks(); !reflect.DeepEqual(got, want) || l.Path() != "/moved/f.txt" {
+		t.Errorf("Locks() after Mv = %+v (lock at %s), want %+v", got, l.Path(), want)
+	}
+
+	// and goes away with it
+	if err := alice.Rm("/moved/f.txt"); err != nil {
+		t.Fatalf("Rm() by lock owner failed: %v", err)
+	}
+	if got := fs.Locks(); len(got) != 0 {
+		t.Errorf("Locks() after Rm = %+v", got)
+	}
+	if err := l.Unlock(); !errors.Is(err, iofs.ErrClosed) {
+		t.Errorf("Unlock() of removed file error = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,343 @@
+package vfs
+
+import (
+	"io"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MemoryBackend keeps the tree in memory as Nodes, with file content in a
+// deduplicating, compressing blob store. It is the backend of NewFileSystem.
+// Like every Backend it relies on the FileSystem for locking.
+type MemoryBackend struct {
+	root     *Directory
+	blobs    *blobStore
+	dentries *dentryCache // the directories paths resolve to
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	root := NewDirectory("/")
+	root.owner = DefaultUser
+	return &MemoryBackend{root: root, blobs: newBlobStore(), dentries: newDentryCache()}
+}
+
+// SetCompressionThreshold sets the content size in bytes above which new
+// content is stored compressed; 0 turns compression off. Content already
+// stored keeps its current form.
+func (m *MemoryBackend) SetCompressionThreshold(bytes int64) {
+	m.blobs.threshold = max(bytes, 0)
+}
+
+func (m *MemoryBackend) Stat(path string) (FileInfo, error) {
+	node, err := m.lookup(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return statNode(node), nil
+}
+
+func (m *MemoryBackend) ReadDir(path string) ([]FileInfo, error) {
+	node, err := m.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsDirectory() {
+		return nil, ErrNotDir
+	}
+
+	dir := node.(*Directory)
+	result := make([]FileInfo, 0, len(dir.children))
+	for _, child := range dir.children {
+		result = append(result, statNode(child))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (m *MemoryBackend) Mkdir(path, owner string) error {
+	return done(m.mkdir(path, owner, time.Now()))
+}
+
+func (m *MemoryBackend) Create(path, content, owner string) error {
+	return done(m.create(path, content, owner, time.Now()))
+}
+
+func (m *MemoryBackend) ReadFile(path string) (string, error) {
+	file, err := m.file(path)
+	if err != nil {
+		return "", err
+	}
+	return file.content.content()
+}
+
+// fileBlob takes a reference on the blob the file at path holds, for a
+// version to share
+func (m *MemoryBackend) fileBlob(path string) (*blob, *blobStore, error) {
+	file, err := m.file(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.blobs.retain(file.content), m.blobs, nil
+}
+
+// Open streams from the blob the file holds now; blobs are immutable, so
+// the reader is unaffected by later writes
+func (m *MemoryBackend) Open(path string) (io.ReadCloser, error) {
+	file, err := m.file(path)
+	if err != nil {
+		return nil, err
+	}
+	return file.content.open()
+}
+
+func (m *MemoryBackend) WriteFile(path, content string) error {
+	return done(m.write(path, content, time.Now()))
+}
+
+func (m *MemoryBackend) Remove(path string) error {
+	return done(m.remove(path, time.Now()))
+}
+
+func (m *MemoryBackend) Rename(oldpath, newpath string) error {
+	return done(m.rename(oldpath, newpath, time.Now()))
+}
+
+func (m *MemoryBackend) Xattrs(path string) (map[string]string, error) {
+	node, err := m.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return maps.Clone(*xattrsOf(node)), nil
+}
+
+func (m *MemoryBackend) SetXattr(path, name, value string) error {
+	return done(m.setXattr(path, name, value))
+}
+
+func (m *MemoryBackend) RemoveXattr(path, name string) error {
+	return done(m.removeXattr(path, name))
+}
+
+// The helpers below check the change a method above makes can be made, and
+// return the function that makes it, at a given time: so DBBackend can
+// journal a change before making it, and replay its journal with the
+// original timestamps. Once a check passes, the change can't fail.
+
+func (m *MemoryBackend) mkdir(path, owner string, now time.Time) (func(), error) {
+	parent, name, err := m.traverseToParent(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := parent.children[name]; exists {
+		return nil, ErrExist
+	}
+
+	return func() {
+		dir := NewDirectory(name)
+		dir.modTime = now
+		dir.owner = owner
+		parent.children[name] = dir
+		parent.modTime = now
+	}, nil
+}
+
+func (m *MemoryBackend) create(path, content, owner string, now time.Time) (func(), error) {
+	parent, name, err := m.traverseToParent(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := parent.children[name]; exists {
+		return nil, ErrExist
+	}
+
+	return func() {
+		parent.children[name] = &File{name: name, content: m.blobs.put(content), modTime: now, owner: owner}
+		parent.modTime = now
+	}, nil
+}
+
+func (m *MemoryBackend) write(path, content string, now time.Time) (func(), error) {
+	file, err := m.file(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		old := file.content
+		file.content = m.blobs.put(content)
+		m.blobs.release(old)
+		file.modTime = now
+	}, nil
+}
+
+func (m *MemoryBackend) remove(path string, now time.Time) (func(), error) {
+	parent, name, err := m.traverseToParent(path)
+	if err != nil {
+		return nil, err
+	}
+	node, exists := parent.children[name]
+	if !exists {
+		return nil, ErrNotExist
+	}
+
+	return func() {
+		// Go's Garbage Collector handles the recursive cleanup
+		// simply by removing the reference from the map
+		delete(parent.children, name)
+		if node.IsDirectory() {
+			m.dentries.invalidate(cleanPath(path))
+		}
+		m.blobs.releaseTree(node)
+		parent.modTime = now
+	}, nil
+}
+
+func (m *MemoryBackend) rename(oldpath, newpath string, now time.Time) (func(), error) {
+	srcParent, srcName, err := m.traverseToParent(oldpath)
+	if err != nil {
+		return nil, err
+	}
+	node, exists := srcParent.children[srcName]
+	if !exists {
+		return nil, ErrNotExist
+	}
+
+	dstParent, dstName, err := m.traverseToParent(newpath)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := dstParent.children[dstName]; exists {
+		return nil, ErrExist
+	}
+
+	return func() {
+		delete(srcParent.children, srcName)
+		if node.IsDirectory() {
+			m.dentries.invalidate(cleanPath(oldpath))
+		}
+		switch n := node.(type) {
+		case *File:
+			n.name = dstName
+		case *Directory:
+			n.name = dstName
+		}
+		dstParent.children[dstName] = node
+		srcParent.modTime = now
+		dstParent.modTime = now
+	}, nil
+}
+
+func (m *MemoryBackend) setXattr(path, name, value string) (func(), error) {
+	node, err := m.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		attrs := xattrsOf(node)
+		if *attrs == nil {
+			*attrs = make(map[string]string)
+		}
+		(*attrs)[name] = value
+	}, nil
+}
+
+func (m *MemoryBackend) removeXattr(path, name string) (func(), error) {
+	node, err := m.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	attrs := xattrsOf(node)
+	if _, ok := (*attrs)[name]; !ok {
+		return nil, ErrNoXattr
+	}
+
+	return func() { delete(*attrs, name) }, nil
+}
+
+// helper: makes a change its check allowed, or returns why it didn't
+func done(change func(), err error) error {
+	if err != nil {
+		return err
+	}
+	change()
+	return nil
+}
+
+// helper: traverses to the directory containing the target node
+// returns: the parent dir, the name of the target, and error if parent doesn't exist.
+// Parents found are cached, so the next call for a sibling skips the walk.
+func (m *MemoryBackend) traverseToParent(path string) (*Directory, string, error) {
+	// the fast path: a clean path (the usual case) splits without parsing
+	if path != "/" && isClean(path) {
+		i := strings.LastIndexByte(path, '/')
+		if i == 0 {
+			return m.root, path[1:], nil
+		}
+		if dir, ok := m.dentries.get(path[:i]); ok {
+			return dir, path[i+1:], nil
+		}
+	}
+
+	parts := parsePath(path)
+	if len(parts) == 0 {
+		// root has no parent
+		return nil, "", ErrInvalidPath
+	}
+	targetName := parts[len(parts)-1]
+	if len(parts) == 1 {
+		return m.root, targetName, nil
+	}
+	parentPath := "/" + strings.Join(parts[:len(parts)-1], "/")
+
+	current := m.root
+
+	// Navigate up to the second to last part
+	for i := 0; i < len(parts)-1; i++ {
+		nextNode, exists := current.children[parts[i]]
+		if !exists {
+			return nil, "", ErrNotExist
+		}
+
+		if !nextNode.IsDirectory() {
+			return nil, "", ErrNotDir
+		}
+
+		current = nextNode.(*Directory)
+	}
+
+	m.dentries.put(parentPath, current)
+	return current, targetName, nil
+}
+
+// helper: resolves path to the node it names, including the root
+func (m *MemoryBackend) lookup(path string) (Node, error) {
+	if isRoot(path) {
+		return m.root, nil
+	}
+
+	parent, name, err := m.traverseToParent(path)
+	if err != nil {
+		return nil, err
+	}
+
+	node, exists := parent.children[name]
+	if !exists {
+		return nil, ErrNotExist
+	}
+	return node, nil
+}
+
+// helper: resolves path to a file, failing on directories
+func (m *MemoryBackend) file(path string) (*File, error) {
+	node, err := m.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	if node.IsDirectory() {
+		return nil, ErrIsDir
+	}
+	return node.(*File), nil
+}
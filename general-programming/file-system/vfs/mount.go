@@ -0,0 +1,395 @@
+package vfs
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Mount attaches backend at path, an existing directory, hiding what was
+// there until Unmount. Operations below path go to backend, so one tree
+// can combine several backends (an OverlayBackend over a fixture, a host
+// directory, ...). Nodes can't be moved between mounts, and neither a mount
+// point nor a directory containing one can be removed or moved.
+func (fs *FileSystem) Mount(path string, backend Backend) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("mount", path, "", err) }()
+
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return pathError("mount", path, err)
+	}
+	if isRoot(p) {
+		return pathError("mount", path, ErrInvalidPath)
+	}
+	if !info.IsDir {
+		return pathError("mount", path, ErrNotDir)
+	}
+	if _, mounted := fs.backend.mounts[p]; mounted {
+		return pathError("mount", path, ErrExist)
+	}
+	if _, err := backend.Stat("/"); err != nil {
+		return pathError("mount", path, err)
+	}
+
+	err = fs.swapSubtree(p, info, func() { fs.backend.mounts[p] = backend })
+	if err != nil {
+		return pathError("mount", path, err)
+	}
+	// the locked files, and their histories, are hidden now
+	fs.dropLocks(p)
+	fs.dropVersions(p)
+	fs.dropDirKeys(p)
+	fs.rescanEncrypted(p)
+	fs.folds.invalidate(p)
+	fs.reindex(p)
+	return nil
+}
+
+// Unmount detaches the backend mounted at path, closing it if it is an
+// io.Closer, and uncovers the directory underneath
+func (fs *FileSystem) Unmount(path string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("unmount", path, "", err) }()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return pathError("unmount", path, err)
+	}
+	backend, mounted := fs.backend.mounts[p]
+	if !mounted {
+		return pathError("unmount", path, ErrInvalidPath)
+	}
+	// mounts inside this one go first
+	if len(fs.backend.mountsWithin(p)) > 1 {
+		return pathError("unmount", path, ErrPermission)
+	}
+
+	info, err := fs.backend.Stat(p)
+	if err != nil {
+		return pathError("unmount", path, err)
+	}
+	err = fs.swapSubtree(p, info, func() { delete(fs.backend.mounts, p) })
+	if err != nil {
+		return pathError("unmount", path, err)
+	}
+	fs.dropLocks(p)
+	fs.dropVersions(p)
+	fs.dropDirKeys(p)
+	fs.rescanEncrypted(p)
+	fs.folds.invalidate(p)
+	fs.reindex(p)
+	if c, ok := backend.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return pathError("unmount", path, err)
+		}
+	}
+	return nil
+}
+
+// Mounts lists the mount points, sorted
+func (fs *FileSystem) Mounts() []string {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	result := make([]string, 0, len(fs.backend.mounts))
+	for p := range fs.backend.mounts {
+		result = append(result, p)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// helper: runs swap, which replaces the subtree at path (described by
+// info), and moves quota usage from the old subtree to the new one. Quotas
+// set inside the old subtree are dropped with it.
+func (fs *FileSystem) swapSubtree(path string, info FileInfo, swap func()) error {
+	if !fs.hasQuotas() {
+		swap()
+		return nil
+	}
+
+	before, err := fs.usageOf(path, info)
+	if err != nil {
+		return err
+	}
+	swap()
+	info, err = fs.backend.Stat(path)
+	if err != nil {
+		return err
+	}
+	after, err := fs.usageOf(path, info)
+	if err != nil {
+		return err
+	}
+
+	fs.releaseQuota(path, before)
+	for owner, u := range after {
+		fs.chargeQuota(path, owner, u)
+	}
+	return nil
+}
+
+// mountTable is the backend a FileSystem actually talks to: it routes each
+// path to the backend mounted closest above it, or to root
+type mountTable struct {
+	root   Backend
+	mounts map[string]Backend // by mount point
+}
+
+func newMountTable(root Backend) *mountTable {
+	return &mountTable{root: root, mounts: make(map[string]Backend)}
+}
+
+// helper: the backend path belongs to, the path within that backend, and
+// the mount point ("" for root)
+func (t *mountTable) resolve(path string) (Backend, string, string) {
+	backend, mountPoint := t.root, ""
+	for mp, b := range t.mounts {
+		if isWithin(path, mp) && len(mp) > len(mountPoint) {
+			backend, mountPoint = b, mp
+		}
+	}
+	return backend, cleanPath(strings.TrimPrefix(path, mountPoint)), mountPoint
+}
+
+// helper: the mount points at or below path
+func (t *mountTable) mountsWithin(path string) []string {
+	var result []string
+	for mp := range t.mounts {
+		if isWithin(mp, path) {
+			result = append(result, mp)
+		}
+	}
+	return result
+}
+
+// helper: like resolve, for the paths the tree can see: those inside a
+// backend's trash fail with ErrNotExist
+func (t *mountTable) route(path string) (Backend, string, error) {
+	b, inner, _ := t.resolve(path)
+	if isTrash(inner) {
+		return nil, "", ErrNotExist
+	}
+	return b, inner, nil
+}
+
+func (t *mountTable) Stat(path string) (FileInfo, error) {
+	b, inner, mp := t.resolve(path)
+	if isTrash(inner) {
+		return FileInfo{}, ErrNotExist
+	}
+	info, err := b.Stat(inner)
+	if err == nil && mp != "" && isRoot(inner) {
+		parts := parsePath(mp)
+		info.Name = parts[len(parts)-1]
+	}
+	return info, err
+}
+
+func (t *mountTable) ReadDir(path string) ([]FileInfo, error) {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := b.ReadDir(inner)
+	if err != nil {
+		return nil, err
+	}
+	// the trash is hidden, and mount points show the root of what's
+	// mounted on them
+	result := entries[:0]
+	for _, e := range entries {
+		if isTrash(joinPath(inner, e.Name)) {
+			continue
+		}
+		child := joinPath(path, e.Name)
+		if _, mounted := t.mounts[child]; mounted {
+			if info, err := t.Stat(child); err == nil {
+				e = info
+			}
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+func (t *mountTable) Mkdir(path, owner string) error {
+	b, inner, _ := t.resolve(path)
+	if err := checkCreate(inner); err != nil {
+		return err
+	}
+	return b.Mkdir(inner, owner)
+}
+
+func (t *mountTable) Create(path, content, owner string) error {
+	b, inner, _ := t.resolve(path)
+	if err := checkCreate(inner); err != nil {
+		return err
+	}
+	return b.Create(inner, content, owner)
+}
+
+func (t *mountTable) ReadFile(path string) (string, error) {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return "", err
+	}
+	return b.ReadFile(inner)
+}
+
+// fileBlob is blobSharer's, for the backend holding path, failing with
+// ErrUnsupported if it doesn't keep content in blobs
+func (t *mountTable) fileBlob(path string) (*blob, *blobStore, error) {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharer, ok := b.(blobSharer)
+	if !ok {
+		return nil, nil, ErrUnsupported
+	}
+	return sharer.fileBlob(inner)
+}
+
+// compact compacts the backend holding path, if it is a compacter
+func (t *mountTable) compact(path string) error {
+	b, _, err := t.route(path)
+	if err != nil {
+		return err
+	}
+	if c, ok := b.(compacter); ok {
+		return c.Compact()
+	}
+	return nil
+}
+
+func (t *mountTable) Open(path string) (io.ReadCloser, error) {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.Open(inner)
+}
+
+func (t *mountTable) WriteFile(path, content string) error {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return err
+	}
+	if isRoot(inner) {
+		return ErrIsDir
+	}
+	return b.WriteFile(inner, content)
+}
+
+func (t *mountTable) Remove(path string) error {
+	if len(t.mountsWithin(path)) > 0 {
+		return ErrPermission
+	}
+	b, inner, err := t.route(path)
+	if err != nil {
+		return err
+	}
+	return b.Remove(inner)
+}
+
+func (t *mountTable) Rename(oldpath, newpath string) error {
+	if len(t.mountsWithin(oldpath)) > 0 {
+		return ErrPermission
+	}
+	b, oldInner, oldMount := t.resolve(oldpath)
+	_, newInner, newMount := t.resolve(newpath)
+	if isTrash(oldInner) {
+		return ErrNotExist
+	}
+	if err := checkCreate(newInner); err != nil {
+		return err
+	}
+	if oldMount != newMount {
+		return ErrCrossMount
+	}
+	return b.Rename(oldInner, newInner)
+}
+
+func (t *mountTable) Xattrs(path string) (map[string]string, error) {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return nil, err
+	}
+	xb, ok := b.(XattrBackend)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return xb.Xattrs(inner)
+}
+
+func (t *mountTable) SetXattr(path, name, value string) error {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return err
+	}
+	xb, ok := b.(XattrBackend)
+	if !ok {
+		return ErrUnsupported
+	}
+	return xb.SetXattr(inner, name, value)
+}
+
+func (t *mountTable) RemoveXattr(path, name string) error {
+	b, inner, err := t.route(path)
+	if err != nil {
+		return err
+	}
+	xb, ok := b.(XattrBackend)
+	if !ok {
+		return ErrUnsupported
+	}
+	return xb.RemoveXattr(inner, name)
+}
+
+// helper: checks a node can be created at inner, a path within a backend:
+// not on the backend's root, nor in its trash
+func checkCreate(inner string) error {
+	if isRoot(inner) {
+		return ErrExist
+	}
+	if isTrash(inner) {
+		return ErrInvalidPath
+	}
+	return nil
+}
+
+// SetCompressionThreshold passes the threshold on to every backend that
+// compresses
+func (t *mountTable) SetCompressionThreshold(bytes int64) {
+	for _, b := range t.all() {
+		if c, ok := b.(interface{ SetCompressionThreshold(int64) }); ok {
+			c.SetCompressionThreshold(bytes)
+		}
+	}
+}
+
+// Close closes every backend that needs closing, reporting the first error
+func (t *mountTable) Close() error {
+	var first error
+	for _, b := range t.all() {
+		if c, ok := b.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// helper: root and the mounted backends
+func (t *mountTable) all() []Backend {
+	result := []Backend{t.root}
+	for _, b := range t.mounts {
+		result = append(result, b)
+	}
+	return result
+}
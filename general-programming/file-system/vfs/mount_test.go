@@ -0,0 +1,129 @@
+package vfs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestMount checks paths below a mount point reach the mounted backend and
+// the restrictions around mount points
+func TestMount(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/mnt")
+	_ = fs.Touch("/mnt/hidden.txt", "under the mount")
+	_ = fs.Touch("/local.txt", "local")
+
+	if err := fs.Mount("/mnt", NewMemoryBackend()); err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	if entries, _ := fs.Ls("/mnt"); len(entries) != 0 {
+		t.Errorf("Ls() of fresh mount = %v, want empty", entries)
+	}
+	if err := fs.Touch("/mnt/new.txt", "mounted"); err != nil {
+		t.Fatalf("Touch on mount failed: %v", err)
+	}
+	if info, err := fs.Stat("/mnt"); err != nil || info.Name != "mnt" || !info.IsDir {
+		t.Errorf("Stat(mount point) = %+v, %v", info, err)
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"Move across mounts", func() error { return fs.Mv("/local.txt", "/mnt/local.txt") }, ErrCrossMount},
+		{"Remove mount point", func() error { return fs.Rm("/mnt") }, ErrPermission},
+		{"Move mount point", func() error { return fs.Mv("/mnt", "/elsewhere") }, ErrPermission},
+		{"Mount twice", func() error { return fs.Mount("/mnt", NewMemoryBackend()) }, ErrExist},
+		{"Mount on file", func() error { return fs.Mount("/local.txt", NewMemoryBackend()) }, ErrNotDir},
+		{"Mkdir on mount point", func() error { return fs.Mkdir("/mnt") }, ErrExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// copying is fine, it doesn't move anything
+	if err := fs.Cp("/local.txt", "/mnt/local.txt"); err != nil {
+		t.Errorf("Cp across mounts failed: %v", err)
+	}
+
+	if err := fs.Unmount("/mnt"); err != nil {
+		t.Fatalf("Unmount failed: %v", err)
+	}
+	if entries, _ := fs.Ls("/mnt"); !reflect.DeepEqual(entries, []string{"hidden.txt"}) {
+		t.Errorf("Ls() after Unmount = %v", entries)
+	}
+}
+
+// TestOverlay checks an overlay over a fixture: the merged view, copy-up on
+// write, whiteouts and renames out of the lower layer, with the fixture
+// itself left untouched
+func TestOverlay(t *testing.T) {
+	fixture := NewMemoryBackend()
+	_ = fixture.Mkdir("/etc", "root")
+	_ = fixture.Create("/etc/hosts", "127.0.0.1 localhost", "root")
+	_ = fixture.Create("/etc/motd", "welcome", "root")
+	_ = fixture.Mkdir("/etc/conf.d", "root")
+	_ = fixture.Create("/etc/conf.d/net", "dhcp", "root")
+
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/base")
+	if err := fs.Mount("/base", NewOverlayBackend(fixture, NewMemoryBackend())); err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+
+	// writes go up, the merged view shows both layers
+	if err := fs.Write("/base/etc/motd", "changed"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	_ = fs.Touch("/base/etc/new.conf", "extra")
+	if content, _ := fs.Cat("/base/etc/motd"); content != "changed" {
+		t.Errorf("Cat() after Write = %q", content)
+	}
+	want := []string{"conf.d", "hosts", "motd", "new.conf"}
+	if entries, _ := fs.Ls("/base/etc"); !reflect.DeepEqual(entries, want) {
+		t.Errorf("Ls() = %v, want %v", entries, want)
+	}
+
+	// removing lower nodes leaves whiteouts
+	if err := fs.Rm("/base/etc/hosts"); err != nil {
+		t.Fatalf("Rm failed: %v", err)
+	}
+	if _, err := fs.Stat("/base/etc/hosts"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat() after Rm error = %v, want ErrNotExist", err)
+	}
+	_ = fs.Rm("/base/etc/conf.d")
+	_ = fs.Mkdir("/base/etc/conf.d")
+	if entries, _ := fs.Ls("/base/etc/conf.d"); len(entries) != 0 {
+		t.Errorf("Ls() of recreated dir = %v, want empty", entries)
+	}
+
+	// renaming a lower directory copies it up
+	if err := fs.Mv("/base/etc", "/base/config"); err != nil {
+		t.Fatalf("Mv failed: %v", err)
+	}
+	want = []string{"conf.d", "motd", "new.conf"}
+	if entries, _ := fs.Ls("/base/config"); !reflect.DeepEqual(entries, want) {
+		t.Errorf("Ls() after Mv = %v, want %v", entries, want)
+	}
+	if entries, _ := fs.Ls("/base"); !reflect.DeepEqual(entries, []string{"config"}) {
+		t.Errorf("Ls(/base) after Mv = %v", entries)
+	}
+
+	if err := fs.Touch("/base/.wh.sneaky", ""); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Touch() of whiteout name error = %v, want ErrInvalidPath", err)
+	}
+
+	// the fixture never changes
+	if content, _ := fixture.ReadFile("/etc/motd"); content != "welcome" {
+		t.Errorf("fixture motd = %q", content)
+	}
+	if entries, _ := fixture.ReadDir("/etc"); len(entries) != 3 {
+		t.Errorf("fixture /etc = %+v", entries)
+	}
+}
@@ -0,0 +1,94 @@
+package vfs
+
+import "time"
+
+// Node is the common interface for Files and Directories.
+// This allows a Directory to hold a map of Nodes without caring what they are.
+type Node interface {
+	Name() string
+	IsDirectory() bool
+	ModTime() time.Time
+	Owner() string
+}
+
+// File represents a text file. Its content lives in the MemoryBackend's blob
+// store, shared with every other File holding the same bytes.
+type File struct {
+	name    string
+	content *blob
+	modTime time.Time
+	owner   string
+	xattrs  map[string]string // nil until the first is set
+}
+
+func (f *File) Name() string       { return f.name }
+func (f *File) IsDirectory() bool  { return false }
+func (f *File) ModTime() time.Time { return f.modTime }
+func (f *File) Owner() string      { return f.owner }
+func (f *File) Size() int64        { return f.content.size }
+
+// Directory represents a folder containing other Nodes
+type Directory struct {
+	name     string
+	children map[string]Node
+	modTime  time.Time
+	owner    string
+	xattrs   map[string]string // nil until the first is set
+}
+
+func (d *Directory) Name() string       { return d.name }
+func (d *Directory) IsDirectory() bool  { return true }
+func (d *Directory) ModTime() time.Time { return d.modTime }
+func (d *Directory) Owner() string      { return d.owner }
+
+func NewDirectory(name string) *Directory {
+	return &Directory{
+		name:     name,
+		children: make(map[string]Node),
+		modTime:  time.Now(),
+	}
+}
+
+// helper: the extended attributes of node, for reading and updating
+func xattrsOf(node Node) *map[string]string {
+	switch n := node.(type) {
+	case *File:
+		return &n.xattrs
+	case *Directory:
+		return &n.xattrs
+	}
+	return nil
+}
+
+// FileInfo describes a Node, as returned by Stat
+type FileInfo struct {
+	Name    string
+	IsDir   bool
+	Size    int64 // content length in bytes; 0 for directories
+	ModTime time.Time
+	Owner   string
+	Hash    string // hex sha256 of the content; empty for directories
+
+	// PhysicalSize is the number of bytes actually stored for the content,
+	// which is less than Size when it is Compressed. Content shared with
+	// other files is counted in full for each of them.
+	PhysicalSize int64
+	Compressed   bool
+}
+
+// helper: builds the FileInfo for a node
+func statNode(node Node) FileInfo {
+	info := FileInfo{
+		Name:    node.Name(),
+		IsDir:   node.IsDirectory(),
+		ModTime: node.ModTime(),
+		Owner:   node.Owner(),
+	}
+	if f, ok := node.(*File); ok {
+		info.Size = f.Size()
+		info.Hash = f.content.hash
+		info.PhysicalSize = int64(len(f.content.data))
+		info.Compressed = f.content.compressed
+	}
+	return info
+}
@@ -0,0 +1,471 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mkdir(path)
+func (fs *FileSystem) Mkdir(path string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("mkdir", path, "", err) }()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return pathError("mkdir", path, err)
+	}
+	if isRoot(p) {
+		return pathError("mkdir", path, ErrExist)
+	}
+
+	delta := Usage{Inodes: 1}
+	if err := fs.checkQuota(p, fs.user, delta); err != nil {
+		return pathError("mkdir", path, err)
+	}
+
+	if err := fs.backend.Mkdir(p, fs.user); err != nil {
+		return pathError("mkdir", path, err)
+	}
+	fs.chargeQuota(p, fs.user, delta)
+	fs.notify(Event{Op: Create, Path: p, IsDir: true})
+	return nil
+}
+
+// touch(path)
+func (fs *FileSystem) Touch(path string, content string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("touch", path, "", err) }()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return pathError("touch", path, err)
+	}
+	if isRoot(p) {
+		return pathError("touch", path, ErrExist)
+	}
+
+	stored, _, err := fs.storedContent(p, content)
+	if err != nil {
+		return pathError("touch", path, err)
+	}
+	delta := Usage{Bytes: int64(len(stored)), Inodes: 1}
+	if err := fs.checkQuota(p, fs.user, delta); err != nil {
+		return pathError("touch", path, err)
+	}
+
+	if err := fs.backend.Create(p, stored, fs.user); err != nil {
+		return pathError("touch", path, err)
+	}
+	fs.chargeQuota(p, fs.user, delta)
+	fs.notify(Event{Op: Create, Path: p})
+	return nil
+}
+
+// write(path): replaces the content of an existing file, keeping the
+// previous content as a version (see SetVersionLimit)
+func (fs *FileSystem) Write(path string, content string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("write", path, "", err) }()
+	return fs.write("write", path, content)
+}
+
+// helper: Write, reporting errors for op
+func (fs *FileSystem) write(op, path, content string) error {
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return pathError(op, path, err)
+	}
+
+	if info.IsDir {
+		return pathError(op, path, ErrIsDir)
+	}
+	if err := fs.checkLocks(p); err != nil {
+		return pathError(op, path, err)
+	}
+
+	stored, sealed, err := fs.storedContent(p, content)
+	if err != nil {
+		return pathError(op, path, err)
+	}
+
+	// the owner pays for the file, whoever writes it
+	delta := Usage{Bytes: int64(len(stored)) - info.Size}
+	if err := fs.checkQuota(p, info.Owner, delta); err != nil {
+		return pathError(op, path, err)
+	}
+	if !sealed {
+		if err := fs.seedVersions(p, info); err != nil {
+			return pathError(op, path, err)
+		}
+	}
+
+	if err := fs.backend.WriteFile(p, stored); err != nil {
+		return pathError(op, path, err)
+	}
+	fs.chargeQuota(p, info.Owner, delta)
+	if !sealed {
+		fs.addVersion(p, content)
+	}
+	fs.notify(Event{Op: Modify, Path: p})
+	return nil
+}
+
+// ls(path): the names of every entry, hidden ones included (see List)
+func (fs *FileSystem) Ls(path string) ([]string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return nil, pathError("ls", path, err)
+	}
+
+	// backends return entries sorted by name for consistent output
+	entries, err := fs.backend.ReadDir(p)
+	if err != nil {
+		return nil, pathError("ls", path, err)
+	}
+	result := make([]string, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.Name)
+	}
+	return result, nil
+}
+
+// cat(path)
+func (fs *FileSystem) Cat(path string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return "", pathError("cat", path, err)
+	}
+
+	content, err := fs.readContent(p)
+	if err != nil {
+		return "", pathError("cat", path, err)
+	}
+	return content, nil
+}
+
+// open(path): streams a file's content, decompressing it as it is read.
+// The reader sees the content as of the call, even if the file is written
+// or removed while it is being read.
+func (fs *FileSystem) Open(path string) (io.ReadCloser, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return nil, pathError("open", path, err)
+	}
+
+	r, err := fs.openStored(p)
+	if err != nil {
+		return nil, pathError("open", path, err)
+	}
+	return r, nil
+}
+
+// rm(path): with the trash on (see SetTrash), the node is moved to the
+// trash instead of being removed for good
+func (fs *FileSystem) Rm(path string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("rm", path, "", err) }()
+
+	if isRoot(path) {
+		return pathError("rm", path, ErrPermission)
+	}
+
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return pathError("rm", path, err)
+	}
+	if err := fs.checkLocks(p); err != nil {
+		return pathError("rm", path, err)
+	}
+
+	// count the subtree before it's gone
+	var usage map[string]Usage
+	if fs.hasQuotas() {
+		if usage, err = fs.usageOf(p, info); err != nil {
+			return pathError("rm", path, err)
+		}
+	}
+
+	if fs.trashEnabled {
+		err = fs.moveToTrash(p)
+	} else {
+		err = fs.backend.Remove(p)
+	}
+	if err != nil {
+		return pathError("rm", path, err)
+	}
+	fs.releaseQuota(p, usage)
+	fs.dropLocks(p)
+	fs.dropVersions(p)
+	fs.dropDirKeys(p)
+	fs.notify(Event{Op: Delete, Path: p, IsDir: info.IsDir})
+	return nil
+}
+
+// stat(path)
+func (fs *FileSystem) Stat(path string) (FileInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, info, err := fs.lookup(path)
+	if err != nil {
+		return FileInfo{}, pathError("stat", path, err)
+	}
+	return info, nil
+}
+
+// mv(src, dst): moves or renames a node. dst must not exist yet.
+func (fs *FileSystem) Mv(src, dst string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("mv", src, dst, err) }()
+	return fs.mv("mv", src, dst, false)
+}
+
+// replace(src, dst): Mv, except that an existing dst is replaced, like
+// rename(2) does: a file by a file, an empty directory by a directory. The
+// replaced node is gone for good (it doesn't go to the trash), and it all
+// happens under one lock: if the move fails, dst is left as it was.
+func (fs *FileSystem) Replace(src, dst string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("replace", src, dst, err) }()
+	return fs.mv("replace", src, dst, true)
+}
+
+// helper: Mv, or Replace if replace is set, reporting errors for op
+func (fs *FileSystem) mv(op, src, dst string, replace bool) error {
+	if isRoot(src) {
+		return pathError(op, src, ErrPermission)
+	}
+	if isRoot(dst) {
+		return pathError(op, dst, ErrExist)
+	}
+
+	srcPath, info, err := fs.lookup(src)
+	if err != nil {
+		return pathError(op, src, err)
+	}
+	if err := fs.checkLocks(srcPath); err != nil {
+		return pathError(op, src, err)
+	}
+	dstPath, dstInfo, err := fs.lookup(dst)
+	replacing := err == nil
+	switch {
+	case replacing && !replace:
+		return pathError(op, dst, ErrExist)
+	case replacing && dstPath == srcPath:
+		return nil
+	case replacing:
+		if err := fs.checkReplace(dstPath, info, dstInfo); err != nil {
+			return pathError(op, dst, err)
+		}
+	case !errors.Is(err, ErrNotExist):
+		return pathError(op, dst, err)
+	}
+
+	// A directory can't be moved inside itself
+	if info.IsDir && isWithin(dstPath, srcPath) {
+		return pathError(op, dst, ErrInvalidPath)
+	}
+	if err := fs.checkCrossEncryption(srcPath, dstPath); err != nil {
+		return pathError(op, dst, err)
+	}
+
+	var total Usage
+	if len(fs.dirQuotas) > 0 {
+		usage, err := fs.usageOf(srcPath, info)
+		if err != nil {
+			return pathError(op, src, err)
+		}
+		total = sumUsage(usage)
+		if err := fs.checkMoveQuota(srcPath, dstPath, total); err != nil {
+			return pathError(op, dst, err)
+		}
+	}
+	var replaced map[string]Usage
+	if replacing && fs.hasQuotas() {
+		if replaced, err = fs.usageOf(dstPath, dstInfo); err != nil {
+			return pathError(op, dst, err)
+		}
+	}
+
+	if !replacing {
+		err = fs.backend.Rename(srcPath, dstPath)
+	} else {
+		err = fs.renameOver(srcPath, dstPath)
+	}
+	if err != nil {
+		return pathError(op, dst, err)
+	}
+	if replacing {
+		fs.releaseQuota(dstPath, replaced)
+		fs.dropLocks(dstPath)
+		fs.dropVersions(dstPath)
+		fs.dropDirKeys(dstPath)
+		fs.notify(Event{Op: Delete, Path: dstPath, IsDir: dstInfo.IsDir})
+	}
+	fs.moveQuota(srcPath, dstPath, total)
+	fs.moveLocks(srcPath, dstPath)
+	fs.moveVersions(srcPath, dstPath)
+	fs.moveDirKeys(srcPath, dstPath)
+	fs.notify(Event{Op: Rename, Path: dstPath, OldPath: srcPath, IsDir: info.IsDir})
+	return nil
+}
+
+// cp(src, dst): copies a file, or a directory recursively. dst must not
+// exist yet. The copies are owned by the copying user and keep the
+// originals' extended attributes; on the memory backend they share content
+// with the originals in the blob store.
+func (fs *FileSystem) Cp(src, dst string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("cp", src, dst, err) }()
+
+	srcPath, info, err := fs.lookup(src)
+	if err != nil {
+		return pathError("cp", src, err)
+	}
+	if isRoot(dst) {
+		return pathError("cp", dst, ErrExist)
+	}
+	dstPath, err := fs.checkFree(dst)
+	if err != nil {
+		return pathError("cp", dst, err)
+	}
+
+	// A directory can't be copied inside itself
+	if info.IsDir && isWithin(dstPath, srcPath) {
+		return pathError("cp", dst, ErrInvalidPath)
+	}
+	if err := fs.checkCrossEncryption(srcPath, dstPath); err != nil {
+		return pathError("cp", dst, err)
+	}
+
+	usage, err := fs.usageOf(srcPath, info)
+	if err != nil {
+		return pathError("cp", src, err)
+	}
+	delta := sumUsage(usage)
+	if err := fs.checkQuota(dstPath, fs.user, delta); err != nil {
+		return pathError("cp", dst, err)
+	}
+
+	if err := fs.copyTree(srcPath, dstPath, info); err != nil {
+		// don't leave half a copy behind, and say so if that fails too
+		if rmErr := fs.backend.Remove(dstPath); rmErr != nil {
+			err = errors.Join(err, rmErr)
+			fs.rescanEncrypted(dstPath)
+		}
+		return pathError("cp", dst, err)
+	}
+	fs.chargeQuota(dstPath, fs.user, delta)
+	fs.rescanEncrypted(dstPath)
+	fs.notify(Event{Op: Create, Path: dstPath, IsDir: info.IsDir})
+	return nil
+}
+
+// helper: copies the node at src (described by info) and everything below
+// it to dst, owned by the handle's user
+func (fs *FileSystem) copyTree(src, dst string, info FileInfo) error {
+	return fs.walk(src, info, func(path string, info FileInfo) error {
+		target := dst + strings.TrimPrefix(path, src)
+		if info.IsDir {
+			if err := fs.backend.Mkdir(target, fs.user); err != nil {
+				return err
+			}
+		} else {
+			content, err := fs.backend.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := fs.backend.Create(target, content, fs.user); err != nil {
+				return err
+			}
+		}
+		return copyXattrs(fs.backend, path, fs.backend, target)
+	})
+}
+
+// helper: checks the node at dst (described by dstInfo) can be replaced by
+// one described by info
+func (fs *FileSystem) checkReplace(dst string, info, dstInfo FileInfo) error {
+	switch {
+	case info.IsDir && !dstInfo.IsDir:
+		return ErrNotDir
+	case !info.IsDir && dstInfo.IsDir:
+		return ErrIsDir
+	case len(fs.backend.mountsWithin(dst)) > 0:
+		return ErrPermission
+	}
+	if dstInfo.IsDir {
+		entries, err := fs.backend.ReadDir(dst)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return ErrExist
+		}
+	}
+	return fs.checkLocks(dst)
+}
+
+// helper: renames src to dst, which exists and is replaced. dst is set
+// aside first and only removed once src is in its place, so a failed
+// rename leaves it as it was.
+func (fs *FileSystem) renameOver(src, dst string) error {
+	dir, _ := splitPath(dst)
+	aside := joinPath(dir, ".vfs-replaced-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	if err := fs.backend.Rename(dst, aside); err != nil {
+		return err
+	}
+	if err := fs.backend.Rename(src, dst); err != nil {
+		fs.backend.Rename(aside, dst)
+		return err
+	}
+	// the move is done; should this fail, the old node just lingers,
+	// hidden, under its aside name
+	fs.backend.Remove(aside)
+	return nil
+}
+
+// helper: checks nothing exists at path yet and returns its clean form.
+// A missing parent is left for the backend to report.
+func (fs *FileSystem) checkFree(path string) (string, error) {
+	p, _, err := fs.lookup(path)
+	switch {
+	case err == nil:
+		return "", ErrExist
+	case errors.Is(err, ErrNotExist):
+		return p, nil
+	}
+	return "", err
+}
+
+// helper: reports whether path is base itself or somewhere below it
+func isWithin(path, base string) bool {
+	if isClean(path) && isClean(base) {
+		return base == "/" || path == base ||
+			(len(path) > len(base) && path[len(base)] == '/' && path[:len(base)] == base)
+	}
+	p, b := parsePath(path), parsePath(base)
+	if len(p) < len(b) {
+		return false
+	}
+	return strings.Join(p[:len(b)], "/") == strings.Join(b, "/")
+}
@@ -0,0 +1,446 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// names the overlay keeps in the upper layer; they never show up in the
+// merged tree and can't be created through it
+const (
+	whiteoutPrefix = ".wh."         // ".wh.<name>" hides <name> of the lower layer
+	opaqueMarker   = ".wh..wh..opq" // in a directory, hides the whole lower one
+)
+
+// OverlayBackend merges a read-only lower tree, typically a fixture, with
+// a writable upper one. Reads see the upper layer where it has a node and
+// the lower one elsewhere, and directories list the entries of both.
+// Changes only ever go to the upper layer: a lower file is copied up before
+// it is written, and removing a lower node leaves a whiteout in the upper
+// layer that hides it. Whiteouts are ordinary marker files, so they persist
+// with the upper backend.
+type OverlayBackend struct {
+	lower, upper Backend
+}
+
+func NewOverlayBackend(lower, upper Backend) *OverlayBackend {
+	return &OverlayBackend{lower: lower, upper: upper}
+}
+
+// Close closes both layers, where they need closing
+func (o *OverlayBackend) Close() error {
+	var err error
+	for _, b := range []Backend{o.upper, o.lower} {
+		if c, ok := b.(io.Closer); ok {
+			if closeErr := c.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+func (o *OverlayBackend) Stat(path string) (FileInfo, error) {
+	_, info, err := o.layer(path)
+	return info, err
+}
+
+func (o *OverlayBackend) ReadDir(path string) ([]FileInfo, error) {
+	info, err := o.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir {
+		return nil, ErrNotDir
+	}
+
+	// upper entries win; whiteouts name the lower ones to skip
+	seen := make(map[string]bool)
+	var result []FileInfo
+	upper, err := o.upper.ReadDir(path)
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range upper {
+		if strings.HasPrefix(e.Name, whiteoutPrefix) {
+			seen[strings.TrimPrefix(e.Name, whiteoutPrefix)] = true
+			continue
+		}
+		seen[e.Name] = true
+		result = append(result, e)
+	}
+
+	if !o.lowerHidden(path) && !o.isOpaque(path) {
+		// the lower layer may have nothing here, or a file: nothing to merge
+		lower, _ := o.lower.ReadDir(path)
+		for _, e := range lower {
+			if !seen[e.Name] && !strings.HasPrefix(e.Name, whiteoutPrefix) {
+				result = append(result, e)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (o *OverlayBackend) Mkdir(path, owner string) error {
+	if err := o.checkNew(path); err != nil {
+		return err
+	}
+	hadWhiteout, err := o.clearWhiteout(path)
+	if err != nil {
+		return err
+	}
+	if err := o.upper.Mkdir(path, owner); err != nil {
+		return err
+	}
+	// a removed lower directory must not show through the new one
+	if hadWhiteout {
+		return o.upper.Create(joinPath(path, opaqueMarker), "", "")
+	}
+	return nil
+}
+
+func (o *OverlayBackend) Create(path, content, owner string) error {
+	if err := o.checkNew(path); err != nil {
+		return err
+	}
+	if _, err := o.clearWhiteout(path); err != nil {
+		return err
+	}
+	return o.upper.Create(path, content, owner)
+}
+
+func (o *OverlayBackend) ReadFile(path string) (string, error) {
+	b, info, err := o.layer(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir {
+		return "", ErrIsDir
+	}
+	return b.ReadFile(path)
+}
+
+func (o *OverlayBackend) Open(path string) (io.ReadCloser, error) {
+	b, info, err := o.layer(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir {
+		return nil, ErrIsDir
+	}
+	return b.Open(path)
+}
+
+func (o *OverlayBackend) WriteFile(path, content string) error {
+	b, info, err := o.layer(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		return ErrIsDir
+	}
+	if b == o.upper {
+		return o.upper.WriteFile(path, content)
+	}
+
+	// copy up: the new content goes to the upper layer, the lower file stays
+	dir, _ := splitPath(path)
+	if err := o.copyUp(dir); err != nil {
+		return err
+	}
+	if err := o.upper.Create(path, content, info.Owner); err != nil {
+		return err
+	}
+	return copyXattrs(o.lower, path, o.upper, path)
+}
+
+func (o *OverlayBackend) Remove(path string) error {
+	b, _, err := o.layer(path)
+	if err != nil {
+		return err
+	}
+	inLower := o.inLower(path)
+
+	if b == o.upper {
+		if err := o.upper.Remove(path); err != nil {
+			return err
+		}
+	}
+	if !inLower {
+		return nil
+	}
+
+	dir, name := splitPath(path)
+	if err := o.copyUp(dir); err != nil {
+		return err
+	}
+	return o.upper.Create(joinPath(dir, whiteoutPrefix+name), "", "")
+}
+
+func (o *OverlayBackend) Rename(oldpath, newpath string) error {
+	b, info, err := o.layer(oldpath)
+	if err != nil {
+		return err
+	}
+	if err := o.checkNew(newpath); err != nil {
+		return err
+	}
+
+	// anything involving the lower layer is copied up under the new name
+	// and then removed, which leaves a whiteout
+	if b != o.upper || o.inLower(oldpath) {
+		if err := o.copyTree(oldpath, newpath, info); err != nil {
+			return err
+		}
+		return o.Remove(oldpath)
+	}
+
+	hadWhiteout, err := o.clearWhiteout(newpath)
+	if err != nil {
+		return err
+	}
+	if err := o.upper.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	if hadWhiteout && info.IsDir {
+		err := o.upper.Create(joinPath(newpath, opaqueMarker), "", "")
+		if err != nil && !errors.Is(err, ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *OverlayBackend) Xattrs(path string) (map[string]string, error) {
+	b, _, err := o.layer(path)
+	if err != nil {
+		return nil, err
+	}
+	xb, ok := b.(XattrBackend)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return xb.Xattrs(path)
+}
+
+func (o *OverlayBackend) SetXattr(path, name, value string) error {
+	xb, err := o.copyUpNode(path)
+	if err != nil {
+		return err
+	}
+	return xb.SetXattr(path, name, value)
+}
+
+func (o *OverlayBackend) RemoveXattr(path, name string) error {
+	xb, err := o.copyUpNode(path)
+	if err != nil {
+		return err
+	}
+	return xb.RemoveXattr(path, name)
+}
+
+// helper: makes sure the node at path is in the upper layer, copying a
+// lower file up with its content, so its attributes can be changed there
+func (o *OverlayBackend) copyUpNode(path string) (XattrBackend, error) {
+	xb, ok := o.upper.(XattrBackend)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	b, info, err := o.layer(path)
+	if err != nil || b == o.upper {
+		return xb, err
+	}
+	if info.IsDir {
+		return xb, o.copyUp(path)
+	}
+
+	dir, _ := splitPath(path)
+	if err := o.copyUp(dir); err != nil {
+		return nil, err
+	}
+	content, err := o.lower.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.upper.Create(path, content, info.Owner); err != nil {
+		return nil, err
+	}
+	return xb, copyXattrs(o.lower, path, o.upper, path)
+}
+
+// helper: the layer path is read from, upper if it has the node and lower
+// otherwise, and the node's info
+func (o *OverlayBackend) layer(path string) (Backend, FileInfo, error) {
+	if _, name := splitPath(path); strings.HasPrefix(name, whiteoutPrefix) {
+		return nil, FileInfo{}, ErrNotExist
+	}
+
+	info, err := o.upper.Stat(path)
+	if err == nil {
+		return o.upper, info, nil
+	}
+	if !errors.Is(err, ErrNotExist) || o.lowerHidden(path) {
+		return nil, FileInfo{}, err
+	}
+
+	info, err = o.lower.Stat(path)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	return o.lower, info, nil
+}
+
+// helper: reports whether the upper layer hides the lower one at path,
+// with a whiteout on path or an ancestor, a file in place of an ancestor,
+// or an opaque directory above it
+func (o *OverlayBackend) lowerHidden(path string) bool {
+	dir := "/"
+	for _, name := range parsePath(path) {
+		if o.isOpaque(dir) || o.upperHas(joinPath(dir, whiteoutPrefix+name)) {
+			return true
+		}
+		dir = joinPath(dir, name)
+		if dir != path {
+			if info, err := o.upper.Stat(dir); err == nil && !info.IsDir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// helper: reports whether the lower layer has a node at path that shows
+// through (or would, without the upper node at the same path)
+func (o *OverlayBackend) inLower(path string) bool {
+	if o.lowerHidden(path) {
+		return false
+	}
+	_, err := o.lower.Stat(path)
+	return err == nil
+}
+
+func (o *OverlayBackend) isOpaque(dir string) bool {
+	return o.upperHas(joinPath(dir, opaqueMarker))
+}
+
+func (o *OverlayBackend) upperHas(path string) bool {
+	_, err := o.upper.Stat(path)
+	return err == nil
+}
+
+// helper: checks a node can be created at path: it doesn't exist yet, its
+// parent is a directory, and its name isn't reserved. The parent is copied
+// up so the node can be created in the upper layer.
+func (o *OverlayBackend) checkNew(path string) error {
+	dir, name := splitPath(path)
+	if strings.HasPrefix(name, whiteoutPrefix) {
+		return ErrInvalidPath
+	}
+
+	_, _, err := o.layer(path)
+	if err == nil {
+		return ErrExist
+	}
+	if !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	parent, err := o.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !parent.IsDir {
+		return ErrNotDir
+	}
+	return o.copyUp(dir)
+}
+
+// helper: makes sure the directory at path exists in the upper layer,
+// creating it and its ancestors like their lower counterparts
+func (o *OverlayBackend) copyUp(path string) error {
+	current := "/"
+	for _, name := range parsePath(path) {
+		current = joinPath(current, name)
+		info, err := o.upper.Stat(current)
+		if err == nil {
+			if !info.IsDir {
+				return ErrNotDir
+			}
+			continue
+		}
+		if !errors.Is(err, ErrNotExist) {
+			return err
+		}
+
+		info, err = o.Stat(current)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir {
+			return ErrNotDir
+		}
+		if err := o.upper.Mkdir(current, info.Owner); err != nil {
+			return err
+		}
+		if err := copyXattrs(o.lower, current, o.upper, current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper: removes the whiteout for path, reporting whether there was one
+func (o *OverlayBackend) clearWhiteout(path string) (bool, error) {
+	dir, name := splitPath(path)
+	whiteout := joinPath(dir, whiteoutPrefix+name)
+	if !o.upperHas(whiteout) {
+		return false, nil
+	}
+	return true, o.upper.Remove(whiteout)
+}
+
+// helper: copies the merged node at src (described by info) and everything
+// below it to dst, keeping owners
+func (o *OverlayBackend) copyTree(src, dst string, info FileInfo) error {
+	if !info.IsDir {
+		content, err := o.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := o.Create(dst, content, info.Owner); err != nil {
+			return err
+		}
+		return copyXattrs(o, src, o.upper, dst)
+	}
+
+	if err := o.Mkdir(dst, info.Owner); err != nil {
+		return err
+	}
+	if err := copyXattrs(o, src, o.upper, dst); err != nil {
+		return err
+	}
+	children, err := o.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := o.copyTree(joinPath(src, child.Name), joinPath(dst, child.Name), child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper: splits a clean absolute path into its parent directory and name
+func splitPath(path string) (string, string) {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/", path[i+1:]
+	}
+	return path[:i], path[i+1:]
+}
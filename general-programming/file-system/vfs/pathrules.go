@@ -0,0 +1,269 @@
+package vfs
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PathRules are the naming rules every path given to a FileSystem must
+// follow, in every operation. The zero value only rejects control
+// characters (besides "." and ".." as names, which are always invalid).
+type PathRules struct {
+	// MaxNameLength is the most bytes a name can have (0: no limit);
+	// longer ones fail with ErrNameTooLong
+	MaxNameLength int
+	// MaxPathLength is the most bytes a cleaned path can have (0: no
+	// limit); longer ones fail with ErrPathTooLong
+	MaxPathLength int
+
+	// ReservedNames can't be used as names, e.g. "CON" and "NUL" for trees
+	// meant for Windows; they fail with ErrReservedName
+	ReservedNames []string
+	// ForbiddenChars are characters names can't contain, on top of
+	// control characters unless AllowControlChars is set. Both fail with
+	// ErrInvalidChar.
+	ForbiddenChars    string
+	AllowControlChars bool
+
+	// StrictSlashes rejects paths that aren't absolute or have empty names
+	// ("a/b", "/a//b", "/a/"), instead of cleaning them
+	StrictSlashes bool
+	// Normalize turns names into Unicode NFC, so a name typed composed
+	// ("é") or decomposed ("e" + U+0301) is the same name
+	Normalize bool
+	// CaseInsensitive makes names differing only in case refer to the same
+	// node: paths resolve to the existing node's name, and creating a node
+	// fails with ErrExist if its name only differs by case from a
+	// sibling's. Reserved names match whatever their case.
+	CaseInsensitive bool
+}
+
+// DefaultPathRules are the rules of a new FileSystem: the usual Unix
+// length limits, and no control characters
+var DefaultPathRules = PathRules{MaxNameLength: 255, MaxPathLength: 4096}
+
+// SetPathRules replaces the naming rules. Existing nodes keep their names,
+// so ones that break the new rules can't be reached until the rules allow
+// them again.
+func (fs *FileSystem) SetPathRules(r PathRules) error {
+	if r.MaxNameLength < 0 || r.MaxPathLength < 0 || strings.Contains(r.ForbiddenChars, "/") {
+		fs.recordUnlocked("pathrules", "/", iofs.ErrInvalid)
+		return iofs.ErrInvalid
+	}
+	r.ReservedNames = slices.Clone(r.ReservedNames)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.rules = r
+	fs.folds.invalidate("/")
+	fs.recordSetting("pathrules", "/", fmt.Sprintf("%+v", r), nil)
+	return nil
+}
+
+// PathRules returns the naming rules
+func (fs *FileSystem) PathRules() PathRules {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	r := fs.rules
+	r.ReservedNames = slices.Clone(r.ReservedNames)
+	return r
+}
+
+// helper: validates a path from the caller against the rules and returns
+// the clean absolute form backends expect. Errors are bare sentinels;
+// callers wrap them in a PathError for their op. Callers hold fs.mu.
+func (fs *FileSystem) checkPath(path string) (string, error) {
+	if path == "" {
+		return "", ErrInvalidPath
+	}
+	r := &fs.rules
+	if r.StrictSlashes && path != "/" {
+		if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") || strings.Contains(path, "//") {
+			return "", ErrInvalidPath
+		}
+	}
+
+	names := parsePath(path)
+	for i, name := range names {
+		if name == "." || name == ".." {
+			return "", ErrInvalidPath
+		}
+		if r.Normalize {
+			name = norm.NFC.String(name)
+		}
+		if err := r.checkName(name); err != nil {
+			return "", err
+		}
+		names[i] = name
+	}
+	if r.CaseInsensitive {
+		fs.matchCase(names)
+	}
+
+	p := "/" + strings.Join(names, "/")
+	if r.MaxPathLength > 0 && len(p) > r.MaxPathLength {
+		return "", ErrPathTooLong
+	}
+	return p, nil
+}
+
+// helper: checkPath, for callers not holding fs.mu
+func (fs *FileSystem) resolvePath(path string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.checkPath(path)
+}
+
+// helper: checks one name against the rules
+func (r *PathRules) checkName(name string) error {
+	if r.MaxNameLength > 0 && len(name) > r.MaxNameLength {
+		return ErrNameTooLong
+	}
+	for _, reserved := range r.ReservedNames {
+		if name == reserved || (r.CaseInsensitive && strings.EqualFold(name, reserved)) {
+			return ErrReservedName
+		}
+	}
+	if strings.ContainsAny(name, r.ForbiddenChars) {
+		return ErrInvalidChar
+	}
+	if !r.AllowControlChars && strings.ContainsFunc(name, unicode.IsControl) {
+		return ErrInvalidChar
+	}
+	return nil
+}
+
+// helper: replaces each name with the name of the existing node it matches
+// regardless of case, as far down as the nodes exist. An exact match wins
+// over other spellings, then the first one in name order.
+func (fs *FileSystem) matchCase(names []string) {
+	dir := "/"
+	for i, name := range names {
+		entries, ok := fs.folds.get(dir)
+		if !ok {
+			infos, err := fs.backend.ReadDir(dir)
+			if err != nil {
+				return
+			}
+			entries = newFoldedDir(infos)
+			fs.folds.put(dir, entries)
+		}
+		match, ok := entries.match(name)
+		if !ok {
+			return
+		}
+		names[i] = match
+		dir = joinPath(dir, match)
+	}
+}
+
+// foldCache remembers the names in each directory matchCase has looked
+// in, by their case folding, so resolving a path only lists the
+// directories along it the first time. Changes made through the
+// FileSystem drop the directories they touch (see update), like the
+// dentry cache; changes made to a backend around it aren't seen. Lookups
+// fill it under fs.mu's read lock, so it has a lock of its own.
+type foldCache struct {
+	mu   sync.Mutex
+	dirs map[string]*foldedDir // by cleaned path
+}
+
+// foldedDir is the names in a directory
+type foldedDir struct {
+	names  map[string]bool
+	folded map[string]string // by foldName, the first name in name order
+}
+
+func newFoldCache() *foldCache {
+	return &foldCache{dirs: make(map[string]*foldedDir)}
+}
+
+// helper: the names of entries, sorted by name as ReadDir returns them
+func newFoldedDir(entries []FileInfo) *foldedDir {
+	d := &foldedDir{names: make(map[string]bool, len(entries)), folded: make(map[string]string, len(entries))}
+	for _, e := range entries {
+		d.names[e.Name] = true
+		key := foldName(e.Name)
+		if _, ok := d.folded[key]; !ok {
+			d.folded[key] = e.Name
+		}
+	}
+	return d
+}
+
+// helper: the name in the directory that name matches regardless of case
+func (d *foldedDir) match(name string) (string, bool) {
+	if d.names[name] {
+		return name, true
+	}
+	match, ok := d.folded[foldName(name)]
+	return match, ok
+}
+
+// helper: name with every rune replaced by the smallest one it equals
+// regardless of case, so names strings.EqualFold finds equal fold the same
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		smallest := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			smallest = min(smallest, f)
+		}
+		return smallest
+	}, name)
+}
+
+// helper: the names cached for the directory at path
+func (c *foldCache) get(path string) (*foldedDir, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.dirs[path]
+	return d, ok
+}
+
+// helper: caches the names in the directory at path
+func (c *foldCache) put(path string, d *foldedDir) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirs[path] = d
+}
+
+// helper: drops the directories whose entries ev changed: the parents of
+// its paths, and everything at or below a removed or moved directory
+func (c *foldCache) update(ev Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, path := range []string{ev.Path, ev.OldPath} {
+		if path == "" {
+			continue
+		}
+		parent, _ := splitPath(path)
+		delete(c.dirs, parent)
+		if ev.IsDir && (ev.Op == Delete || path == ev.OldPath) {
+			c.dropWithin(path)
+		}
+	}
+}
+
+// helper: drops the directory at path and every one below it, as when a
+// mount replaces them
+func (c *foldCache) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropWithin(path)
+}
+
+// helper: drops the directory at path and every one below it. Callers
+// hold c.mu.
+func (c *foldCache) dropWithin(path string) {
+	for p := range c.dirs {
+		if isWithin(p, path) {
+			delete(c.dirs, p)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestPathRules checks every rule rejects what it should, with its error
+func TestPathRules(t *testing.T) {
+	long := "/" + strings.Repeat(strings.Repeat("d", 200)+"/", 21) + "f"
+
+	tests := []struct {
+		name  string
+		rules PathRules
+		path  string
+		want  error
+	}{
+		{"control char", DefaultPathRules, "/a\x01b", ErrInvalidChar},
+		{"control chars allowed", PathRules{AllowControlChars: true}, "/a\x01b", nil},
+		{"name at limit", DefaultPathRules, "/" + strings.Repeat("n", 255), nil},
+		{"name too long", DefaultPathRules, "/" + strings.Repeat("n", 256), ErrNameTooLong},
+		{"path too long", DefaultPathRules, long, ErrPathTooLong},
+		{"no limits", PathRules{}, "/" + strings.Repeat("n", 256), nil},
+		{"slashes cleaned", DefaultPathRules, "a//b/", nil},
+		{"relative", PathRules{StrictSlashes: true}, "a", ErrInvalidPath},
+		{"empty name", PathRules{StrictSlashes: true}, "/a//b", ErrInvalidPath},
+		{"trailing slash", PathRules{StrictSlashes: true}, "/a/", ErrInvalidPath},
+		{"strict", PathRules{StrictSlashes: true}, "/a/b", nil},
+		{"reserved", PathRules{ReservedNames: []string{"CON"}}, "/x/CON", ErrReservedName},
+		{"reserved other case", PathRules{ReservedNames: []string{"CON"}}, "/con", nil},
+		{"reserved any case", PathRules{ReservedNames: []string{"CON"}, CaseInsensitive: true}, "/con", ErrReservedName},
+		{"forbidden char", PathRules{ForbiddenChars: `<>:"|?*`}, "/what?", ErrInvalidChar},
+		{"dot dot", PathRules{}, "/a/../b", ErrInvalidPath},
+	}
+	for _, tt := range tests {
+		fs := NewFileSystem()
+		if err := fs.SetPathRules(tt.rules); err != nil {
+			t.Fatalf("%s: SetPathRules() failed: %v", tt.name, err)
+		}
+		_, err := fs.Stat(tt.path)
+		if tt.want == nil {
+			// valid, so just not there
+			tt.want = ErrNotExist
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Stat() error = %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want != ErrNotExist && !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%s: Stat() error = %v, should be an ErrInvalidPath", tt.name, err)
+		}
+	}
+
+	fs := NewFileSystem()
+	if err := fs.SetPathRules(PathRules{MaxNameLength: -1}); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("SetPathRules(negative) error = %v, want ErrInvalid", err)
+	}
+	if err := fs.Touch("/a\nb", ""); !errors.Is(err, ErrInvalidChar) {
+		t.Errorf("Touch() error = %v, want ErrInvalidChar", err)
+	}
+}
+
+// TestPathRulesNormalize checks composed and decomposed names are one name
+func TestPathRulesNormalize(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.SetPathRules(PathRules{Normalize: true})
+	if err := fs.Touch("/café.txt", "coffee"); err != nil {
+		t.Fatalf("Touch() failed: %v", err)
+	}
+	if content, err := fs.Cat("/café.txt"); err != nil || content != "coffee" {
+		t.Errorf("Cat(composed) = %q, %v", content, err)
+	}
+	if names, _ := fs.Ls("/"); !reflect.DeepEqual(names, []string{"café.txt"}) {
+		t.Errorf("Ls() = %q, want the composed name", names)
+	}
+}
+
+// TestPathRulesCaseInsensitive checks names resolve to their node whatever
+// their case
+func TestPathRulesCaseInsensitive(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Touch("/a", "lower")
+	_ = fs.Touch("/A", "upper")
+	_ = fs.SetPathRules(PathRules{CaseInsensitive: true})
+
+	_ = fs.Mkdir("/Docs")
+	if err := fs.Touch("/DOCS/Readme.md", "hi"); err != nil {
+		t.Fatalf("Touch() failed: %v", err)
+	}
+	if content, err := fs.Cat("/docs/README.MD"); err != nil || content != "hi" {
+		t.Errorf("Cat() = %q, %v", content, err)
+	}
+	if err := fs.Touch("/docs/readme.md", ""); !errors.Is(err, ErrExist) {
+		t.Errorf("Touch() of a name differing by case error = %v, want ErrExist", err)
+	}
+	if names, _ := fs.Ls("/docs"); !reflect.DeepEqual(names, []string{"Readme.md"}) {
+		t.Errorf("Ls() = %v, want the name as created", names)
+	}
+
+	// an exact match wins
+	if content, _ := fs.Cat("/A"); content != "upper" {
+		t.Errorf("Cat(/A) = %q, want upper", content)
+	}
+}
+
+// TestPathRulesCaseInsensitiveChanges checks names are matched against the
+// tree as it is now, after the directories along a path were listed
+func TestPathRulesCaseInsensitiveChanges(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.SetPathRules(PathRules{CaseInsensitive: true})
+	_ = fs.Mkdir("/Docs")
+	_ = fs.Touch("/docs/Old.txt", "old")
+	_, _ = fs.Cat("/DOCS/OLD.TXT") // lists / and /Docs
+
+	steps := []struct {
+		name string
+		err  error
+	}{
+		{"Rm", fs.Rm("/docs/old.txt")},
+		{"Touch again", fs.Touch("/docs/OLD.txt", "new")},
+		{"Mv parent", fs.Mv("/docs", "/Papers")},
+		{"Mkdir old name", fs.Mkdir("/DOCS")},
+		{"Touch below", fs.Touch("/docs/x", "")},
+	}
+	for _, step := range steps {
+		if step.err != nil {
+			t.Fatalf("%s failed: %v", step.name, step.err)
+		}
+	}
+	if names, _ := fs.Ls("/"); !reflect.DeepEqual(names, []string{"DOCS", "Papers"}) {
+		t.Errorf("Ls(/) = %v, want [DOCS Papers]", names)
+	}
+	if content, err := fs.Cat("/papers/old.txt"); err != nil || content != "new" {
+		t.Errorf("Cat(/papers/old.txt) = %q, %v, want new", content, err)
+	}
+	if names, _ := fs.Ls("/Papers"); !reflect.DeepEqual(names, []string{"OLD.txt"}) {
+		t.Errorf("Ls(/Papers) = %v, want [OLD.txt]", names)
+	}
+
+	// what a mount hides or uncovers, too
+	m := NewMemoryBackend()
+	_ = m.Create("/Inner.txt", "inner", DefaultUser)
+	if err := fs.Mount("/docs", m); err != nil {
+		t.Fatalf("Mount() failed: %v", err)
+	}
+	if content, err := fs.Cat("/DOCS/inner.TXT"); err != nil || content != "inner" {
+		t.Errorf("Cat() below the mount = %q, %v, want inner", content, err)
+	}
+	_ = fs.Unmount("/docs")
+	if _, err := fs.Stat("/docs/X"); err != nil {
+		t.Errorf("Stat() after Unmount failed: %v", err)
+	}
+}
+
+// BenchmarkStatCaseInsensitive resolves files of 100 directories of 1000
+// files in another case than they were made with
+func BenchmarkStatCaseInsensitive(b *testing.B) {
+	fs, paths := wideTree(b, 100, 1000)
+	_ = fs.SetPathRules(PathRules{CaseInsensitive: true})
+	for i, p := range paths {
+		paths[i] = strings.ToUpper(p)
+	}
+	i := 0
+	for b.Loop() {
+		if _, err := fs.Stat(paths[i%len(paths)]); err != nil {
+			b.Fatal(err)
+		}
+		i++
+	}
+}
@@ -0,0 +1,303 @@
+package vfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quota limits the space used below a directory or by a user.
+// A zero field means that dimension is unlimited.
+type Quota struct {
+	MaxBytes  int64 // total file content
+	MaxInodes int64 // number of files and directories
+}
+
+func (q Quota) String() string {
+	limit := func(n int64) string {
+		if n == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("bytes %s, inodes %s", limit(q.MaxBytes), limit(q.MaxInodes))
+}
+
+// Usage is the space counted against a quota
+type Usage struct {
+	Bytes  int64
+	Inodes int64
+}
+
+func (u Usage) add(other Usage) Usage {
+	return Usage{Bytes: u.Bytes + other.Bytes, Inodes: u.Inodes + other.Inodes}
+}
+
+func (u Usage) neg() Usage {
+	return Usage{Bytes: -u.Bytes, Inodes: -u.Inodes}
+}
+
+// QuotaReport describes one configured quota and what it currently counts.
+// Exactly one of Path and User is set.
+type QuotaReport struct {
+	Path  string
+	User  string
+	Limit Quota
+	Used  Usage
+}
+
+// quota is a configured limit and the usage counted against it so far
+type quota struct {
+	limit Quota
+	used  Usage
+}
+
+// helper: reports whether adding delta keeps the quota within its limit.
+// Only growth is checked, so shrinking is always allowed, even when a
+// quota was set below what was already in use.
+func (q *quota) allows(delta Usage) bool {
+	if q.limit.MaxBytes > 0 && delta.Bytes > 0 && q.used.Bytes+delta.Bytes > q.limit.MaxBytes {
+		return false
+	}
+	if q.limit.MaxInodes > 0 && delta.Inodes > 0 && q.used.Inodes+delta.Inodes > q.limit.MaxInodes {
+		return false
+	}
+	return true
+}
+
+// SetQuota limits everything below the directory at path (the directory
+// itself is not counted). A zero Quota removes the limit. The quota moves
+// with the directory and disappears when it is removed.
+func (fs *FileSystem) SetQuota(path string, q Quota) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.recordSetting("quota", path, q.String(), err) }()
+
+	key, info, err := fs.lookup(path)
+	if err != nil {
+		return pathError("quota", path, err)
+	}
+	if !info.IsDir {
+		return pathError("quota", path, ErrNotDir)
+	}
+
+	if q == (Quota{}) {
+		delete(fs.dirQuotas, key)
+		return nil
+	}
+
+	// count what's already there, minus the directory itself
+	usage, err := fs.usageOf(key, info)
+	if err != nil {
+		return pathError("quota", path, err)
+	}
+	used := sumUsage(usage)
+	used.Inodes--
+	fs.dirQuotas[key] = &quota{limit: q, used: used}
+	return nil
+}
+
+// SetUserQuota limits the nodes owned by user across the whole tree.
+// A zero Quota removes the limit.
+func (fs *FileSystem) SetUserQuota(user string, q Quota) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.recordSetting("userquota", "/", user+": "+q.String(), err) }()
+
+	if q == (Quota{}) {
+		delete(fs.userQuotas, user)
+		return nil
+	}
+
+	root, err := fs.backend.Stat("/")
+	if err != nil {
+		return pathError("quota", "/", err)
+	}
+	usage, err := fs.usageOf("/", root)
+	if err != nil {
+		return pathError("quota", "/", err)
+	}
+	fs.userQuotas[user] = &quota{limit: q, used: usage[user]}
+	return nil
+}
+
+// Quotas reports every configured quota, directories first, sorted by
+// path and then by user
+func (fs *FileSystem) Quotas() []QuotaReport {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var dirs, users []QuotaReport
+	for path, q := range fs.dirQuotas {
+		dirs = append(dirs, QuotaReport{Path: path, Limit: q.limit, Used: q.used})
+	}
+	for user, q := range fs.userQuotas {
+		users = append(users, QuotaReport{User: user, Limit: q.limit, Used: q.used})
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Path < dirs[j].Path })
+	sort.Slice(users, func(i, j int) bool { return users[i].User < users[j].User })
+	return append(dirs, users...)
+}
+
+// helper: the directory quotas that count a node at path, i.e. those set
+// on one of its ancestors
+func (fs *FileSystem) dirQuotasFor(path string) []*quota {
+	path = cleanPath(path)
+	var result []*quota
+	for root, q := range fs.dirQuotas {
+		if root != path && isWithin(path, root) {
+			result = append(result, q)
+		}
+	}
+	return result
+}
+
+// helper: checks that growing the tree by delta at path, for a node owned
+// by owner, stays within every quota involved
+func (fs *FileSystem) checkQuota(path, owner string, delta Usage) error {
+	if q, ok := fs.userQuotas[owner]; ok && !q.allows(delta) {
+		return ErrQuotaExceeded
+	}
+	for _, q := range fs.dirQuotasFor(path) {
+		if !q.allows(delta) {
+			return ErrQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// helper: checks that adding a subtree with usage (by owner, as counted by
+// usageOf) at path stays within every quota involved
+func (fs *FileSystem) checkAddQuota(path string, usage map[string]Usage) error {
+	for owner, u := range usage {
+		if q, ok := fs.userQuotas[owner]; ok && !q.allows(u) {
+			return ErrQuotaExceeded
+		}
+	}
+	total := sumUsage(usage)
+	for _, q := range fs.dirQuotasFor(path) {
+		if !q.allows(total) {
+			return ErrQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// helper: counts delta against every quota involved
+func (fs *FileSystem) chargeQuota(path, owner string, delta Usage) {
+	if q, ok := fs.userQuotas[owner]; ok {
+		q.used = q.used.add(delta)
+	}
+	for _, q := range fs.dirQuotasFor(path) {
+		q.used = q.used.add(delta)
+	}
+}
+
+// helper: gives back the space of a removed subtree, as counted by usageOf
+// before removing it, and drops the quotas that were set inside it
+func (fs *FileSystem) releaseQuota(path string, usage map[string]Usage) {
+	if !fs.hasQuotas() {
+		return
+	}
+
+	for owner, u := range usage {
+		fs.chargeQuota(path, owner, u.neg())
+	}
+
+	for root := range fs.dirQuotas {
+		if isWithin(root, path) {
+			delete(fs.dirQuotas, root)
+		}
+	}
+}
+
+// helper: checks that moving a subtree using total from src to dst stays
+// within the directory quotas it enters. User quotas don't change on a move.
+func (fs *FileSystem) checkMoveQuota(src, dst string, total Usage) error {
+	if len(fs.dirQuotas) == 0 {
+		return nil
+	}
+
+	before := fs.dirQuotasFor(src)
+	for _, q := range fs.dirQuotasFor(dst) {
+		if !containsQuota(before, q) && !q.allows(total) {
+			return ErrQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// helper: moves the usage total of a subtree from the quotas covering src
+// to those covering dst, and re-keys quotas set inside the subtree
+func (fs *FileSystem) moveQuota(src, dst string, total Usage) {
+	if len(fs.dirQuotas) == 0 {
+		return
+	}
+
+	before, after := fs.dirQuotasFor(src), fs.dirQuotasFor(dst)
+	for _, q := range before {
+		if !containsQuota(after, q) {
+			q.used = q.used.add(total.neg())
+		}
+	}
+	for _, q := range after {
+		if !containsQuota(before, q) {
+			q.used = q.used.add(total)
+		}
+	}
+
+	src, dst = cleanPath(src), cleanPath(dst)
+	moved := make(map[string]*quota)
+	for root, q := range fs.dirQuotas {
+		if isWithin(root, src) {
+			delete(fs.dirQuotas, root)
+			moved[dst+strings.TrimPrefix(root, src)] = q
+		}
+	}
+	for root, q := range moved {
+		fs.dirQuotas[root] = q
+	}
+}
+
+// helper: skips the subtree walks above when nothing is limited
+func (fs *FileSystem) hasQuotas() bool {
+	return len(fs.dirQuotas) > 0 || len(fs.userQuotas) > 0
+}
+
+func containsQuota(quotas []*quota, q *quota) bool {
+	for _, other := range quotas {
+		if other == q {
+			return true
+		}
+	}
+	return false
+}
+
+// helper: the usage of the subtree at path (described by info, and
+// included itself), by owner
+func (fs *FileSystem) usageOf(path string, info FileInfo) (map[string]Usage, error) {
+	return usageIn(fs.backend, path, info)
+}
+
+// helper: usageOf, on a backend
+func usageIn(b Backend, path string, info FileInfo) (map[string]Usage, error) {
+	result := make(map[string]Usage)
+	err := walkBackend(b, path, info, func(_ string, info FileInfo) error {
+		u := Usage{Inodes: 1}
+		if !info.IsDir {
+			u.Bytes = info.Size
+		}
+		result[info.Owner] = result[info.Owner].add(u)
+		return nil
+	})
+	return result, err
+}
+
+// helper: the usage counted by usageOf, whoever owns it
+func sumUsage(usage map[string]Usage) Usage {
+	var total Usage
+	for _, u := range usage {
+		total = total.add(u)
+	}
+	return total
+}
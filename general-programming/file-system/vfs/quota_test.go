@@ -0,0 +1,100 @@
+package vfs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDirectoryQuota checks byte and inode limits on a subtree
+func TestDirectoryQuota(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/logs")
+	_ = fs.Touch("/logs/old.log", "12345")
+
+	if err := fs.SetQuota("/logs", Quota{MaxBytes: 10, MaxInodes: 3}); err != nil {
+		t.Fatalf("SetQuota failed: %v", err)
+	}
+
+	// 1. Growth within the limit works, beyond it fails
+	if err := fs.Touch("/logs/a.log", "12345"); err != nil {
+		t.Fatalf("Touch within quota failed: %v", err)
+	}
+	if err := fs.Write("/logs/a.log", "123456"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Write() over byte quota error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := fs.Mkdir("/logs/sub"); err != nil {
+		t.Fatalf("Mkdir within quota failed: %v", err)
+	}
+	if err := fs.Touch("/logs/sub/b.log", ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Touch() over inode quota error = %v, want ErrQuotaExceeded", err)
+	}
+
+	// 2. Nothing outside the subtree is affected
+	if err := fs.Touch("/big.txt", strings.Repeat("x", 100)); err != nil {
+		t.Errorf("Touch outside quota failed: %v", err)
+	}
+
+	// 3. Moving in is checked, removing frees space
+	if err := fs.Mv("/big.txt", "/logs/big.txt"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Mv() into full quota error = %v, want ErrQuotaExceeded", err)
+	}
+	_ = fs.Rm("/logs/old.log")
+	if err := fs.Write("/logs/a.log", "1234567890"); err != nil {
+		t.Errorf("Write after Rm failed: %v", err)
+	}
+
+	want := []QuotaReport{{Path: "/logs", Limit: Quota{MaxBytes: 10, MaxInodes: 3}, Used: Usage{Bytes: 10, Inodes: 2}}}
+	if got := fs.Quotas(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Quotas() = %+v, want %+v", got, want)
+	}
+
+	// 4. The quota follows its directory and goes away with it
+	_ = fs.Mv("/logs", "/archive")
+	if got := fs.Quotas(); len(got) != 1 || got[0].Path != "/archive" {
+		t.Errorf("Quotas() after Mv = %+v", got)
+	}
+	_ = fs.Rm("/archive")
+	if got := fs.Quotas(); len(got) != 0 {
+		t.Errorf("Quotas() after Rm = %+v", got)
+	}
+}
+
+// TestUserQuota checks ownership and per-user limits across handles
+func TestUserQuota(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/home")
+	alice := fs.WithUser("alice")
+	bob := fs.WithUser("bob")
+
+	fs.SetUserQuota("alice", Quota{MaxBytes: 8})
+
+	if err := alice.Touch("/home/a.txt", "12345678"); err != nil {
+		t.Fatalf("Touch within quota failed: %v", err)
+	}
+	if err := alice.Touch("/home/b.txt", "9"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Touch() over user quota error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := bob.Touch("/home/b.txt", "lots of content"); err != nil {
+		t.Errorf("other user's Touch failed: %v", err)
+	}
+
+	// writes are charged to the owner, not the writer
+	if err := bob.Write("/home/a.txt", "123456789"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Write() to alice's file error = %v, want ErrQuotaExceeded", err)
+	}
+
+	if info, _ := fs.Stat("/home/a.txt"); info.Owner != "alice" {
+		t.Errorf("Stat().Owner = %q, want alice", info.Owner)
+	}
+	if info, _ := fs.Stat("/home"); info.Owner != DefaultUser {
+		t.Errorf("Stat().Owner = %q, want %q", info.Owner, DefaultUser)
+	}
+
+	// removing the whole directory gives alice her space back
+	_ = bob.Rm("/home")
+	if got := fs.Quotas(); len(got) != 1 || got[0].Used != (Usage{}) {
+		t.Errorf("Quotas() after Rm = %+v", got)
+	}
+}
@@ -0,0 +1,474 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchResult is one file matching a Search, with how well it matches
+type SearchResult struct {
+	Path  string
+	Score float64
+}
+
+// search(root, query): the files at or below root whose content matches
+// query, best matches first.
+//
+// A query is words, which match files containing them whatever their case,
+// combined with the operators AND, OR and NOT (in capitals) and
+// parentheses; words next to each other are ANDed. For example
+//
+//	error (disk OR network) NOT retry
+//
+// Files are ranked by tf-idf over the query's words (the ones not under a
+// NOT): words that are frequent in the file but rare in the tree count
+// most.
+//
+// Words are looked up in an inverted index over the whole tree, built by the
+// first Search and then kept up to date by every change to the tree. Files
+// that aren't valid UTF-8 are left out of it.
+func (fs *FileSystem) Search(root, query string) ([]SearchResult, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, pathError("search", root, err)
+	}
+	if err := fs.buildIndex(); err != nil {
+		return nil, pathError("search", root, err)
+	}
+
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, _, err := fs.lookup(root)
+	if err != nil {
+		return nil, pathError("search", root, err)
+	}
+
+	ix := fs.index
+	terms := q.terms(nil, false)
+	var result []SearchResult
+	for doc := range q.eval(ix) {
+		if !isWithin(doc, p) {
+			continue
+		}
+		score := 0.0
+		for _, term := range terms {
+			if tf := ix.postings[term][doc]; tf > 0 {
+				idf := math.Log(1 + float64(len(ix.docs))/float64(len(ix.postings[term])))
+				score += (1 + math.Log(float64(tf))) * idf
+			}
+		}
+		result = append(result, SearchResult{Path: doc, Score: score})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// searchIndex is an inverted index of the words in every file of the tree
+type searchIndex struct {
+	docs     map[string]map[string]int // file path -> word -> occurrences
+	postings map[string]map[string]int // word -> file path -> occurrences
+	paths    pathTrie                  // the paths in docs, to find the ones below a directory
+}
+
+// helper: indexes the whole tree, unless it already is
+func (fs *FileSystem) buildIndex() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.index != nil {
+		return nil
+	}
+	fs.index = &searchIndex{
+		docs:     make(map[string]map[string]int),
+		postings: make(map[string]map[string]int),
+	}
+	if err := fs.indexSubtree("/"); err != nil {
+		fs.index = nil
+		return err
+	}
+	return nil
+}
+
+// helper: brings the index up to date after ev. If that fails, the index
+// is dropped, for the next Search to build again. Callers hold fs.mu
+// exclusively.
+func (fs *FileSystem) updateIndex(ev Event) {
+	if fs.index == nil {
+		return
+	}
+	switch ev.Op {
+	case Create, Modify:
+		fs.reindex(ev.Path)
+	case Delete:
+		fs.index.removeWithin(ev.Path)
+	case Rename:
+		fs.index.move(ev.OldPath, ev.Path)
+	}
+}
+
+// helper: indexSubtree, dropping the index if that fails
+func (fs *FileSystem) reindex(path string) {
+	if err := fs.indexSubtree(path); err != nil {
+		fs.index = nil
+	}
+}
+
+// helper: (re)indexes every file at or below path, and forgets the ones
+// that are gone. Callers hold fs.mu exclusively.
+func (fs *FileSystem) indexSubtree(path string) error {
+	if fs.index == nil {
+		return nil
+	}
+	fs.index.removeWithin(path)
+
+	info, err := fs.backend.Stat(path)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// encrypted content can't be read, so encrypted directories are left out
+	root, err := fs.encryptionRoot(path)
+	if err != nil || root != "" {
+		return err
+	}
+	var encrypted []string
+	return fs.walk(path, info, func(path string, info FileInfo) error {
+		if slices.ContainsFunc(encrypted, func(dir string) bool { return isWithin(path, dir) }) {
+			return nil
+		}
+		if info.IsDir {
+			if _, ok, err := fs.keyParams(path); err != nil || ok {
+				encrypted = append(encrypted, path)
+				return err
+			}
+			return nil
+		}
+		content, err := fs.backend.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fs.index.add(path, content)
+		return nil
+	})
+}
+
+// helper: indexes the words in content for the file at path
+func (ix *searchIndex) add(path, content string) {
+	// binary content has no words
+	if !utf8.ValidString(content) {
+		return
+	}
+	words := make(map[string]int)
+	for _, word := range splitWords(content) {
+		words[word]++
+	}
+	ix.addWords(path, words)
+}
+
+// helper: indexes words (word -> occurrences) for the file at path
+func (ix *searchIndex) addWords(path string, words map[string]int) {
+	ix.docs[path] = words
+	ix.paths.add(path)
+	for word, n := range words {
+		if ix.postings[word] == nil {
+			ix.postings[word] = make(map[string]int)
+		}
+		ix.postings[word][path] = n
+	}
+}
+
+// helper: forgets the files at or below path, looking only at them
+func (ix *searchIndex) removeWithin(path string) {
+	for _, doc := range ix.paths.cut(path) {
+		ix.removeWords(doc)
+	}
+}
+
+// helper: drops the words of the file at doc
+func (ix *searchIndex) removeWords(doc string) {
+	for word := range ix.docs[doc] {
+		delete(ix.postings[word], doc)
+		if len(ix.postings[word]) == 0 {
+			delete(ix.postings, word)
+		}
+	}
+	delete(ix.docs, doc)
+}
+
+// helper: the files below src are now below dst
+func (ix *searchIndex) move(src, dst string) {
+	for _, doc := range ix.paths.cut(src) {
+		words := ix.docs[doc]
+		ix.removeWords(doc)
+		ix.addWords(dst+strings.TrimPrefix(doc, src), words)
+	}
+}
+
+// pathTrie is a set of clean paths, kept as a tree of their names, so the
+// ones at or below a path are found without looking at the others
+type pathTrie struct {
+	children map[string]*pathTrie
+	present  bool // the path ending here is in the set
+}
+
+// helper: adds path to the set
+func (t *pathTrie) add(path string) {
+	node := t
+	for _, name := range parsePath(path) {
+		child := node.children[name]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*pathTrie)
+			}
+			child = &pathTrie{}
+			node.children[name] = child
+		}
+		node = child
+	}
+	node.present = true
+}
+
+// helper: removes the paths at or below path from the set, and returns
+// them
+func (t *pathTrie) cut(path string) []string {
+	names := parsePath(path)
+	// the nodes from the root down to path
+	chain := []*pathTrie{t}
+	for _, name := range names {
+		child := chain[len(chain)-1].children[name]
+		if child == nil {
+			return nil
+		}
+		chain = append(chain, child)
+	}
+
+	var paths []string
+	chain[len(chain)-1].collect(joinPath("/", strings.Join(names, "/")), &paths)
+	if len(names) == 0 {
+		*t = pathTrie{}
+		return paths
+	}
+	// drop the branch, and the parents it leaves empty
+	for i := len(names) - 1; i >= 0; i-- {
+		delete(chain[i].children, names[i])
+		if chain[i].present || len(chain[i].children) > 0 {
+			break
+		}
+	}
+	return paths
+}
+
+// helper: appends the paths at or below t, which is at path, to paths
+func (t *pathTrie) collect(path string, paths *[]string) {
+	if t.present {
+		*paths = append(*paths, path)
+	}
+	for name, child := range t.children {
+		child.collect(joinPath(path, name), paths)
+	}
+}
+
+// helper: the lowercased words in s, split at anything that isn't a letter
+// or a digit
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// queryOp is the kind of a node in a parsed query
+type queryOp int
+
+const (
+	termQuery queryOp = iota
+	andQuery
+	orQuery
+	notQuery
+)
+
+// searchQuery is a parsed query: a word, or an operator over sub-queries
+type searchQuery struct {
+	op   queryOp
+	term string
+	args []*searchQuery
+}
+
+// helper: the set of files matching q
+func (q *searchQuery) eval(ix *searchIndex) map[string]bool {
+	result := make(map[string]bool)
+	switch q.op {
+	case termQuery:
+		for doc := range ix.postings[q.term] {
+			result[doc] = true
+		}
+	case andQuery:
+		result = q.args[0].eval(ix)
+		for _, arg := range q.args[1:] {
+			matched := arg.eval(ix)
+			for doc := range result {
+				if !matched[doc] {
+					delete(result, doc)
+				}
+			}
+		}
+	case orQuery:
+		for _, arg := range q.args {
+			for doc := range arg.eval(ix) {
+				result[doc] = true
+			}
+		}
+	case notQuery:
+		excluded := q.args[0].eval(ix)
+		for doc := range ix.docs {
+			if !excluded[doc] {
+				result[doc] = true
+			}
+		}
+	}
+	return result
+}
+
+// helper: appends the words of q that aren't negated to terms
+func (q *searchQuery) terms(terms []string, negated bool) []string {
+	if q.op == termQuery && !negated {
+		return append(terms, q.term)
+	}
+	for _, arg := range q.args {
+		terms = arg.terms(terms, negated != (q.op == notQuery))
+	}
+	return terms
+}
+
+// queryParser parses a query by recursive descent:
+//
+//	or   = and { "OR" and }
+//	and  = not { ["AND"] not }
+//	not  = "NOT" not | "(" or ")" | word
+type queryParser struct {
+	tokens []string
+}
+
+// helper: parses a query
+func parseQuery(query string) (*searchQuery, error) {
+	query = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(query)
+	p := &queryParser{tokens: strings.Fields(query)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty query", ErrBadQuery)
+	}
+	q, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.tokens) > 0 {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrBadQuery, p.tokens[0])
+	}
+	return q, nil
+}
+
+func (p *queryParser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *queryParser) next() string {
+	token := p.peek()
+	if token != "" {
+		p.tokens = p.tokens[1:]
+	}
+	return token
+}
+
+func (p *queryParser) or() (*searchQuery, error) {
+	return p.list(orQuery, "OR", p.and)
+}
+
+func (p *queryParser) and() (*searchQuery, error) {
+	return p.list(andQuery, "AND", p.not)
+}
+
+// helper: one or more operands of op, separated by the keyword (which is
+// optional for AND)
+func (p *queryParser) list(op queryOp, keyword string, operand func() (*searchQuery, error)) (*searchQuery, error) {
+	q, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	args := []*searchQuery{q}
+	for {
+		token := p.peek()
+		switch {
+		case token == keyword:
+			p.next()
+		case op == andQuery && token != "" && token != "OR" && token != ")":
+			// implicit AND
+		default:
+			if len(args) == 1 {
+				return args[0], nil
+			}
+			return &searchQuery{op: op, args: args}, nil
+		}
+		q, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, q)
+	}
+}
+
+func (p *queryParser) not() (*searchQuery, error) {
+	switch token := p.peek(); token {
+	case "":
+		return nil, fmt.Errorf("%w: unexpected end", ErrBadQuery)
+	case "NOT":
+		p.next()
+		q, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &searchQuery{op: notQuery, args: []*searchQuery{q}}, nil
+	case "(":
+		p.next()
+		q, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%w: missing )", ErrBadQuery)
+		}
+		return q, nil
+	case ")", "AND", "OR":
+		return nil, fmt.Errorf("%w: unexpected %q", ErrBadQuery, token)
+	}
+
+	// a word like "e-mail" is all of its parts
+	token := p.next()
+	words := splitWords(token)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%w: no words in %q", ErrBadQuery, token)
+	}
+	args := make([]*searchQuery, len(words))
+	for i, word := range words {
+		args[i] = &searchQuery{op: termQuery, term: word}
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return &searchQuery{op: andQuery, args: args}, nil
+}
@@ -0,0 +1,172 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// helper: the paths Search returns, in order
+func searchPaths(t *testing.T, fs *FileSystem, root, query string) []string {
+	t.Helper()
+	results, err := fs.Search(root, query)
+	if err != nil {
+		t.Fatalf("Search(%s, %q) failed: %v", root, query, err)
+	}
+	var paths []string
+	for _, r := range results {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+// TestSearch checks queries, operators and ranking
+func TestSearch(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/logs")
+	_ = fs.Touch("/logs/a.log", "Disk error: disk full. Retry later.")
+	_ = fs.Touch("/logs/b.log", "network error, retry")
+	_ = fs.Touch("/logs/c.log", "all good")
+	_ = fs.Touch("/notes.txt", "remember the disk")
+	_ = fs.Touch("/blob.bin", "disk\xff")
+
+	tests := []struct {
+		root, query string
+		want        []string
+	}{
+		{"/", "DISK", []string{"/logs/a.log", "/notes.txt"}},
+		{"/", "error retry", []string{"/logs/a.log", "/logs/b.log"}},
+		{"/", "error AND NOT disk", []string{"/logs/b.log"}},
+		{"/", "good OR network", []string{"/logs/b.log", "/logs/c.log"}},
+		{"/", "(disk OR network) error", []string{"/logs/a.log", "/logs/b.log"}},
+		{"/", "NOT error", []string{"/logs/c.log", "/notes.txt"}},
+		{"/", "disk-full", []string{"/logs/a.log"}},
+		{"/logs", "disk", []string{"/logs/a.log"}},
+		{"/logs/c.log", "good", []string{"/logs/c.log"}},
+		{"/", "missing", nil},
+	}
+	for _, tt := range tests {
+		if got := searchPaths(t, fs, tt.root, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%s, %q) = %v, want %v", tt.root, tt.query, got, tt.want)
+		}
+	}
+
+	// a.log matches both words, and says disk twice
+	results, _ := fs.Search("/", "disk OR error")
+	if len(results) != 3 || results[0].Path != "/logs/a.log" || results[0].Score <= results[1].Score {
+		t.Errorf("Search() ranking = %+v", results)
+	}
+
+	bad := []string{"", "   ", "disk AND", "OR disk", "(disk", "disk)", "NOT", "--"}
+	for _, query := range bad {
+		_, err := fs.Search("/", query)
+		if !errors.Is(err, ErrBadQuery) || !errors.Is(err, iofs.ErrInvalid) {
+			t.Errorf("Search(%q) error = %v, want ErrBadQuery", query, err)
+		}
+	}
+	if _, err := fs.Search("/missing", "disk"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Search(/missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+// TestSearchIncremental checks the index follows changes made after it was
+// built
+func TestSearchIncremental(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/dir")
+	_ = fs.Touch("/dir/f.txt", "alpha")
+	if got := searchPaths(t, fs, "/", "alpha"); len(got) != 1 {
+		t.Fatalf("Search() = %v", got)
+	}
+
+	_ = fs.Write("/dir/f.txt", "beta")
+	_ = fs.Cp("/dir", "/copy")
+	_ = fs.Mv("/dir", "/moved")
+	_ = fs.Touch("/new.txt", "beta gamma")
+
+	steps := []struct {
+		query string
+		want  []string
+	}{
+		{"alpha", nil},
+		{"beta", []string{"/copy/f.txt", "/moved/f.txt", "/new.txt"}},
+		{"gamma", []string{"/new.txt"}},
+	}
+	for _, s := range steps {
+		if got := searchPaths(t, fs, "/", s.query); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("Search(%q) = %v, want %v", s.query, got, s.want)
+		}
+	}
+
+	_ = fs.Rm("/copy")
+	_ = fs.Rm("/new.txt")
+	if got := searchPaths(t, fs, "/", "beta"); !reflect.DeepEqual(got, []string{"/moved/f.txt"}) {
+		t.Errorf("Search() after Rm = %v", got)
+	}
+
+	// mounting hides what was below the mount point, and shows the mount
+	other := NewMemoryBackend()
+	_ = other.Create("/m.txt", "beta", DefaultUser)
+	_ = fs.Mount("/moved", other)
+	if got := searchPaths(t, fs, "/", "beta"); !reflect.DeepEqual(got, []string{"/moved/m.txt"}) {
+		t.Errorf("Search() after Mount = %v", got)
+	}
+	_ = fs.Unmount("/moved")
+	if got := searchPaths(t, fs, "/", "beta"); !reflect.DeepEqual(got, []string{"/moved/f.txt"}) {
+		t.Errorf("Search() after Unmount = %v", got)
+	}
+}
+
+// TestPathTrie checks cut finds exactly the paths at or below a path, and
+// prunes what it empties
+func TestPathTrie(t *testing.T) {
+	var trie pathTrie
+	for _, p := range []string{"/a", "/a/b/c", "/a/b/d", "/ab", "/x/y"} {
+		trie.add(p)
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/a/b/c", []string{"/a/b/c"}},
+		{"/missing", nil},
+		{"/a", []string{"/a", "/a/b/d"}},
+		{"/", []string{"/ab", "/x/y"}},
+	}
+	for _, tt := range tests {
+		got := trie.cut(tt.path)
+		slices.Sort(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("cut(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if len(trie.children) != 0 {
+		t.Errorf("trie still holds %v", trie.children)
+	}
+
+	trie.add("/x/y/z")
+	trie.cut("/x/y/z")
+	if len(trie.children) != 0 {
+		t.Errorf("cut() left empty parents: %v", trie.children)
+	}
+}
+
+// BenchmarkWriteIndexed writes files of a tree of 100000 once the search
+// index is built, which keeps it up to date
+func BenchmarkWriteIndexed(b *testing.B) {
+	fs, paths := wideTree(b, 1000, 100)
+	fs.SetVersionLimit(0)
+	if _, err := fs.Search("/", "x"); err != nil {
+		b.Fatal(err)
+	}
+	i := 0
+	for b.Loop() {
+		if err := fs.Write(paths[i%len(paths)], "x y"); err != nil {
+			b.Fatal(err)
+		}
+		i++
+	}
+}
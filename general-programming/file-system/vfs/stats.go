@@ -0,0 +1,138 @@
+package vfs
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// StatsTopDirs is how many directories TreeStats.LargestDirs lists
+const StatsTopDirs = 5
+
+// TreeStats describe a subtree, as returned by Stats. The counts and sizes
+// are of the nodes below its root (or of the root, if it is a file).
+type TreeStats struct {
+	Dirs  int
+	Files int
+	// Bytes is the content of the files; StoredBytes what storing it
+	// takes, compressed and with content shared by several files counted
+	// once (where the backend hashes content)
+	Bytes       int64
+	StoredBytes int64
+	// Versions is how many versions of the files are kept, and
+	// VersionBytes what storing them takes beyond the content the files
+	// hold (versions share blobs with files and each other)
+	Versions     int
+	VersionBytes int64
+	// HeapBytes approximates the memory the subtree takes in a
+	// MemoryBackend (or DBBackend): its nodes, names and stored content,
+	// and its version history
+	HeapBytes int64
+
+	// DeepestPath is the node furthest below the root, Depth levels down
+	// (the first one in name order on a tie)
+	DeepestPath string
+	Depth       int
+	// LargestDirs are the directories with the most entries, the most
+	// first, at most StatsTopDirs of them
+	LargestDirs []DirStats
+}
+
+// DirStats is a directory and its number of entries
+type DirStats struct {
+	Path    string
+	Entries int
+}
+
+// Rough sizes of what a MemoryBackend keeps per node and per blob, besides
+// names and content: the struct, and its entry in the map holding it
+var (
+	fileOverhead    = int64(unsafe.Sizeof(File{})) + mapEntryOverhead
+	dirOverhead     = int64(unsafe.Sizeof(Directory{})) + mapEntryOverhead + mapOverhead
+	blobOverhead    = int64(unsafe.Sizeof(blob{})) + mapEntryOverhead + 64 // the hex hash
+	versionOverhead = int64(unsafe.Sizeof(Version{}))
+)
+
+const (
+	mapOverhead      = 48 // an empty map
+	mapEntryOverhead = 32 // a string key and a pointer or interface value
+)
+
+// stats(root): counts, sizes and shape of the subtree at root
+func (fs *FileSystem) Stats(root string) (TreeStats, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, info, err := fs.lookup(root)
+	if err != nil {
+		return TreeStats{}, pathError("stats", root, err)
+	}
+
+	var stats TreeStats
+	base := len(parsePath(p))
+	stored := make(map[string]bool) // content hashes already counted
+	entries := make(map[string]int) // by directory
+	var files []string
+	err = fs.walk(p, info, func(path string, info FileInfo) error {
+		if path != p {
+			parent, _ := splitPath(path)
+			entries[parent]++
+		} else if info.IsDir {
+			return nil
+		}
+		if depth := len(parsePath(path)) - base; depth > stats.Depth {
+			stats.Depth, stats.DeepestPath = depth, path
+		}
+		if info.IsDir {
+			stats.Dirs++
+			stats.HeapBytes += dirOverhead + int64(len(info.Name))
+			return nil
+		}
+
+		files = append(files, path)
+		stats.Files++
+		stats.Bytes += info.Size
+		stats.HeapBytes += fileOverhead + int64(len(info.Name))
+		if info.Hash == "" || !stored[info.Hash] {
+			stored[info.Hash] = true
+			stats.StoredBytes += info.PhysicalSize
+			stats.HeapBytes += blobOverhead + info.PhysicalSize
+		}
+		return nil
+	})
+	if err != nil {
+		return TreeStats{}, pathError("stats", root, err)
+	}
+	if stats.DeepestPath == "" {
+		stats.DeepestPath = p
+	}
+	stats.LargestDirs = largestDirs(entries)
+
+	// versions last, so content they share with a file counts as the file's
+	for _, file := range files {
+		for _, v := range fs.versions[file] {
+			stats.Versions++
+			stats.HeapBytes += versionOverhead
+			if !stored[v.content.hash] {
+				stored[v.content.hash] = true
+				stats.VersionBytes += int64(len(v.content.data))
+				stats.HeapBytes += blobOverhead + int64(len(v.content.data))
+			}
+		}
+	}
+	return stats, nil
+}
+
+// helper: the StatsTopDirs directories with the most entries, by path on a
+// tie
+func largestDirs(entries map[string]int) []DirStats {
+	dirs := make([]DirStats, 0, len(entries))
+	for path, n := range entries {
+		dirs = append(dirs, DirStats{Path: path, Entries: n})
+	}
+	slices.SortFunc(dirs, func(a, b DirStats) int {
+		return cmp.Or(cmp.Compare(b.Entries, a.Entries), strings.Compare(a.Path, b.Path))
+	})
+	return dirs[:min(len(dirs), StatsTopDirs)]
+}
@@ -0,0 +1,75 @@
+package vfs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestStats checks the counts, sizes and shape Stats reports for a tree
+func TestStats(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/a")
+	_ = fs.Mkdir("/a/b")
+	_ = fs.Mkdir("/a/b/c")
+	_ = fs.Touch("/a/b/c/deep.txt", "hello")
+	_ = fs.Touch("/a/one.txt", "same content")
+	_ = fs.Touch("/a/two.txt", "same content")
+	_ = fs.Mkdir("/e")
+	_ = fs.Touch("/e/x", "")
+	_ = fs.Touch("/e/y", "")
+
+	stats, err := fs.Stats("/")
+	if err != nil {
+		t.Fatalf("Stats() failed: %v", err)
+	}
+	if stats.Dirs != 4 || stats.Files != 5 || stats.Bytes != 29 {
+		t.Errorf("Stats() counted %d dirs, %d files, %d bytes, want 4, 5, 29", stats.Dirs, stats.Files, stats.Bytes)
+	}
+	// the shared content is stored once
+	if stats.StoredBytes != 17 {
+		t.Errorf("StoredBytes = %d, want 17", stats.StoredBytes)
+	}
+	if stats.DeepestPath != "/a/b/c/deep.txt" || stats.Depth != 4 {
+		t.Errorf("deepest = %s at %d, want /a/b/c/deep.txt at 4", stats.DeepestPath, stats.Depth)
+	}
+	want := []DirStats{{"/a", 3}, {"/", 2}, {"/e", 2}, {"/a/b", 1}, {"/a/b/c", 1}}
+	if !reflect.DeepEqual(stats.LargestDirs, want) {
+		t.Errorf("LargestDirs = %v, want %v", stats.LargestDirs, want)
+	}
+
+	// a subtree, with depths counted from it
+	// versions only count what they don't share with a file
+	_ = fs.Write("/a/b/c/deep.txt", "hello world")
+	withHistory, _ := fs.Stats("/")
+	if withHistory.Versions != 2 || withHistory.VersionBytes != 5 || withHistory.StoredBytes != 23 {
+		t.Errorf("Stats() after Write counted %d versions of %d bytes, %d stored bytes, want 2, 5, 23",
+			withHistory.Versions, withHistory.VersionBytes, withHistory.StoredBytes)
+	}
+
+	sub, err := fs.Stats("/a/b")
+	if err != nil {
+		t.Fatalf("Stats() failed: %v", err)
+	}
+	if sub.Dirs != 1 || sub.Files != 1 || sub.Depth != 2 || sub.HeapBytes >= stats.HeapBytes {
+		t.Errorf("Stats(/a/b) = %+v", sub)
+	}
+}
+
+// TestStatsErrors checks Stats of a missing path fails, and of a file
+// counts just the file
+func TestStatsErrors(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Touch("/f", "abc")
+
+	if _, err := fs.Stats("/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stats(/missing) error = %v, want ErrNotExist", err)
+	}
+	stats, err := fs.Stats("/f")
+	if err != nil {
+		t.Fatalf("Stats(/f) failed: %v", err)
+	}
+	if stats.Files != 1 || stats.Bytes != 3 || stats.DeepestPath != "/f" || len(stats.LargestDirs) != 0 {
+		t.Errorf("Stats(/f) = %+v", stats)
+	}
+}
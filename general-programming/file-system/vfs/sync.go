@@ -0,0 +1,314 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+)
+
+// SyncAction is what a SyncOp does to its entry
+type SyncAction int
+
+const (
+	SyncMkdir  SyncAction = iota + 1 // create a directory
+	SyncCopy                         // create a file with the other side's content
+	SyncUpdate                       // replace a file's content with the other side's
+	SyncRemove                       // remove a file, or a directory and everything below it
+)
+
+func (a SyncAction) String() string {
+	switch a {
+	case SyncMkdir:
+		return "mkdir"
+	case SyncCopy:
+		return "copy"
+	case SyncUpdate:
+		return "update"
+	case SyncRemove:
+		return "remove"
+	}
+	return "unknown"
+}
+
+// SyncOp is one operation Sync made (or, on a dry run, would make). Path is
+// relative to both roots, "." for the roots themselves.
+type SyncOp struct {
+	Action SyncAction
+	Path   string
+	IsDir  bool
+	// Reverse is set for operations on the source, in a two-way sync
+	Reverse bool
+}
+
+func (op SyncOp) String() string {
+	s := op.Action.String() + " " + op.Path
+	if op.IsDir && op.Path != "." {
+		s += "/"
+	}
+	if op.Reverse {
+		s += " (to source)"
+	}
+	return s
+}
+
+// SyncOptions change what Sync does
+type SyncOptions struct {
+	// DryRun only reports the operations, without making them
+	DryRun bool
+	// Delete removes the entries dst has and src doesn't; without it they
+	// are left alone. It can't be combined with TwoWay.
+	Delete bool
+	// TwoWay makes both sides the same: entries either side is missing are
+	// copied to it, and of two differing files the one modified last wins
+	// (src on a tie)
+	TwoWay bool
+}
+
+// sync(src, srcRoot, dst, dstRoot, opts): makes the node at dstRoot in dst
+// like the node at srcRoot in src, with as few operations as possible, like
+// rsync, and returns them in the order they were made: parents before their
+// children and siblings sorted by name. dstRoot is created if it doesn't
+// exist. Entries that are the same on both sides are left alone: two files
+// are the same if they have the same size and either the same hash (when
+// both backends provide one), the same modification time, or the same
+// content. An entry that is a file on one side and a directory on the other
+// is removed and copied again.
+//
+// src and dst can be different FileSystems, or handles on the same one as
+// long as neither root is inside the other. Each side is changed through
+// its own handle, so its user, locks and quotas apply. Sync doesn't hold
+// the trees still while it runs: changes made meanwhile may or may not be
+// synced.
+func Sync(src *FileSystem, srcRoot string, dst *FileSystem, dstRoot string, opts SyncOptions) ([]SyncOp, error) {
+	if opts.TwoWay && opts.Delete {
+		return nil, pathError("sync", dstRoot, iofs.ErrInvalid)
+	}
+	srcPath, err := src.resolvePath(srcRoot)
+	if err != nil {
+		return nil, pathError("sync", srcRoot, err)
+	}
+	dstPath, err := dst.resolvePath(dstRoot)
+	if err != nil {
+		return nil, pathError("sync", dstRoot, err)
+	}
+	if src.state == dst.state && (isWithin(srcPath, dstPath) || isWithin(dstPath, srcPath)) {
+		return nil, pathError("sync", dstRoot, ErrInvalidPath)
+	}
+
+	s := &syncer{sides: [2]syncSide{{src, srcPath}, {dst, dstPath}}, opts: opts}
+	srcInfo, err := src.Stat(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	dstInfo, err := dst.Stat(dstPath)
+	switch {
+	case errors.Is(err, ErrNotExist):
+		err = s.create(".", srcInfo, false)
+	case err == nil:
+		err = s.sync(".", &srcInfo, &dstInfo)
+	}
+	return s.ops, err
+}
+
+// syncSide is one of the trees a Sync works on
+type syncSide struct {
+	fs   *FileSystem
+	root string
+}
+
+// helper: the path of the entry at rel below the side's root
+func (side syncSide) path(rel string) string {
+	if rel == "." {
+		return side.root
+	}
+	return joinPath(side.root, rel)
+}
+
+// syncer is the state of one Sync: sides[0] is the source, sides[1] the
+// destination
+type syncer struct {
+	sides [2]syncSide
+	opts  SyncOptions
+	ops   []SyncOp
+}
+
+// helper: syncs the entry at rel, described on either side by its info (nil
+// where it is missing)
+func (s *syncer) sync(rel string, src, dst *FileInfo) error {
+	switch {
+	case src == nil && dst == nil:
+		return nil
+	case dst == nil:
+		return s.create(rel, *src, false)
+	case src == nil:
+		if s.opts.TwoWay {
+			return s.create(rel, *dst, true)
+		}
+		if s.opts.Delete {
+			return s.do(SyncOp{Action: SyncRemove, Path: rel, IsDir: dst.IsDir}, "")
+		}
+		return nil
+	}
+
+	// a two-way sync goes the other way when dst is newer
+	reverse := s.opts.TwoWay && dst.ModTime.After(src.ModTime)
+	from, to := *src, *dst
+	if reverse {
+		from, to = to, from
+	}
+
+	switch {
+	case src.IsDir && dst.IsDir:
+		return s.syncChildren(rel)
+	case from.IsDir != to.IsDir:
+		if err := s.do(SyncOp{Action: SyncRemove, Path: rel, IsDir: to.IsDir, Reverse: reverse}, ""); err != nil {
+			return err
+		}
+		return s.create(rel, from, reverse)
+	}
+
+	same, err := s.sameFile(rel, *src, *dst)
+	if err != nil || same {
+		return err
+	}
+	content, err := s.read(rel, reverse)
+	if err != nil {
+		return err
+	}
+	return s.do(SyncOp{Action: SyncUpdate, Path: rel, Reverse: reverse}, content)
+}
+
+// helper: syncs the children of the directory at rel, which is on both
+// sides, merging their names in order
+func (s *syncer) syncChildren(rel string) error {
+	var entries [2][]FileInfo
+	for i, side := range s.sides {
+		var err error
+		if entries[i], err = side.fs.readDir(side.path(rel)); err != nil {
+			return err
+		}
+	}
+
+	src, dst := entries[0], entries[1]
+	for len(src) > 0 || len(dst) > 0 {
+		var a, b *FileInfo
+		switch {
+		case len(dst) == 0 || (len(src) > 0 && src[0].Name < dst[0].Name):
+			a, src = &src[0], src[1:]
+		case len(src) == 0 || dst[0].Name < src[0].Name:
+			b, dst = &dst[0], dst[1:]
+		default:
+			a, b, src, dst = &src[0], &dst[0], src[1:], dst[1:]
+		}
+		name := a
+		if name == nil {
+			name = b
+		}
+		if err := s.sync(relPath(rel, name.Name), a, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper: copies the entry at rel (described by info), and everything below
+// it, to the side missing it: dst, or src if reverse
+func (s *syncer) create(rel string, info FileInfo, reverse bool) error {
+	if !info.IsDir {
+		content, err := s.read(rel, reverse)
+		if err != nil {
+			return err
+		}
+		return s.do(SyncOp{Action: SyncCopy, Path: rel, Reverse: reverse}, content)
+	}
+
+	if err := s.do(SyncOp{Action: SyncMkdir, Path: rel, IsDir: true, Reverse: reverse}, ""); err != nil {
+		return err
+	}
+	from := s.sides[0]
+	if reverse {
+		from = s.sides[1]
+	}
+	children, err := from.fs.readDir(from.path(rel))
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := s.create(relPath(rel, child.Name), child, reverse); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper: records op and, unless this is a dry run, makes it with content
+// for a copy or an update
+func (s *syncer) do(op SyncOp, content string) error {
+	s.ops = append(s.ops, op)
+	if s.opts.DryRun {
+		return nil
+	}
+	to := s.sides[1]
+	if op.Reverse {
+		to = s.sides[0]
+	}
+	p := to.path(op.Path)
+	switch op.Action {
+	case SyncMkdir:
+		return to.fs.Mkdir(p)
+	case SyncCopy:
+		return to.fs.Touch(p, content)
+	case SyncUpdate:
+		return to.fs.Write(p, content)
+	case SyncRemove:
+		return to.fs.Rm(p)
+	}
+	return nil
+}
+
+// helper: the content of the file at rel on the side it is copied from: src,
+// or dst if reverse
+func (s *syncer) read(rel string, reverse bool) (string, error) {
+	from := s.sides[0]
+	if reverse {
+		from = s.sides[1]
+	}
+	return from.fs.Cat(from.path(rel))
+}
+
+// helper: reports whether the files at rel on both sides are the same,
+// reading them only when their size and hashes or times don't tell
+func (s *syncer) sameFile(rel string, src, dst FileInfo) (bool, error) {
+	switch {
+	case src.Size != dst.Size:
+		return false, nil
+	case src.Hash != "" && dst.Hash != "":
+		return src.Hash == dst.Hash, nil
+	case src.ModTime.Equal(dst.ModTime):
+		return true, nil
+	}
+	a, err := s.read(rel, false)
+	if err != nil {
+		return false, err
+	}
+	b, err := s.read(rel, true)
+	if err != nil {
+		return false, err
+	}
+	return a == b, nil
+}
+
+// helper: describes the children of the directory at path
+func (fs *FileSystem) readDir(path string) ([]FileInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return nil, pathError("ls", path, err)
+	}
+	entries, err := fs.backend.ReadDir(p)
+	if err != nil {
+		return nil, pathError("ls", path, err)
+	}
+	return entries, nil
+}
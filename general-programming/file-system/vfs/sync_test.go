@@ -0,0 +1,124 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"reflect"
+	"testing"
+)
+
+// helper: the ops as strings
+func syncStrings(ops []SyncOp) []string {
+	var result []string
+	for _, op := range ops {
+		result = append(result, op.String())
+	}
+	return result
+}
+
+// TestSync checks a one-way sync makes only the operations needed
+func TestSync(t *testing.T) {
+	src, dst := NewFileSystem(), NewFileSystem()
+	_ = src.Mkdir("/site")
+	_ = src.Mkdir("/site/css")
+	_ = src.Touch("/site/index.html", "<h1>hi</h1>")
+	_ = src.Touch("/site/css/main.css", "body {}")
+
+	steps := []struct {
+		name string
+		edit func()
+		opts SyncOptions
+		want []string
+	}{
+		{"into nothing", func() {}, SyncOptions{},
+			[]string{"mkdir .", "mkdir css/", "copy css/main.css", "copy index.html"}},
+		{"again", func() {}, SyncOptions{}, nil},
+		{"dry run", func() {
+			_ = src.Write("/site/index.html", "<h1>hello</h1>")
+			_ = dst.Touch("/backup/extra.txt", "")
+		}, SyncOptions{DryRun: true, Delete: true},
+			[]string{"remove extra.txt", "update index.html"}},
+		{"without delete", func() {}, SyncOptions{},
+			[]string{"update index.html"}},
+		{"with delete", func() {}, SyncOptions{Delete: true},
+			[]string{"remove extra.txt"}},
+		{"file replaced by a directory", func() {
+			_ = src.Rm("/site/index.html")
+			_ = src.Mkdir("/site/index.html")
+		}, SyncOptions{},
+			[]string{"remove index.html", "mkdir index.html/"}},
+	}
+	for _, s := range steps {
+		s.edit()
+		ops, err := Sync(src, "/site", dst, "/backup", s.opts)
+		if err != nil {
+			t.Fatalf("%s: Sync() failed: %v", s.name, err)
+		}
+		if got := syncStrings(ops); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: Sync() = %v, want %v", s.name, got, s.want)
+		}
+	}
+
+	if content, _ := dst.Cat("/backup/css/main.css"); content != "body {}" {
+		t.Errorf("Cat() of synced file = %q", content)
+	}
+	if info, err := dst.Stat("/backup/index.html"); err != nil || !info.IsDir {
+		t.Errorf("Stat() of replaced entry = %+v, %v", info, err)
+	}
+}
+
+// TestSyncTwoWay checks both sides end up with the newest of everything
+func TestSyncTwoWay(t *testing.T) {
+	a, b := NewFileSystem(), NewFileSystem()
+	_ = a.Touch("/shared.txt", "v1")
+	_ = a.Touch("/only-a.txt", "a")
+	_ = b.Mkdir("/only-b")
+	_ = b.Touch("/only-b/f.txt", "b")
+	_ = b.Touch("/shared.txt", "v2") // written last, so it wins
+
+	ops, err := Sync(a, "/", b, "/", SyncOptions{TwoWay: true})
+	if err != nil {
+		t.Fatalf("Sync() failed: %v", err)
+	}
+	want := []string{
+		"copy only-a.txt",
+		"mkdir only-b/ (to source)",
+		"copy only-b/f.txt (to source)",
+		"update shared.txt (to source)",
+	}
+	if got := syncStrings(ops); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sync() = %v, want %v", got, want)
+	}
+	for _, fs := range []*FileSystem{a, b} {
+		if content, _ := fs.Cat("/shared.txt"); content != "v2" {
+			t.Errorf("Cat(shared.txt) = %q, want v2", content)
+		}
+	}
+	if ops, _ := Sync(a, "/", b, "/", SyncOptions{TwoWay: true}); len(ops) != 0 {
+		t.Errorf("Sync() again = %v", ops)
+	}
+}
+
+// TestSyncErrors checks the invalid combinations
+func TestSyncErrors(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/a")
+	_ = fs.Mkdir("/a/b")
+
+	tests := []struct {
+		name     string
+		src, dst string
+		opts     SyncOptions
+		want     error
+	}{
+		{"delete two-way", "/a", "/c", SyncOptions{TwoWay: true, Delete: true}, iofs.ErrInvalid},
+		{"dst inside src", "/a", "/a/b", SyncOptions{}, ErrInvalidPath},
+		{"src inside dst", "/a/b", "/", SyncOptions{}, ErrInvalidPath},
+		{"missing src", "/missing", "/c", SyncOptions{}, ErrNotExist},
+	}
+	for _, tt := range tests {
+		if _, err := Sync(fs, tt.src, fs.WithUser("bob"), tt.dst, tt.opts); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Sync() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package vfs
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every backend keeps its own trash at its root, so removed nodes never
+// cross a mount. It is laid out like the freedesktop.org trash:
+//
+//	/.vfs-trash/files/<id>            the removed node
+//	/.vfs-trash/info/<id>.trashinfo   where it was removed from, and when
+//
+// The trash is hidden from the tree: it never shows in listings, and paths
+// into it don't resolve.
+const (
+	trashDir      = "/.vfs-trash"
+	trashFilesDir = trashDir + "/files"
+	trashInfoDir  = trashDir + "/info"
+	trashInfoExt  = ".trashinfo"
+)
+
+// helper: reports whether inner, a path within a backend, is in its trash
+func isTrash(inner string) bool {
+	return isWithin(inner, trashDir)
+}
+
+// TrashEntry is a node waiting in the trash
+type TrashEntry struct {
+	ID      string    // passed to Restore
+	Path    string    // where it was removed from
+	Deleted time.Time // when it was removed
+	IsDir   bool
+}
+
+// SetTrash turns the trash on or off. While it is on, Rm moves nodes to the
+// trash, where they can be listed with ListTrash and brought back with
+// Restore until the trash is emptied. With a maxAge above zero, nodes that
+// have been in the trash longer than that are removed for good the next
+// time the trash is used. Nodes in the trash don't count towards quotas.
+func (fs *FileSystem) SetTrash(enabled bool, maxAge time.Duration) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.trashEnabled, fs.trashMaxAge = enabled, max(maxAge, 0)
+	setting := "off"
+	if enabled {
+		setting = "on, max age " + fs.trashMaxAge.String()
+	}
+	fs.recordSetting("trash", "/", setting, nil)
+}
+
+// Trash reports whether the trash is on, and how long nodes stay in it
+// (0: until emptied)
+func (fs *FileSystem) Trash() (bool, time.Duration) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.trashEnabled, fs.trashMaxAge
+}
+
+// ListTrash lists the nodes in the trash, oldest first
+func (fs *FileSystem) ListTrash() ([]TrashEntry, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.expireTrash(time.Now()); err != nil {
+		return nil, pathError("trash", trashDir, err)
+	}
+	trashed, err := fs.trashed()
+	if err != nil {
+		return nil, pathError("trash", trashDir, err)
+	}
+	result := make([]TrashEntry, len(trashed))
+	for i, t := range trashed {
+		result[i] = t.TrashEntry
+	}
+	return result, nil
+}
+
+// restore(id, dst): moves a node out of the trash, back where it was
+// removed from if dst is empty. dst must not exist yet, and must be on the
+// same mount the node was removed from.
+func (fs *FileSystem) Restore(id, dst string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("restore", cmp.Or(dst, id), "", err) }()
+
+	if err := fs.expireTrash(time.Now()); err != nil {
+		return pathError("restore", id, err)
+	}
+	trashed, err := fs.trashed()
+	if err != nil {
+		return pathError("restore", id, err)
+	}
+	i := slices.IndexFunc(trashed, func(t trashedNode) bool { return t.ID == id })
+	if i < 0 {
+		return pathError("restore", id, ErrNotExist)
+	}
+	entry := trashed[i]
+
+	if dst == "" {
+		dst = entry.Path
+	}
+	dstPath, err := fs.checkFree(dst)
+	if err != nil {
+		return pathError("restore", dst, err)
+	}
+	b, inner, mountPoint := fs.backend.resolve(dstPath)
+	if err := checkCreate(inner); err != nil {
+		return pathError("restore", dst, err)
+	}
+	if mountPoint != entry.mountPoint {
+		return pathError("restore", dst, ErrCrossMount)
+	}
+	if err := fs.checkCrossEncryption(entry.Path, dstPath); err != nil {
+		return pathError("restore", dst, err)
+	}
+
+	src := joinPath(trashFilesDir, entry.ID)
+	info, err := b.Stat(src)
+	if err != nil {
+		return pathError("restore", id, err)
+	}
+	usage, err := usageIn(b, src, info)
+	if err != nil {
+		return pathError("restore", id, err)
+	}
+	if err := fs.checkAddQuota(dstPath, usage); err != nil {
+		return pathError("restore", dst, err)
+	}
+
+	if err := b.Rename(src, inner); err != nil {
+		return pathError("restore", dst, err)
+	}
+	// an info file left behind is skipped by listings, so this can't fail
+	// the restore
+	b.Remove(trashInfoPath(entry.ID))
+
+	for owner, u := range usage {
+		fs.chargeQuota(dstPath, owner, u)
+	}
+	fs.rescanEncrypted(dstPath)
+	fs.notify(Event{Op: Create, Path: dstPath, IsDir: info.IsDir})
+	return nil
+}
+
+// EmptyTrash removes everything in the trash for good
+func (fs *FileSystem) EmptyTrash() (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("empty", "/", "", err) }()
+
+	for _, b := range fs.backend.all() {
+		if _, err := b.Stat(trashDir); errors.Is(err, ErrNotExist) {
+			continue
+		}
+		if err := b.Remove(trashDir); err != nil {
+			return pathError("empty", trashDir, err)
+		}
+	}
+	return nil
+}
+
+// trashedNode is a TrashEntry with the backend holding it
+type trashedNode struct {
+	TrashEntry
+	backend    Backend
+	mountPoint string // "" for the root backend
+}
+
+// helper: moves the node at p, which can't be or contain a mount point, to
+// the trash of its backend
+func (fs *FileSystem) moveToTrash(p string) error {
+	if len(fs.backend.mountsWithin(p)) > 0 {
+		return ErrPermission
+	}
+	now := time.Now()
+	if err := fs.expireTrash(now); err != nil {
+		return err
+	}
+
+	b, inner, _ := fs.backend.resolve(p)
+	for _, dir := range []string{trashDir, trashFilesDir, trashInfoDir} {
+		if _, err := b.Stat(dir); errors.Is(err, ErrNotExist) {
+			if err := b.Mkdir(dir, DefaultUser); err != nil {
+				return err
+			}
+		}
+	}
+
+	// ids are the deletion time, bumped past any taken ones
+	var id string
+	for n := now.UnixNano(); ; n++ {
+		id = strconv.FormatInt(n, 36)
+		if _, err := b.Stat(joinPath(trashFilesDir, id)); err != nil {
+			break
+		}
+	}
+
+	if err := b.Create(trashInfoPath(id), formatTrashInfo(inner, now), DefaultUser); err != nil {
+		return err
+	}
+	if err := b.Rename(inner, joinPath(trashFilesDir, id)); err != nil {
+		b.Remove(trashInfoPath(id))
+		return err
+	}
+	return nil
+}
+
+// helper: removes for good the nodes that have been in the trash longer
+// than the trash's maxAge
+func (fs *FileSystem) expireTrash(now time.Time) error {
+	if fs.trashMaxAge <= 0 {
+		return nil
+	}
+	trashed, err := fs.trashed()
+	if err != nil {
+		return err
+	}
+	for _, t := range trashed {
+		if now.Sub(t.Deleted) <= fs.trashMaxAge {
+			continue
+		}
+		if err := t.backend.Remove(joinPath(trashFilesDir, t.ID)); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+		if err := t.backend.Remove(trashInfoPath(t.ID)); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper: the nodes in the trash of every backend, sorted by id (and so by
+// deletion time). Info files without a node, or that can't be read, are
+// skipped.
+func (fs *FileSystem) trashed() ([]trashedNode, error) {
+	backends := map[string]Backend{"": fs.backend.root}
+	for mp, b := range fs.backend.mounts {
+		backends[mp] = b
+	}
+
+	var result []trashedNode
+	for mp, b := range backends {
+		infos, err := b.ReadDir(trashInfoDir)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range infos {
+			id, ok := strings.CutSuffix(e.Name, trashInfoExt)
+			if !ok {
+				continue
+			}
+			node, err := b.Stat(joinPath(trashFilesDir, id))
+			if err != nil {
+				continue
+			}
+			content, err := b.ReadFile(joinPath(trashInfoDir, e.Name))
+			if err != nil {
+				continue
+			}
+			inner, deleted, err := parseTrashInfo(content)
+			if err != nil {
+				continue
+			}
+			result = append(result, trashedNode{
+				TrashEntry: TrashEntry{ID: id, Path: cleanPath(mp + inner), Deleted: deleted, IsDir: node.IsDir},
+				backend:    b,
+				mountPoint: mp,
+			})
+		}
+	}
+
+	// ids from the same nanosecond clock sort by length first
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].ID, result[j].ID
+		return len(a) < len(b) || (len(a) == len(b) && a < b)
+	})
+	return result, nil
+}
+
+func trashInfoPath(id string) string {
+	return joinPath(trashInfoDir, id+trashInfoExt)
+}
+
+// helper: the content of an info file, in the freedesktop.org format
+func formatTrashInfo(path string, deleted time.Time) string {
+	escaped := (&url.URL{Path: path}).EscapedPath()
+	return fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, deleted.Format(time.RFC3339Nano))
+}
+
+// helper: reads back what formatTrashInfo wrote
+func parseTrashInfo(content string) (string, time.Time, error) {
+	var path string
+	var deleted time.Time
+	for _, line := range strings.Split(content, "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		var err error
+		switch key {
+		case "Path":
+			path, err = url.PathUnescape(value)
+		case "DeletionDate":
+			deleted, err = time.Parse(time.RFC3339Nano, value)
+		}
+		if err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	if path == "" || deleted.IsZero() {
+		return "", time.Time{}, errors.New("incomplete trash info")
+	}
+	return path, deleted, nil
+}
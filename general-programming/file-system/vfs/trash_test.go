@@ -0,0 +1,172 @@
+package vfs
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestTrash checks removing to the trash and restoring from it
+func TestTrash(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	_ = fs.Touch("/docs/a.txt", "a")
+	_ = fs.Touch("/docs/b.txt", "b")
+
+	// 1. Off by default: rm is for good
+	_ = fs.Rm("/docs/b.txt")
+	if entries, err := fs.ListTrash(); err != nil || len(entries) != 0 {
+		t.Errorf("ListTrash() with the trash off = %v, %v", entries, err)
+	}
+
+	// 2. On: the node goes to the (hidden) trash
+	fs.SetTrash(true, 0)
+	if err := fs.Rm("/docs/a.txt"); err != nil {
+		t.Fatalf("Rm() failed: %v", err)
+	}
+	if _, err := fs.Stat("/docs/a.txt"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat() after Rm error = %v, want ErrNotExist", err)
+	}
+	if names, _ := fs.Ls("/"); !reflect.DeepEqual(names, []string{"docs"}) {
+		t.Errorf("Ls(/) = %v, the trash should be hidden", names)
+	}
+	if _, err := fs.Stat(trashDir); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat(trash) error = %v, want ErrNotExist", err)
+	}
+	if err := fs.Mkdir(trashDir); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Mkdir(trash) error = %v, want ErrInvalidPath", err)
+	}
+
+	entries, err := fs.ListTrash()
+	if err != nil || len(entries) != 1 || entries[0].Path != "/docs/a.txt" || entries[0].IsDir {
+		t.Fatalf("ListTrash() = %+v, %v", entries, err)
+	}
+	if since := time.Since(entries[0].Deleted); since < 0 || since > time.Minute {
+		t.Errorf("Deleted = %v, want about now", entries[0].Deleted)
+	}
+
+	// 3. Restore puts it back where it was, or somewhere else
+	_ = fs.Touch("/docs/a.txt", "new")
+	if err := fs.Restore(entries[0].ID, ""); !errors.Is(err, ErrExist) {
+		t.Errorf("Restore() over an existing node error = %v, want ErrExist", err)
+	}
+	if err := fs.Restore(entries[0].ID, "/docs/a.old"); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if content, _ := fs.Cat("/docs/a.old"); content != "a" {
+		t.Errorf("Cat() of restored file = %q, want a", content)
+	}
+	if err := fs.Restore(entries[0].ID, ""); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Restore() twice error = %v, want ErrNotExist", err)
+	}
+
+	// 4. Directories go whole, and empty removes for good
+	_ = fs.Rm("/docs")
+	entries, _ = fs.ListTrash()
+	if len(entries) != 1 || !entries[0].IsDir {
+		t.Fatalf("ListTrash() after Rm(dir) = %+v", entries)
+	}
+	if err := fs.EmptyTrash(); err != nil {
+		t.Fatalf("EmptyTrash() failed: %v", err)
+	}
+	if entries, _ := fs.ListTrash(); len(entries) != 0 {
+		t.Errorf("ListTrash() after EmptyTrash = %+v", entries)
+	}
+	if err := fs.Restore(entries[0].ID, ""); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Restore() after EmptyTrash error = %v, want ErrNotExist", err)
+	}
+}
+
+// TestTrashExpiry checks old nodes are removed for good
+func TestTrashExpiry(t *testing.T) {
+	fs := NewFileSystem()
+	fs.SetTrash(true, 20*time.Millisecond)
+	_ = fs.Touch("/old.txt", "")
+	_ = fs.Rm("/old.txt")
+	time.Sleep(30 * time.Millisecond)
+	_ = fs.Touch("/new.txt", "")
+	_ = fs.Rm("/new.txt")
+
+	entries, err := fs.ListTrash()
+	if err != nil || len(entries) != 1 || entries[0].Path != "/new.txt" {
+		t.Errorf("ListTrash() = %+v, %v, want only /new.txt", entries, err)
+	}
+}
+
+// TestTrashQuota checks trashed nodes leave their quotas until restored
+func TestTrashQuota(t *testing.T) {
+	fs := NewFileSystem()
+	fs.SetTrash(true, 0)
+	_ = fs.Mkdir("/logs")
+	_ = fs.SetQuota("/logs", Quota{MaxBytes: 10})
+	_ = fs.Touch("/logs/a.log", "12345678")
+
+	_ = fs.Rm("/logs/a.log")
+	if err := fs.Touch("/logs/b.log", "12345678"); err != nil {
+		t.Fatalf("Touch() after trashing failed: %v", err)
+	}
+	entries, _ := fs.ListTrash()
+	if err := fs.Restore(entries[0].ID, ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Restore() over quota error = %v, want ErrQuotaExceeded", err)
+	}
+
+	_ = fs.Rm("/logs/b.log")
+	if err := fs.Restore(entries[0].ID, ""); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if got := fs.Quotas(); got[0].Used != (Usage{Bytes: 8, Inodes: 1}) {
+		t.Errorf("Quotas() after Restore = %+v", got)
+	}
+}
+
+// TestTrashMount checks every backend keeps its own trash, and that it
+// persists with the backend
+func TestTrashMount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	db, err := OpenDBBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileSystem()
+	fs.SetTrash(true, 0)
+	_ = fs.Mkdir("/db")
+	_ = fs.Mount("/db", db)
+	_ = fs.Touch("/db/f.txt", "kept")
+	if err := fs.Rm("/db/f.txt"); err != nil {
+		t.Fatalf("Rm() in mount failed: %v", err)
+	}
+	if err := fs.Rm("/db"); !errors.Is(err, ErrPermission) {
+		t.Errorf("Rm(mount point) error = %v, want ErrPermission", err)
+	}
+
+	entries, _ := fs.ListTrash()
+	if len(entries) != 1 || entries[0].Path != "/db/f.txt" {
+		t.Fatalf("ListTrash() = %+v", entries)
+	}
+	if err := fs.Restore(entries[0].ID, "/f.txt"); !errors.Is(err, ErrCrossMount) {
+		t.Errorf("Restore() to another mount error = %v, want ErrCrossMount", err)
+	}
+	_ = fs.Unmount("/db")
+
+	// the trash comes back with the database, at its new mount point
+	db, err = OpenDBBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fs.Mkdir("/again")
+	_ = fs.Mount("/again", db)
+	defer fs.Close()
+	entries, _ = fs.ListTrash()
+	if len(entries) != 1 || entries[0].Path != "/again/f.txt" {
+		t.Fatalf("ListTrash() after reopening = %+v", entries)
+	}
+	if err := fs.Restore(entries[0].ID, ""); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if content, _ := fs.Cat("/again/f.txt"); content != "kept" {
+		t.Errorf("Cat() of restored file = %q", content)
+	}
+}
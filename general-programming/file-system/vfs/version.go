@@ -0,0 +1,211 @@
+package vfs
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultVersionLimit is how many versions of each file are kept, unless
+// changed with SetVersionLimit
+const DefaultVersionLimit = 10
+
+// Version is one content a file has had, as reported by Versions. A file's
+// history starts with its first Write, which adds the content it had
+// before as version 1, written by its owner at its modification time; every
+// Write and Revert then adds one, so the last version is the current
+// content. Creating a file adds none, so files that are never rewritten
+// cost nothing.
+type Version struct {
+	N      int       // numbered from 1, and never reused for the file
+	Time   time.Time // when the content was written
+	Author string    // who wrote it
+	Size   int64
+
+	content *blob      // a reference on the content
+	store   *blobStore // that holds content
+}
+
+// blobSharer is a Backend keeping content in a blobStore, whose blobs
+// versions share rather than copy
+type blobSharer interface {
+	// fileBlob takes a reference on the blob the file at path holds
+	fileBlob(path string) (*blob, *blobStore, error)
+}
+
+// SetVersionLimit sets how many versions of each file are kept; older ones
+// are dropped, starting with the histories already kept. 0 turns history
+// off and drops it all. History is kept in memory, with the FileSystem: it
+// doesn't count towards quotas, follows a file through Mv, and goes away
+// with it on Rm. Versions are references on content blobs, shared with the
+// files on backends that keep content in blobs (memory and db) and kept in
+// a store of the FileSystem otherwise, so they are deduplicated and
+// compressed like file content.
+func (fs *FileSystem) SetVersionLimit(n int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.versionLimit = max(n, 0)
+	for p, history := range fs.versions {
+		if len(history) > fs.versionLimit {
+			fs.trimVersions(p)
+		}
+	}
+}
+
+// VersionLimit returns how many versions of each file are kept
+func (fs *FileSystem) VersionLimit() int {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.versionLimit
+}
+
+// versions(path): the kept versions of a file, oldest first
+func (fs *FileSystem) Versions(path string) ([]Version, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return nil, pathError("versions", path, err)
+	}
+	if info.IsDir {
+		return nil, pathError("versions", path, ErrIsDir)
+	}
+	return slices.Clone(fs.versions[p]), nil
+}
+
+// readversion(path, n): the content of version n of a file
+func (fs *FileSystem) ReadVersion(path string, n int) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	v, err := fs.findVersion(path, n)
+	if err != nil {
+		return "", pathError("version", path, err)
+	}
+	content, err := v.content.content()
+	if err != nil {
+		return "", pathError("version", path, err)
+	}
+	return content, nil
+}
+
+// revert(path, n): writes the content of version n back to a file, as a new
+// version
+func (fs *FileSystem) Revert(path string, n int) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("revert", path, "", err) }()
+
+	v, err := fs.findVersion(path, n)
+	if err != nil {
+		return pathError("revert", path, err)
+	}
+	content, err := v.content.content()
+	if err != nil {
+		return pathError("revert", path, err)
+	}
+	return fs.write("revert", path, content)
+}
+
+// helper: version n of the file at path
+func (fs *FileSystem) findVersion(path string, n int) (Version, error) {
+	p, info, err := fs.lookup(path)
+	if err != nil {
+		return Version{}, err
+	}
+	if info.IsDir {
+		return Version{}, ErrIsDir
+	}
+	history := fs.versions[p]
+	i := slices.IndexFunc(history, func(v Version) bool { return v.N == n })
+	if i < 0 {
+		return Version{}, ErrNotExist
+	}
+	return history[i], nil
+}
+
+// helper: before the file at p (described by info) is written, makes its
+// current content its first version if it has no history yet
+func (fs *FileSystem) seedVersions(p string, info FileInfo) error {
+	if fs.versionLimit == 0 || len(fs.versions[p]) > 0 {
+		return nil
+	}
+	b, store, err := fs.backend.fileBlob(p)
+	if errors.Is(err, ErrUnsupported) {
+		var content string
+		if content, err = fs.backend.ReadFile(p); err == nil {
+			b, store = fs.versionBlobs.put(content), fs.versionBlobs
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fs.versions[p] = []Version{{N: 1, Time: info.ModTime, Author: info.Owner, Size: b.size, content: b, store: store}}
+	return nil
+}
+
+// helper: records content, just written to the file at p, as its newest
+// version
+func (fs *FileSystem) addVersion(p, content string) {
+	if fs.versionLimit == 0 {
+		return
+	}
+	b, store, err := fs.backend.fileBlob(p)
+	if err != nil {
+		b, store = fs.versionBlobs.put(content), fs.versionBlobs
+	}
+	n := 1
+	if history := fs.versions[p]; len(history) > 0 {
+		n = history[len(history)-1].N + 1
+	}
+	v := Version{N: n, Time: time.Now(), Author: fs.user, Size: b.size, content: b, store: store}
+	fs.versions[p] = append(fs.versions[p], v)
+	fs.trimVersions(p)
+}
+
+// helper: drops the oldest versions of the file at p beyond the limit
+func (fs *FileSystem) trimVersions(p string) {
+	history := fs.versions[p]
+	if fs.versionLimit == 0 {
+		releaseVersions(history)
+		delete(fs.versions, p)
+	} else if extra := len(history) - fs.versionLimit; extra > 0 {
+		releaseVersions(history[:extra])
+		// copy, so the dropped versions can be collected
+		fs.versions[p] = slices.Clone(history[extra:])
+	}
+}
+
+// helper: drops the references versions hold on their content
+func releaseVersions(versions []Version) {
+	for _, v := range versions {
+		v.store.release(v.content)
+	}
+}
+
+// helper: the histories of files below src follow them to dst
+func (fs *FileSystem) moveVersions(src, dst string) {
+	moved := make(map[string][]Version)
+	for p, history := range fs.versions {
+		if isWithin(p, src) {
+			delete(fs.versions, p)
+			moved[dst+strings.TrimPrefix(p, src)] = history
+		}
+	}
+	for p, history := range moved {
+		fs.versions[p] = history
+	}
+}
+
+// helper: drops the histories of files at or below path, which are gone
+func (fs *FileSystem) dropVersions(path string) {
+	for p, history := range fs.versions {
+		if isWithin(p, path) {
+			releaseVersions(history)
+			delete(fs.versions, p)
+		}
+	}
+}
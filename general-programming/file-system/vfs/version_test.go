@@ -0,0 +1,160 @@
+package vfs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// helper: the versions of path, as "author:content"
+func versionsOf(t *testing.T, fs *FileSystem, path string) []string {
+	t.Helper()
+	versions, err := fs.Versions(path)
+	if err != nil {
+		t.Fatalf("Versions(%s) failed: %v", path, err)
+	}
+	var result []string
+	for _, v := range versions {
+		content, err := fs.ReadVersion(path, v.N)
+		if err != nil {
+			t.Fatalf("ReadVersion(%s, %d) failed: %v", path, v.N, err)
+		}
+		if v.Size != int64(len(content)) {
+			t.Errorf("version %d of %s: Size = %d, content %q", v.N, path, v.Size, content)
+		}
+		result = append(result, v.Author+":"+content)
+	}
+	return result
+}
+
+// TestVersions checks writes keep a bounded history that can be read and
+// reverted to
+func TestVersions(t *testing.T) {
+	fs := NewFileSystem()
+	alice := fs.WithUser("alice")
+	fs.SetVersionLimit(3)
+	_ = fs.Touch("/f.txt", "v1")
+	_ = alice.Write("/f.txt", "v2")
+	_ = fs.Write("/f.txt", "v3")
+
+	want := []string{"root:v1", "alice:v2", "root:v3"}
+	if got := versionsOf(t, fs, "/f.txt"); !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v, want %v", got, want)
+	}
+
+	// reverting is a write, so v1 drops out
+	if err := alice.Revert("/f.txt", 2); err != nil {
+		t.Fatalf("Revert() failed: %v", err)
+	}
+	if content, _ := fs.Cat("/f.txt"); content != "v2" {
+		t.Errorf("Cat() after Revert = %q, want v2", content)
+	}
+	versions, _ := fs.Versions("/f.txt")
+	if len(versions) != 3 || versions[0].N != 2 || versions[2].N != 4 {
+		t.Errorf("Versions() after Revert = %+v, want 2 to 4", versions)
+	}
+
+	tests := []struct {
+		path string
+		n    int
+		want error
+	}{
+		{"/f.txt", 1, ErrNotExist},
+		{"/f.txt", 5, ErrNotExist},
+		{"/", 1, ErrIsDir},
+		{"/missing", 1, ErrNotExist},
+	}
+	for _, tt := range tests {
+		if _, err := fs.ReadVersion(tt.path, tt.n); !errors.Is(err, tt.want) {
+			t.Errorf("ReadVersion(%s, %d) error = %v, want %v", tt.path, tt.n, err, tt.want)
+		}
+		if err := fs.Revert(tt.path, tt.n); !errors.Is(err, tt.want) {
+			t.Errorf("Revert(%s, %d) error = %v, want %v", tt.path, tt.n, err, tt.want)
+		}
+	}
+
+	// a lower limit trims what's kept, and 0 drops it all
+	fs.SetVersionLimit(1)
+	if got := versionsOf(t, fs, "/f.txt"); !reflect.DeepEqual(got, []string{"alice:v2"}) {
+		t.Errorf("versions after SetVersionLimit(1) = %v", got)
+	}
+	fs.SetVersionLimit(0)
+	_ = fs.Write("/f.txt", "v5")
+	if got := versionsOf(t, fs, "/f.txt"); len(got) != 0 {
+		t.Errorf("versions with history off = %v", got)
+	}
+}
+
+// TestVersionsSeed checks a file written before history was kept gets its
+// old content as the first version
+func TestVersionsSeed(t *testing.T) {
+	fs := NewFileSystem()
+	fs.SetVersionLimit(0)
+	_ = fs.WithUser("alice").Touch("/f.txt", "old")
+	fs.SetVersionLimit(DefaultVersionLimit)
+	_ = fs.Write("/f.txt", "new")
+
+	want := []string{"alice:old", "root:new"}
+	if got := versionsOf(t, fs, "/f.txt"); !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v, want %v", got, want)
+	}
+}
+
+// TestVersionsFollowFile checks history moves with Mv and goes with Rm
+func TestVersionsFollowFile(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/dir")
+	_ = fs.Touch("/dir/f.txt", "v1")
+	_ = fs.Write("/dir/f.txt", "v2")
+
+	_ = fs.Mv("/dir", "/moved")
+	if got := versionsOf(t, fs, "/moved/f.txt"); len(got) != 2 {
+		t.Errorf("versions after Mv = %v", got)
+	}
+
+	_ = fs.Rm("/moved/f.txt")
+	_ = fs.Touch("/moved/f.txt", "fresh")
+	if got := versionsOf(t, fs, "/moved/f.txt"); len(got) != 0 {
+		t.Errorf("versions of a recreated file = %v", got)
+	}
+	_ = fs.Write("/moved/f.txt", "rewritten")
+	if got := versionsOf(t, fs, "/moved/f.txt"); !reflect.DeepEqual(got, []string{"root:fresh", "root:rewritten"}) {
+		t.Errorf("versions of a rewritten file = %v", got)
+	}
+}
+
+// TestVersionsShareBlobs checks versions share the backend's blobs instead
+// of copying content, and let go of them when dropped
+func TestVersionsShareBlobs(t *testing.T) {
+	fs := NewFileSystem()
+	blobs := fs.backend.root.(*MemoryBackend).blobs.blobs
+	big := strings.Repeat("log line\n", 100_000)
+	_ = fs.Touch("/big.log", big)
+	if versions, _ := fs.Versions("/big.log"); len(versions) != 0 {
+		t.Errorf("Touch() added versions: %+v", versions)
+	}
+
+	_ = fs.Write("/big.log", big+"tail\n")
+	_ = fs.Write("/small.txt", "ignored")
+	if versions, _ := fs.Versions("/big.log"); len(versions) != 2 {
+		t.Fatalf("Versions() = %+v, want 2", versions)
+	}
+	// the old content and the new, each held once, compressed
+	if len(blobs) != 2 || len(fs.versionBlobs.blobs) != 0 {
+		t.Errorf("stored %d blobs and %d version blobs, want 2 and 0", len(blobs), len(fs.versionBlobs.blobs))
+	}
+	for _, b := range blobs {
+		if !b.compressed {
+			t.Errorf("blob of %d bytes isn't compressed", b.size)
+		}
+	}
+	if content, _ := fs.ReadVersion("/big.log", 1); content != big {
+		t.Errorf("ReadVersion(1) has %d bytes, want %d", len(content), len(big))
+	}
+
+	_ = fs.Rm("/big.log")
+	if len(blobs) != 0 {
+		t.Errorf("stored %d blobs after Rm, want 0", len(blobs))
+	}
+}
@@ -0,0 +1,326 @@
+// Package vfstest checks that a vfs.Backend behaves the way FileSystem
+// expects, so every backend passes the same suite.
+package vfstest
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"file-system/vfs"
+)
+
+// TestBackend runs the conformance suite. newBackend must return an empty
+// backend for every call; the suite closes it if it is an io.Closer.
+func TestBackend(t *testing.T, newBackend func(t *testing.T) vfs.Backend) {
+	t.Helper()
+
+	run := func(name string, test func(t *testing.T, b vfs.Backend)) {
+		t.Run(name, func(t *testing.T) {
+			b := newBackend(t)
+			if c, ok := b.(io.Closer); ok {
+				defer c.Close()
+			}
+			test(t, b)
+		})
+	}
+
+	run("Root", testRoot)
+	run("Mkdir", testMkdir)
+	run("Create", testCreate)
+	run("Read", testRead)
+	run("WriteFile", testWriteFile)
+	run("ReadDir", testReadDir)
+	run("Remove", testRemove)
+	run("Rename", testRename)
+	run("Xattrs", testXattrs)
+}
+
+func testRoot(t *testing.T, b vfs.Backend) {
+	info, err := b.Stat("/")
+	if err != nil || !info.IsDir {
+		t.Fatalf("Stat(/) = %+v, %v", info, err)
+	}
+	if entries, err := b.ReadDir("/"); err != nil || len(entries) != 0 {
+		t.Errorf("ReadDir(/) of new backend = %v, %v", entries, err)
+	}
+}
+
+func testMkdir(t *testing.T, b vfs.Backend) {
+	mustMkdir(t, b, "/home")
+	mustMkdir(t, b, "/home/alice")
+
+	info, err := b.Stat("/home/alice")
+	if err != nil || !info.IsDir || info.Name != "alice" {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+	if info.Owner != "" && info.Owner != "alice" {
+		t.Errorf("Owner = %q, want alice (or empty if not tracked)", info.Owner)
+	}
+
+	mustCreate(t, b, "/file.txt", "")
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/home", vfs.ErrExist},
+		{"/missing/dir", vfs.ErrNotExist},
+		{"/file.txt/dir", vfs.ErrNotDir},
+	}
+	for _, tt := range tests {
+		if err := b.Mkdir(tt.path, "alice"); !errors.Is(err, tt.want) {
+			t.Errorf("Mkdir(%s) error = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+}
+
+func testCreate(t *testing.T, b vfs.Backend) {
+	mustCreate(t, b, "/notes.txt", "hello")
+
+	info, err := b.Stat("/notes.txt")
+	if err != nil || info.IsDir || info.Size != 5 || info.Name != "notes.txt" {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+
+	mustMkdir(t, b, "/dir")
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/notes.txt", vfs.ErrExist},
+		{"/dir", vfs.ErrExist},
+		{"/missing/file", vfs.ErrNotExist},
+		{"/notes.txt/file", vfs.ErrNotDir},
+	}
+	for _, tt := range tests {
+		if err := b.Create(tt.path, "x", "alice"); !errors.Is(err, tt.want) {
+			t.Errorf("Create(%s) error = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+}
+
+func testRead(t *testing.T, b vfs.Backend) {
+	// content is bytes, not necessarily text
+	binary := "\x00\xff\xfe binary \n"
+	mustCreate(t, b, "/data.bin", binary)
+	mustMkdir(t, b, "/dir")
+
+	if content, err := b.ReadFile("/data.bin"); err != nil || content != binary {
+		t.Errorf("ReadFile() = %q, %v", content, err)
+	}
+
+	r, err := b.Open("/data.bin")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != binary {
+		t.Errorf("Open() read %q, %v", data, err)
+	}
+
+	if _, err := b.ReadFile("/dir"); !errors.Is(err, vfs.ErrIsDir) {
+		t.Errorf("ReadFile(dir) error = %v, want ErrIsDir", err)
+	}
+	if _, err := b.Open("/dir"); !errors.Is(err, vfs.ErrIsDir) {
+		t.Errorf("Open(dir) error = %v, want ErrIsDir", err)
+	}
+	if _, err := b.ReadFile("/missing"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("ReadFile(missing) error = %v, want ErrNotExist", err)
+	}
+	if _, err := b.Stat("/missing"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("Stat(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func testWriteFile(t *testing.T, b vfs.Backend) {
+	mustCreate(t, b, "/log.txt", "a much longer first version")
+	mustMkdir(t, b, "/dir")
+
+	if err := b.WriteFile("/log.txt", "short"); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if content, err := b.ReadFile("/log.txt"); err != nil || content != "short" {
+		t.Errorf("ReadFile() after WriteFile = %q, %v", content, err)
+	}
+	if info, _ := b.Stat("/log.txt"); info.Size != 5 {
+		t.Errorf("Size after WriteFile = %d, want 5", info.Size)
+	}
+
+	if err := b.WriteFile("/dir", "x"); !errors.Is(err, vfs.ErrIsDir) {
+		t.Errorf("WriteFile(dir) error = %v, want ErrIsDir", err)
+	}
+	if err := b.WriteFile("/missing", "x"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("WriteFile(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func testReadDir(t *testing.T, b vfs.Backend) {
+	mustMkdir(t, b, "/dir")
+	mustCreate(t, b, "/dir/c.txt", "ccc")
+	mustCreate(t, b, "/dir/a.txt", "a")
+	mustMkdir(t, b, "/dir/b")
+
+	entries, err := b.ReadDir("/dir")
+	if err != nil {
+		t.Fatalf("ReadDir() failed: %v", err)
+	}
+	want := []struct {
+		name  string
+		isDir bool
+		size  int64
+	}{{"a.txt", false, 1}, {"b", true, 0}, {"c.txt", false, 3}}
+	if len(entries) != len(want) {
+		t.Fatalf("ReadDir() = %+v, want %d entries", entries, len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Name != w.name || e.IsDir != w.isDir || e.Size != w.size {
+			t.Errorf("entry %d = %+v, want %s", i, e, w.name)
+		}
+	}
+
+	if _, err := b.ReadDir("/dir/a.txt"); !errors.Is(err, vfs.ErrNotDir) {
+		t.Errorf("ReadDir(file) error = %v, want ErrNotDir", err)
+	}
+	if _, err := b.ReadDir("/missing"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("ReadDir(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func testRemove(t *testing.T, b vfs.Backend) {
+	mustMkdir(t, b, "/tree")
+	mustMkdir(t, b, "/tree/sub")
+	mustCreate(t, b, "/tree/sub/leaf.txt", "leaf")
+	mustCreate(t, b, "/keep.txt", "keep")
+
+	if err := b.Remove("/tree"); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if _, err := b.Stat("/tree/sub/leaf.txt"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("Stat() below removed dir error = %v, want ErrNotExist", err)
+	}
+	if err := b.Remove("/keep.txt"); err != nil {
+		t.Errorf("Remove(file) failed: %v", err)
+	}
+	if entries, _ := b.ReadDir("/"); len(entries) != 0 {
+		t.Errorf("ReadDir(/) after Remove = %+v", entries)
+	}
+
+	if err := b.Remove("/tree"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("Remove(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func testRename(t *testing.T, b vfs.Backend) {
+	mustMkdir(t, b, "/a")
+	mustMkdir(t, b, "/a/sub")
+	mustCreate(t, b, "/a/sub/f.txt", "moved")
+	mustMkdir(t, b, "/b")
+	mustCreate(t, b, "/taken", "")
+
+	if err := b.Rename("/a/sub", "/b/renamed"); err != nil {
+		t.Fatalf("Rename() failed: %v", err)
+	}
+	if content, err := b.ReadFile("/b/renamed/f.txt"); err != nil || content != "moved" {
+		t.Errorf("ReadFile() after Rename = %q, %v", content, err)
+	}
+	if info, err := b.Stat("/b/renamed"); err != nil || info.Name != "renamed" {
+		t.Errorf("Stat() after Rename = %+v, %v", info, err)
+	}
+	if _, err := b.Stat("/a/sub"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("Stat(old path) error = %v, want ErrNotExist", err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     error
+	}{
+		{"Missing source", "/a/sub", "/c", vfs.ErrNotExist},
+		{"Existing destination", "/b", "/taken", vfs.ErrExist},
+		{"Missing destination parent", "/b", "/missing/b", vfs.ErrNotExist},
+	}
+	for _, tt := range tests {
+		if err := b.Rename(tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Rename() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if content, err := b.ReadFile("/taken"); err != nil || content != "" {
+		t.Errorf("destination changed by failed Rename: %q, %v", content, err)
+	}
+}
+
+// testXattrs only runs on backends implementing vfs.XattrBackend, and is
+// skipped if the storage underneath turns out not to support attributes
+func testXattrs(t *testing.T, b vfs.Backend) {
+	xb, ok := b.(vfs.XattrBackend)
+	if !ok {
+		t.Skip("backend does not implement vfs.XattrBackend")
+	}
+	mustMkdir(t, b, "/dir")
+	mustCreate(t, b, "/dir/f.txt", "content")
+
+	err := xb.SetXattr("/dir/f.txt", "team", "storage")
+	if errors.Is(err, vfs.ErrUnsupported) {
+		t.Skip("attributes not supported here")
+	}
+	if err != nil {
+		t.Fatalf("SetXattr() failed: %v", err)
+	}
+	if err := xb.SetXattr("/dir", "type", "folder"); err != nil {
+		t.Fatalf("SetXattr(dir) failed: %v", err)
+	}
+
+	// attributes stay with the node through writes and renames
+	if err := b.WriteFile("/dir/f.txt", "rewritten"); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if err := b.Rename("/dir", "/moved"); err != nil {
+		t.Fatalf("Rename() failed: %v", err)
+	}
+	if attrs, err := xb.Xattrs("/moved/f.txt"); err != nil || len(attrs) != 1 || attrs["team"] != "storage" {
+		t.Errorf("Xattrs(file) = %v, %v", attrs, err)
+	}
+	if attrs, err := xb.Xattrs("/moved"); err != nil || attrs["type"] != "folder" {
+		t.Errorf("Xattrs(dir) = %v, %v", attrs, err)
+	}
+
+	if err := xb.RemoveXattr("/moved/f.txt", "team"); err != nil {
+		t.Errorf("RemoveXattr() failed: %v", err)
+	}
+	if attrs, err := xb.Xattrs("/moved/f.txt"); err != nil || len(attrs) != 0 {
+		t.Errorf("Xattrs() after RemoveXattr = %v, %v", attrs, err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"RemoveXattr missing", xb.RemoveXattr("/moved/f.txt", "team"), vfs.ErrNoXattr},
+		{"SetXattr missing node", xb.SetXattr("/missing", "team", "x"), vfs.ErrNotExist},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+	if _, err := xb.Xattrs("/missing"); !errors.Is(err, vfs.ErrNotExist) {
+		t.Errorf("Xattrs(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func mustMkdir(t *testing.T, b vfs.Backend, path string) {
+	t.Helper()
+	if err := b.Mkdir(path, "alice"); err != nil {
+		t.Fatalf("Mkdir(%s) failed: %v", path, err)
+	}
+}
+
+func mustCreate(t *testing.T, b vfs.Backend, path, content string) {
+	t.Helper()
+	if err := b.Create(path, content, "alice"); err != nil {
+		t.Fatalf("Create(%s) failed: %v", path, err)
+	}
+}
@@ -0,0 +1,197 @@
+package vfs
+
+import (
+	"strings"
+	"sync"
+)
+
+// EventOp is the kind of change an Event describes
+type EventOp int
+
+const (
+	Create EventOp = iota + 1
+	Modify
+	Delete
+	Rename
+)
+
+func (op EventOp) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Modify:
+		return "modify"
+	case Delete:
+		return "delete"
+	case Rename:
+		return "rename"
+	}
+	return "unknown"
+}
+
+// Event describes one change to the tree. Paths are cleaned and absolute.
+// Removing a directory is a single Delete for the directory itself; its
+// descendants do not get events of their own.
+type Event struct {
+	Op      EventOp
+	Path    string
+	OldPath string // previous path, for Rename only
+	IsDir   bool
+}
+
+func (e Event) String() string {
+	if e.Op == Rename {
+		return e.Op.String() + " " + e.OldPath + " -> " + e.Path
+	}
+	return e.Op.String() + " " + e.Path
+}
+
+// Watcher delivers the events for one watched path. Events are queued
+// without limit, so a slow reader never blocks the FileSystem, and are
+// delivered in the order the changes happened.
+type Watcher struct {
+	fs        *FileSystem
+	path      string
+	recursive bool
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []Event
+	closed bool
+	done   chan struct{}
+	events chan Event
+}
+
+// Watch starts watching path, which must exist. A non-recursive watch
+// reports changes to path itself and its direct children; a recursive one
+// also reports changes anywhere below it.
+func (fs *FileSystem) Watch(path string, recursive bool) (*Watcher, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	p, _, err := fs.lookup(path)
+	if err != nil {
+		return nil, pathError("watch", path, err)
+	}
+
+	w := &Watcher{
+		fs:        fs,
+		path:      p,
+		recursive: recursive,
+		done:      make(chan struct{}),
+		events:    make(chan Event),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	fs.watchers = append(fs.watchers, w)
+
+	go w.run()
+	return w, nil
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Close stops the watcher. Events still queued are dropped.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.queue = nil
+	close(w.done)
+	w.mu.Unlock()
+	w.cond.Broadcast()
+
+	w.fs.mu.Lock()
+	for i, other := range w.fs.watchers {
+		if other == w {
+			w.fs.watchers = append(w.fs.watchers[:i], w.fs.watchers[i+1:]...)
+			break
+		}
+	}
+	w.fs.mu.Unlock()
+	return nil
+}
+
+// helper: moves queued events onto the channel until the watcher is closed
+func (w *Watcher) run() {
+	defer close(w.events)
+
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		ev := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		select {
+		case w.events <- ev:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// helper: reports whether ev concerns the watched path
+func (w *Watcher) matches(ev Event) bool {
+	if w.covers(ev.Path) || (ev.Op == Rename && w.covers(ev.OldPath)) {
+		return true
+	}
+
+	// the watched node itself went away with one of its ancestors
+	if ev.Op == Delete {
+		return isWithin(w.path, ev.Path)
+	}
+	if ev.Op == Rename {
+		return isWithin(w.path, ev.OldPath)
+	}
+	return false
+}
+
+// helper: reports whether a change at path is in the watcher's scope
+func (w *Watcher) covers(path string) bool {
+	if !isWithin(path, w.path) {
+		return false
+	}
+	if w.recursive {
+		return true
+	}
+	// the watched path or one of its direct children
+	return len(parsePath(path))-len(parsePath(w.path)) <= 1
+}
+
+// helper: queues ev on every watcher it concerns, and updates the search
+// index. Callers hold fs.mu.
+func (fs *FileSystem) notify(ev Event) {
+	fs.updateIndex(ev)
+	fs.folds.update(ev)
+	for _, w := range fs.watchers {
+		if !w.matches(ev) {
+			continue
+		}
+		w.mu.Lock()
+		if !w.closed {
+			w.queue = append(w.queue, ev)
+		}
+		w.mu.Unlock()
+		w.cond.Signal()
+	}
+}
+
+// helper: turns path into its absolute form without empty components
+func cleanPath(path string) string {
+	if isClean(path) {
+		return path
+	}
+	return "/" + strings.Join(parsePath(path), "/")
+}
@@ -0,0 +1,95 @@
+package vfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// helper: reads n events or fails after a timeout
+func nextEvents(t *testing.T, w *Watcher, n int) []Event {
+	t.Helper()
+	var got []Event
+	for len(got) < n {
+		select {
+		case ev := <-w.Events():
+			got = append(got, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d of %d events: %v", len(got), n, got)
+		}
+	}
+	return got
+}
+
+// TestWatchRecursive checks every kind of event is delivered in order
+func TestWatchRecursive(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/home")
+
+	w, err := fs.Watch("/home", true)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	defer w.Close()
+
+	_ = fs.Mkdir("/home/user")
+	_ = fs.Touch("/home/user/a.txt", "a")
+	_ = fs.Write("/home/user/a.txt", "b")
+	_ = fs.Mv("/home/user/a.txt", "/home/user/b.txt")
+	_ = fs.Rm("/home/user")
+	_ = fs.Touch("/outside.txt", "") // not watched
+
+	want := []Event{
+		{Op: Create, Path: "/home/user", IsDir: true},
+		{Op: Create, Path: "/home/user/a.txt"},
+		{Op: Modify, Path: "/home/user/a.txt"},
+		{Op: Rename, Path: "/home/user/b.txt", OldPath: "/home/user/a.txt"},
+		{Op: Delete, Path: "/home/user", IsDir: true},
+	}
+	if got := nextEvents(t, w, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	select {
+	case ev := <-w.Events():
+		t.Errorf("unexpected event %v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestWatchScope checks non-recursive watches only see direct children,
+// moves in and out of scope are reported, and Close ends the stream
+func TestWatchScope(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/a")
+	_ = fs.Mkdir("/a/b")
+	_ = fs.Mkdir("/other")
+
+	w, err := fs.Watch("/a", false)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	_ = fs.Touch("/a/b/deep.txt", "")       // too deep
+	_ = fs.Touch("/a/top.txt", "")          // direct child
+	_ = fs.Mv("/a/top.txt", "/other/x.txt") // moved out
+	_ = fs.Rm("/a")                         // the watched dir itself
+
+	want := []Event{
+		{Op: Create, Path: "/a/top.txt"},
+		{Op: Rename, Path: "/other/x.txt", OldPath: "/a/top.txt"},
+		{Op: Delete, Path: "/a", IsDir: true},
+	}
+	if got := nextEvents(t, w, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	_ = w.Close()
+	if _, ok := <-w.Events(); ok {
+		t.Error("expected Events() to be closed after Close")
+	}
+
+	if _, err := fs.Watch("/missing", false); err == nil {
+		t.Error("expected Watch on a missing path to fail")
+	}
+}
@@ -0,0 +1,162 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"sort"
+)
+
+// XattrBackend is implemented by backends that can store extended
+// attributes: small name/value pairs on any node, like a content type or
+// the team owning a file. They stay with a node when it is moved or
+// written. FileSystem operations on attributes fail with ErrUnsupported on
+// backends without them.
+type XattrBackend interface {
+	// Xattrs returns every attribute of the node at path (nil if none)
+	Xattrs(path string) (map[string]string, error)
+	// SetXattr adds an attribute or replaces its value
+	SetXattr(path, name, value string) error
+	// RemoveXattr removes an attribute, failing with ErrNoXattr if the
+	// node doesn't have it
+	RemoveXattr(path, name string) error
+}
+
+var (
+	_ XattrBackend = (*MemoryBackend)(nil)
+	_ XattrBackend = (*HostBackend)(nil)
+	_ XattrBackend = (*DBBackend)(nil)
+	_ XattrBackend = (*OverlayBackend)(nil)
+	_ XattrBackend = (*mountTable)(nil)
+)
+
+// getxattr(path, name)
+func (fs *FileSystem) GetXattr(path, name string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return "", pathError("getxattr", path, err)
+	}
+	attrs, err := fs.backend.Xattrs(p)
+	if err != nil {
+		return "", pathError("getxattr", path, err)
+	}
+	value, ok := attrs[name]
+	if !ok {
+		return "", pathError("getxattr", path, ErrNoXattr)
+	}
+	return value, nil
+}
+
+// listxattr(path): the names of a node's attributes, sorted
+func (fs *FileSystem) ListXattrs(path string) ([]string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return nil, pathError("listxattr", path, err)
+	}
+	attrs, err := fs.backend.Xattrs(p)
+	if err != nil {
+		return nil, pathError("listxattr", path, err)
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// setxattr(path, name, value): name must not be empty
+func (fs *FileSystem) SetXattr(path, name, value string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("setxattr", path, "", err) }()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return pathError("setxattr", path, err)
+	}
+	if name == "" {
+		return pathError("setxattr", path, iofs.ErrInvalid)
+	}
+	if name == encryptionXattr {
+		return pathError("setxattr", path, ErrPermission)
+	}
+	// a lock covers its file's attributes, not those of the directories
+	// above it
+	if err := fs.checkLock(p); err != nil {
+		return pathError("setxattr", path, err)
+	}
+	if err := fs.backend.SetXattr(p, name, value); err != nil {
+		return pathError("setxattr", path, err)
+	}
+	fs.notifyXattr(p)
+	return nil
+}
+
+// removexattr(path, name)
+func (fs *FileSystem) RemoveXattr(path, name string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	defer func() { fs.record("removexattr", path, "", err) }()
+
+	p, err := fs.checkPath(path)
+	if err != nil {
+		return pathError("removexattr", path, err)
+	}
+	if name == encryptionXattr {
+		return pathError("removexattr", path, ErrPermission)
+	}
+	if err := fs.checkLock(p); err != nil {
+		return pathError("removexattr", path, err)
+	}
+	if err := fs.backend.RemoveXattr(p, name); err != nil {
+		return pathError("removexattr", path, err)
+	}
+	fs.notifyXattr(p)
+	return nil
+}
+
+// helper: attribute changes are reported to watchers as a Modify
+func (fs *FileSystem) notifyXattr(path string) {
+	info, err := fs.backend.Stat(path)
+	if err == nil {
+		fs.notify(Event{Op: Modify, Path: path, IsDir: info.IsDir})
+	}
+}
+
+// helper: copies the attributes of the node at src in from onto the node
+// at dst in to. Attributes are dropped when to can't store them.
+func copyXattrs(from Backend, src string, to Backend, dst string) error {
+	fromX, ok := from.(XattrBackend)
+	if !ok {
+		return nil
+	}
+	toX, ok := to.(XattrBackend)
+	if !ok {
+		return nil
+	}
+
+	attrs, err := fromX.Xattrs(src)
+	if err != nil {
+		return ignoreUnsupported(err)
+	}
+	for name, value := range attrs {
+		if err := toX.SetXattr(dst, name, value); err != nil {
+			return ignoreUnsupported(err)
+		}
+	}
+	return nil
+}
+
+func ignoreUnsupported(err error) error {
+	if errors.Is(err, ErrUnsupported) {
+		return nil
+	}
+	return err
+}
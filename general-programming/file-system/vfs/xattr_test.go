@@ -0,0 +1,134 @@
+package vfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// TestXattrs checks attributes through the FileSystem API
+func TestXattrs(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/docs")
+	_ = fs.Touch("/docs/a.txt", "hello")
+
+	// 1. Set, get and list
+	_ = fs.SetXattr("/docs/a.txt", "type", "text/plain")
+	_ = fs.SetXattr("/docs/a.txt", "team", "storage")
+	if value, err := fs.GetXattr("/docs/a.txt", "team"); err != nil || value != "storage" {
+		t.Errorf("GetXattr() = %q, %v", value, err)
+	}
+	if names, err := fs.ListXattrs("/docs/a.txt"); err != nil || !reflect.DeepEqual(names, []string{"team", "type"}) {
+		t.Errorf("ListXattrs() = %v, %v", names, err)
+	}
+	if names, err := fs.ListXattrs("/docs"); err != nil || len(names) != 0 {
+		t.Errorf("ListXattrs() of untagged dir = %v, %v", names, err)
+	}
+
+	// 2. They follow the node through writes, moves and copies
+	_ = fs.Write("/docs/a.txt", "changed")
+	_ = fs.Mv("/docs/a.txt", "/docs/b.txt")
+	_ = fs.Cp("/docs", "/copy")
+	for _, p := range []string{"/docs/b.txt", "/copy/b.txt"} {
+		if value, err := fs.GetXattr(p, "type"); err != nil || value != "text/plain" {
+			t.Errorf("GetXattr(%s) = %q, %v", p, value, err)
+		}
+	}
+
+	// 3. Remove, and the errors
+	if err := fs.RemoveXattr("/copy/b.txt", "type"); err != nil {
+		t.Errorf("RemoveXattr() failed: %v", err)
+	}
+	if _, err := fs.GetXattr("/docs/b.txt", "type"); err != nil {
+		t.Errorf("RemoveXattr() on the copy changed the original: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"Get missing attribute", get(fs.GetXattr("/copy/b.txt", "type")), ErrNoXattr},
+		{"Remove missing attribute", fs.RemoveXattr("/copy/b.txt", "type"), ErrNoXattr},
+		{"Get on missing node", get(fs.GetXattr("/missing", "type")), ErrNotExist},
+		{"Set on missing node", fs.SetXattr("/missing", "type", "x"), ErrNotExist},
+		{"Set empty name", fs.SetXattr("/docs", "", "x"), iofs.ErrInvalid},
+	}
+	for _, tt := range tests {
+		var pathErr *PathError
+		if !errors.Is(tt.err, tt.want) || !errors.As(tt.err, &pathErr) {
+			t.Errorf("%s: error = %v, want a PathError wrapping %v", tt.name, tt.err, tt.want)
+		}
+	}
+}
+
+// helper: drops the value of a (value, error) pair
+func get(_ string, err error) error { return err }
+
+// TestXattrsOverlay checks attributes of lower nodes are copied up, not
+// changed in place
+func TestXattrsOverlay(t *testing.T) {
+	lower := NewMemoryBackend()
+	_ = lower.Mkdir("/dir", "root")
+	_ = lower.Create("/dir/f.txt", "base", "root")
+	_ = lower.SetXattr("/dir/f.txt", "team", "base")
+
+	fs := NewFileSystemWithBackend(NewOverlayBackend(lower, NewMemoryBackend()))
+	if value, _ := fs.GetXattr("/dir/f.txt", "team"); value != "base" {
+		t.Errorf("GetXattr() of lower file = %q, want base", value)
+	}
+
+	_ = fs.SetXattr("/dir/f.txt", "team", "upper")
+	_ = fs.Write("/dir/f.txt", "changed")
+	if value, _ := fs.GetXattr("/dir/f.txt", "team"); value != "upper" {
+		t.Errorf("GetXattr() after copy-up = %q, want upper", value)
+	}
+	if attrs, _ := lower.Xattrs("/dir/f.txt"); attrs["team"] != "base" {
+		t.Errorf("lower attributes changed: %v", attrs)
+	}
+}
+
+// TestFind checks matching by name, type and attribute
+func TestFind(t *testing.T) {
+	fs := NewFileSystem()
+	_ = fs.Mkdir("/src")
+	_ = fs.Mkdir("/src/pkg")
+	_ = fs.Touch("/src/main.go", "")
+	_ = fs.Touch("/src/pkg/util.go", "")
+	_ = fs.Touch("/src/README", "")
+	_ = fs.SetXattr("/src/main.go", "team", "core")
+	_ = fs.SetXattr("/src/pkg", "team", "tools")
+
+	tests := []struct {
+		name  string
+		root  string
+		query FindQuery
+		want  []string
+	}{
+		{"Everything", "/src/pkg", FindQuery{}, []string{"/src/pkg", "/src/pkg/util.go"}},
+		{"Name glob", "/", FindQuery{Name: "*.go"}, []string{"/src/main.go", "/src/pkg/util.go"}},
+		{"Directories", "/", FindQuery{Type: FindDirs}, []string{"/", "/src", "/src/pkg"}},
+		{"Files", "/src/pkg", FindQuery{Type: FindFiles}, []string{"/src/pkg/util.go"}},
+		{"Has attribute", "/", FindQuery{Xattr: "team"}, []string{"/src/main.go", "/src/pkg"}},
+		{"Attribute value", "/", FindQuery{Xattr: "team", XattrValue: "core"}, []string{"/src/main.go"}},
+		{"Combined", "/", FindQuery{Type: FindDirs, Xattr: "team"}, []string{"/src/pkg"}},
+		{"No match", "/", FindQuery{Name: "*.txt"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.Find(tt.root, tt.query)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find(%s, %+v) = %v, %v, want %v", tt.root, tt.query, got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := fs.Find("/missing", FindQuery{}); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Find(missing) error = %v, want ErrNotExist", err)
+	}
+	if _, err := fs.Find("/", FindQuery{Name: "["}); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("Find() with a bad pattern error = %v, want ErrBadPattern", err)
+	}
+}